@@ -0,0 +1,91 @@
+package attr
+
+import (
+	"cmp"
+	"slices"
+)
+
+// Breakdown explains how the Current value of an attribute is produced, for
+// tooltips and debugging. It replays Eval over the active modifiers, so Current
+// is bit-identical to what Flush writes.
+type Breakdown struct {
+	Base  float64
+	Steps []BreakdownStep // one per channel with active modifiers, in evaluation order
+	// Value is the result of the last step, or Base without steps.
+	Value float64
+	// Current is Value after the PreCurrentChange hook, which may clamp it.
+	Current float64
+	Clamped bool
+	// Gated lists the modifiers that are skipped because their Require query
+	// does not match the current tags.
+	Gated []Modifier
+}
+
+// BreakdownStep is the aggregation of one channel. Add, Mul and Div are the
+// aggregates under Policy, so the value leaving it is (in + Add) * Mul / Div,
+// or the Value of the winning Override. Under PolicyClamp Add and Mul are the
+// floor and ceiling instead.
+type BreakdownStep struct {
+	Channel uint8
+	Policy  Policy
+	Add     float64
+	Mul     float64
+	Div     float64
+	// Mods are the active modifiers of the channel in aggregation order. Their
+	// Op and Source tell which contribution came from where.
+	Mods     []Modifier
+	Override *Modifier // points into Mods, nil without ModOverride
+	Value    float64
+}
+
+// Breakdown explains the Current value of key as the next Flush computes it,
+// so pending base and modifier changes are included. It calls the
+// PreCurrentChange hook of the set but writes nothing.
+func (t *Table) Breakdown(key Key) (Breakdown, bool) {
+	var b Breakdown
+	set := t.Values.Get(KeySetID(key))
+	if set == nil {
+		return b, false
+	}
+	field := KeyField(key)
+	base, ok := set.GetBase(field)
+	if !ok {
+		return b, false
+	}
+	b.Base, b.Value = base, base
+	mods := t.ActiveModifiers(key, nil)
+	if a := t.mods[key]; a != nil && a.gated > 0 {
+		for i, mod := range a.mods {
+			if a.off[i] {
+				b.Gated = append(b.Gated, mod)
+			}
+		}
+	}
+	// a stable sort keeps the aggregation order of each channel
+	slices.SortStableFunc(mods, func(x, y Modifier) int { return cmp.Compare(x.Channel, y.Channel) })
+	for len(mods) > 0 {
+		n := 1
+		for n < len(mods) && mods[n].Channel == mods[0].Channel {
+			n++
+		}
+		ch := mods[0].Channel
+		c := newChannelMods(t.policies()[ch])
+		step := BreakdownStep{Channel: ch, Policy: c.policy, Mods: mods[:n:n]}
+		for i, mod := range step.Mods {
+			c.apply(mod)
+			if mod.Op == ModOverride && c.override == mod {
+				step.Override = &step.Mods[i]
+			}
+		}
+		b.Value = c.fold(b.Value)
+		step.Add, step.Mul, step.Div, step.Value = c.add, c.mul, c.div, b.Value
+		b.Steps = append(b.Steps, step)
+		mods = mods[n:]
+	}
+	b.Current = b.Value
+	if hooks, ok := set.(Hooks); ok {
+		b.Current = hooks.PreCurrentChange(field, b.Value)
+	}
+	b.Clamped = b.Current != b.Value
+	return b, true
+}
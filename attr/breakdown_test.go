@@ -0,0 +1,69 @@
+package attr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableBreakdown(t *testing.T) {
+	var attrs Table
+	attrs.Put(&testSet{})
+	attrs.SetBase(testAttrAttack, 100)
+	attrs.AddModifiers([]Modifier{
+		{Source: 1, Attr: testAttrAttack, Op: ModAdd, Value: 20},
+		{Source: 2, Attr: testAttrAttack, Op: ModMul, Value: 1.5, Channel: 2},
+		{Source: 3, Attr: testAttrAttack, Op: ModMul, Value: 1.2},
+		{Source: 4, Attr: testAttrAttack, Op: ModDiv, Value: 2, Channel: 2},
+	})
+
+	b, ok := attrs.Breakdown(testAttrAttack)
+	require.True(t, ok)
+	require.Equal(t, 100.0, b.Base)
+	require.Len(t, b.Steps, 2)
+	s := b.Steps[0]
+	require.Equal(t, uint8(0), s.Channel)
+	require.Equal(t, []uint64{1, 3}, sources(s.Mods))
+	require.Equal(t, 20.0, s.Add)
+	require.Equal(t, 1.2, s.Mul)
+	require.Equal(t, 144.0, s.Value)
+	s = b.Steps[1]
+	require.Equal(t, []uint64{2, 4}, sources(s.Mods))
+	require.Equal(t, 2.0, s.Div)
+	require.Nil(t, s.Override)
+	require.Equal(t, 108.0, s.Value)
+	require.False(t, b.Clamped)
+	// the breakdown is computed before Flush and agrees with it bit for bit
+	require.Equal(t, math.Float64bits(b.Current), math.Float64bits(attack(t, &attrs)))
+
+	attrs.AddModifiers([]Modifier{
+		{Source: 5, Attr: testAttrAttack, Op: ModOverride, Priority: 1, Value: 50, Channel: 2},
+		{Source: 6, Attr: testAttrAttack, Op: ModOverride, Priority: 3, Value: 70, Channel: 2},
+		{Source: 7, Attr: testAttrAttack, Op: ModOverride, Priority: 2, Value: 90, Channel: 2},
+	})
+	b, _ = attrs.Breakdown(testAttrAttack)
+	s = b.Steps[1]
+	require.Len(t, s.Mods, 5)
+	require.Equal(t, uint64(6), s.Override.Source)
+	require.Equal(t, 70.0, b.Current)
+
+	// the PreCurrentChange clamp is reported separately
+	attrs.SetBase(testAttrHP, 10)
+	attrs.AddModifier(Modifier{Source: 8, Attr: testAttrHP, Op: ModAdd, Value: -25})
+	b, _ = attrs.Breakdown(testAttrHP)
+	require.Equal(t, -15.0, b.Value)
+	require.Equal(t, 0.0, b.Current)
+	require.True(t, b.Clamped)
+
+	_, ok = attrs.Breakdown(MakeKey(testSetID+1, 0))
+	require.False(t, ok)
+}
+
+func sources(mods []Modifier) []uint64 {
+	out := make([]uint64, len(mods))
+	for i, mod := range mods {
+		out[i] = mod.Source
+	}
+	return out
+}
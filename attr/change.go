@@ -0,0 +1,35 @@
+package attr
+
+// ChangeKind tells which value of an attribute a Change describes.
+type ChangeKind uint8
+
+const (
+	ChangeCurrent ChangeKind = iota
+	ChangeBase
+)
+
+// Change records one value that changed during a flush. A base change reports
+// the base before its first write since the previous flush, so a base written
+// several times and then restored produces no record.
+type Change struct {
+	Key  Key
+	Kind ChangeKind
+	Old  float64
+	New  float64
+}
+
+// FlushInto is Flush that also appends a Change for every base and current
+// value that changed, in recompute order. A base change comes right before the
+// current change of the same key. Unlike Hooks.PostCurrentChange the records
+// are consumed after the flush, so the owner can turn them into scheduler
+// state, BT events or replication packets.
+func (t *Table) FlushInto(dst []Change) []Change {
+	t.flushDirty(&dst)
+	return dst
+}
+
+// RecomputeAllInto is RecomputeAll that appends changes like FlushInto.
+func (t *Table) RecomputeAllInto(dst []Change) []Change {
+	t.recomputeAll(&dst)
+	return dst
+}
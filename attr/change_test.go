@@ -0,0 +1,65 @@
+package attr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableFlushInto(t *testing.T) {
+	var attrs Table
+	attrs.Put(&testSet{})
+	attrs.SetBase(testAttrAttack, 100)
+	require.Equal(t, []Change{
+		{Key: testAttrAttack, Kind: ChangeBase, Old: 0, New: 100},
+		{Key: testAttrAttack, Kind: ChangeCurrent, Old: 0, New: 100},
+	}, attrs.FlushInto(nil))
+
+	// modifier changes only move Current; the buffer is appended to
+	attrs.AddModifier(Modifier{Source: 1, Attr: testAttrAttack, Op: ModMul, Value: 1.5})
+	buf := attrs.FlushInto([]Change{{}})
+	require.Equal(t, []Change{{}, {Key: testAttrAttack, Kind: ChangeCurrent, Old: 100, New: 150}}, buf)
+
+	// the old base is the one before the first write since the last flush
+	attrs.SetBase(testAttrAttack, 80)
+	attrs.SetBase(testAttrAttack, 90)
+	attrs.SetBase(testAttrHP, 10)
+	attrs.SetBase(testAttrHP, 0)
+	changes := attrs.FlushInto(buf[:0])
+	require.Equal(t, []Change{
+		{Key: testAttrAttack, Kind: ChangeBase, Old: 100, New: 90},
+		{Key: testAttrAttack, Kind: ChangeCurrent, Old: 150, New: 135},
+	}, changes)
+
+	// Flush drops the pending base records
+	attrs.SetBase(testAttrAttack, 10)
+	attrs.Flush()
+	require.Empty(t, attrs.FlushInto(nil))
+
+	// Current is compared after the PreCurrentChange clamp, so it did not change
+	attrs.SetBase(testAttrHP, 5)
+	attrs.AddModifier(Modifier{Source: 2, Attr: testAttrHP, Op: ModAdd, Value: -20})
+	require.Equal(t, []Change{{Key: testAttrHP, Kind: ChangeBase, Old: 0, New: 5}}, attrs.FlushInto(nil))
+
+	attrs.RemoveModifiersBySource(1)
+	require.Equal(t, []Change{{Key: testAttrAttack, Kind: ChangeCurrent, Old: 15, New: 10}}, attrs.RecomputeAllInto(nil))
+}
+
+func TestTableFlushIntoDerivations(t *testing.T) {
+	var attrs Table
+	attrs.Put(&benchSet{})
+	stamina, maxHP := field(0), field(1)
+	require.NoError(t, attrs.AddDerivation(Derivation{
+		Target: maxHP,
+		Deps:   []Key{stamina},
+		Fn:     func(t *Table) (float64, error) { v, _ := t.GetCurrent(stamina); return v * 10, nil },
+	}))
+	attrs.Flush()
+	attrs.SetBase(stamina, 3)
+	require.Equal(t, []Change{
+		{Key: stamina, Kind: ChangeBase, Old: 0, New: 3},
+		{Key: stamina, Kind: ChangeCurrent, Old: 0, New: 3},
+		{Key: maxHP, Kind: ChangeBase, Old: 0, New: 30},
+		{Key: maxHP, Kind: ChangeCurrent, Old: 0, New: 30},
+	}, attrs.FlushInto(nil))
+}
@@ -234,6 +234,16 @@ func Generate(w io.Writer, pkg string, name string, cfg SetConfig) error {
 	}
 	p(")\n\n")
 
+	// ---- Attribute Names ----
+	p("// ---------- Attribute Names ----------\n\n")
+	p("// %sAttrNames maps field names to global AttrKeys, e.g. for binding\n", prefix)
+	p("// expression identifiers at compile time.\n")
+	p("var %sAttrNames = map[string]uint32{\n", prefix)
+	for _, f := range fields {
+		p("\t%q: %sAttrKey_%s,\n", f.Name, prefix, f.Name)
+	}
+	p("}\n\n")
+
 	// ---- Dirty Bits ----
 	p("// ---------- Dirty Bits ----------\n\n")
 	p("const (\n")
@@ -369,6 +369,8 @@ func TestGenerate_ValidGo(t *testing.T) {
 		"DemoSetID",
 		"DemoField_Hp",
 		"DemoAttrKey_Hp",
+		"DemoAttrNames",
+		`"MaxHp": DemoAttrKey_MaxHp`,
 		"DemoDirty_Hp",
 		"GetDemoAttrs",
 		"attr.AttributeSet",
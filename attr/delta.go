@@ -0,0 +1,122 @@
+package attr
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+)
+
+var ErrDeltaCorrupt = errors.New("attr: corrupt delta")
+
+// DeltaCodec replicates attribute changes from a server Map to a client Map.
+// Encode sends only the fields marked in each set's Dirty mask and clears the
+// masks; Decode applies the result. Both sides must use the same settings.
+//
+// The encoding is the number of dirty sets, then per set its id, the dirty
+// mask and one value per set bit in field order, all as varints except
+// unquantized values, which are little-endian float64.
+type DeltaCodec struct {
+	// Base also sends the Base of every dirty field, after its Current. Clients
+	// that only display stats leave it off.
+	Base bool
+	// Quantum returns the step a field is rounded to, e.g. 0.01 for a
+	// percentage shown with two decimals. A quantized value is sent as the
+	// varint of round(v/step), which is a byte or two for typical stats
+	// instead of eight. nil or a step <= 0 sends the exact float64. Quantized
+	// fields must stay finite.
+	Quantum func(Key) float64
+}
+
+// Encode appends the dirty fields of m to dst, clears every dirty mask and
+// returns the extended buffer. A Map without dirty sets encodes to one byte.
+func (c *DeltaCodec) Encode(dst []byte, m *Map) []byte {
+	n := 0
+	m.sets.Iter(func(_ uint32, set AttributeSet) bool {
+		if set.Dirty() != 0 {
+			n++
+		}
+		return false
+	})
+	dst = binary.AppendUvarint(dst, uint64(n))
+	m.sets.Iter(func(id uint32, set AttributeSet) bool {
+		mask := set.Dirty()
+		if mask == 0 {
+			return false
+		}
+		dst = binary.AppendUvarint(dst, uint64(id))
+		dst = binary.AppendUvarint(dst, mask)
+		for rest := mask; rest != 0; rest &= rest - 1 {
+			field := uint16(bits.TrailingZeros64(rest))
+			step := c.quantum(MakeKey(id, field))
+			cur, _ := set.GetCurrent(field)
+			dst = appendDelta(dst, cur, step)
+			if c.Base {
+				base, _ := set.GetBase(field)
+				dst = appendDelta(dst, base, step)
+			}
+		}
+		set.ClearDirty()
+		return false
+	})
+	return dst
+}
+
+// Decode applies a delta produced by Encode to m, writing Current, and Base
+// when enabled, through the set hooks. Sets and fields that m does not have
+// are skipped. A corrupt delta fails with ErrDeltaCorrupt before anything is
+// written.
+func (c *DeltaCodec) Decode(data []byte, m *Map) error {
+	type value struct {
+		key       Key
+		cur, base float64
+	}
+	var values []value
+	r := byteReader{b: data}
+	for range r.count() {
+		id := uint32(r.uvarint())
+		for rest := r.uvarint(); rest != 0 && r.err == nil; rest &= rest - 1 {
+			v := value{key: MakeKey(id, uint16(bits.TrailingZeros64(rest)))}
+			step := c.quantum(v.key)
+			v.cur = r.delta(step)
+			if c.Base {
+				v.base = r.delta(step)
+			}
+			values = append(values, v)
+		}
+	}
+	if r.err == nil && len(r.b) > 0 {
+		r.fail()
+	}
+	if r.err != nil {
+		return ErrDeltaCorrupt
+	}
+	for _, v := range values {
+		if c.Base {
+			m.SetBase(v.key, v.base)
+		}
+		m.SetCurrent(v.key, v.cur)
+	}
+	return nil
+}
+
+func (c *DeltaCodec) quantum(key Key) float64 {
+	if c.Quantum == nil {
+		return 0
+	}
+	return c.Quantum(key)
+}
+
+func appendDelta(dst []byte, v, step float64) []byte {
+	if step > 0 {
+		return binary.AppendVarint(dst, int64(math.Round(v/step)))
+	}
+	return binary.LittleEndian.AppendUint64(dst, math.Float64bits(v))
+}
+
+func (r *byteReader) delta(step float64) float64 {
+	if step > 0 {
+		return float64(r.varint()) * step
+	}
+	return r.float()
+}
@@ -0,0 +1,94 @@
+package attr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeltaCodec(t *testing.T) {
+	var server Table
+	set := &testSet{}
+	server.Put(set)
+	server.SetBase(testAttrHP, 80)
+	server.SetBase(testAttrAttack, 100)
+	server.AddModifier(Modifier{Source: 1, Attr: testAttrAttack, Op: ModMul, Value: 1.25})
+	server.Flush()
+
+	var client Map
+	client.Put(&testSet{})
+	codec := DeltaCodec{Base: true}
+	b := codec.Encode(nil, &server.Values)
+	require.Zero(t, set.Dirty())
+	require.NoError(t, codec.Decode(b, &client))
+	cur, _ := client.GetCurrent(testAttrAttack)
+	base, _ := client.GetBase(testAttrAttack)
+	require.Equal(t, 125.0, cur)
+	require.Equal(t, 100.0, base)
+
+	// nothing dirty encodes to a single byte and applies nothing
+	b = codec.Encode(b[:0], &server.Values)
+	require.Equal(t, []byte{0}, b)
+	require.NoError(t, codec.Decode(b, &client))
+
+	// only the dirty field is sent
+	server.SetBase(testAttrHP, 63.3)
+	server.Flush()
+	full := len(codec.Encode(nil, &server.Values))
+	server.SetBase(testAttrHP, 63.3)
+	codec.Base = false
+	b = codec.Encode(nil, &server.Values)
+	require.Equal(t, full-8, len(b))
+	require.NoError(t, codec.Decode(b, &client))
+	cur, _ = client.GetCurrent(testAttrHP)
+	require.Equal(t, 63.3, cur)
+
+	// quantized fields round to the step and fit in a varint
+	codec.Quantum = func(key Key) float64 {
+		if key == testAttrHP {
+			return 0.5
+		}
+		return 0
+	}
+	server.SetBase(testAttrHP, 41.2)
+	server.Flush()
+	b = codec.Encode(nil, &server.Values)
+	require.Len(t, b, 5)
+	require.NoError(t, codec.Decode(b, &client))
+	cur, _ = client.GetCurrent(testAttrHP)
+	require.Equal(t, 41.0, cur)
+
+	// sets the client does not know are skipped
+	var other Map
+	other.Put(&testSet{})
+	set.SetCurrent(testFieldAttack, 1)
+	b = codec.Encode(nil, &server.Values)
+	var empty Map
+	require.NoError(t, codec.Decode(b, &empty))
+	require.NoError(t, codec.Decode(b, &other))
+	cur, _ = other.GetCurrent(testAttrAttack)
+	require.Equal(t, 1.0, cur)
+}
+
+func TestDeltaCodecCorrupt(t *testing.T) {
+	var server Map
+	set := &testSet{}
+	server.Put(set)
+	set.SetBase(testFieldHP, 10)
+	set.SetCurrent(testFieldAttack, 20)
+	codec := DeltaCodec{Base: true}
+	b := codec.Encode(nil, &server)
+
+	var client Map
+	client.Put(&testSet{})
+	for n := range len(b) {
+		require.ErrorIs(t, codec.Decode(b[:n], &client), ErrDeltaCorrupt, n)
+	}
+	require.ErrorIs(t, codec.Decode(append(b, 0), &client), ErrDeltaCorrupt)
+	// a failed decode writes nothing
+	cur, _ := client.GetCurrent(testAttrAttack)
+	require.Zero(t, cur)
+	require.NoError(t, codec.Decode(b, &client))
+	cur, _ = client.GetCurrent(testAttrAttack)
+	require.Equal(t, 20.0, cur)
+}
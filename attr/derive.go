@@ -0,0 +1,193 @@
+package attr
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/legamerdc/game/lib"
+)
+
+var (
+	ErrDerivationCycle  = errors.New("attr: derivation cycle")
+	ErrDerivationBase   = errors.New("attr: target already has a base derivation")
+	ErrDerivationSource = errors.New("attr: modifier derivation needs its own non-zero source")
+)
+
+// Derivation declares an attribute computed from other attributes, such as
+// MaxHealth = Stamina*10 + Base. Fn reads the Current values of Deps from the
+// table; Deps must list every key Fn reads so that Flush can order the
+// recomputation and propagate changes. When Fn fails the target keeps its
+// previous value and the error is reported by DerivationErr.
+//
+// With Mod nil the result becomes Target's Base. Otherwise it feeds Target as a
+// modifier with Mod's Op, Channel and Priority, bound to Source; Mod.Attr and
+// Mod.Value are ignored. Source must be non-zero and must not be shared with
+// other derivations or modifiers, since every evaluation replaces the
+// modifiers bound to it.
+type Derivation struct {
+	Target Key
+	Deps   []Key
+	Fn     func(*Table) (float64, error)
+	Mod    *ModifierTemplate
+	Source uint64
+}
+
+// DerivationError is a failed evaluation of a derivation of Target.
+type DerivationError struct {
+	Target Key
+	Err    error
+}
+
+func (e *DerivationError) Error() string {
+	return fmt.Sprintf("attr: derivation of %d.%d: %v", KeySetID(e.Target), KeyField(e.Target), e.Err)
+}
+
+func (e *DerivationError) Unwrap() error { return e.Err }
+
+// derivGraph orders derived attributes. rank[k] is 0 for plain attributes and
+// one more than the highest rank among the deps of k otherwise, so processing
+// dirty keys by ascending rank evaluates every derivation after its inputs.
+type derivGraph struct {
+	byTarget   map[Key][]*Derivation
+	dependents map[Key][]Key
+	rank       map[Key]int32
+	queue      lib.HeapIndexMap[Key, int32, struct{}]
+	errs       []error // failed evaluations of the last flush
+}
+
+// AddDerivation registers d and marks its target dirty. It fails without
+// changing the table if d would close a cycle, add a second base derivation
+// to the same target, or reuse the Source of another modifier derivation.
+func (t *Table) AddDerivation(d Derivation) error {
+	t.Init()
+	g := t.derive
+	if g == nil {
+		g = &derivGraph{
+			byTarget:   make(map[Key][]*Derivation),
+			dependents: make(map[Key][]Key),
+			rank:       make(map[Key]int32),
+		}
+		g.queue.Reserve(0)
+	}
+	for _, dep := range d.Deps {
+		if dep == d.Target || g.reaches(d.Target, dep) {
+			return ErrDerivationCycle
+		}
+	}
+	if d.Mod == nil && slices.ContainsFunc(g.byTarget[d.Target], func(x *Derivation) bool { return x.Mod == nil }) {
+		return ErrDerivationBase
+	}
+	if d.Mod != nil && (d.Source == 0 || g.hasSource(d.Source)) {
+		return ErrDerivationSource
+	}
+	t.derive = g
+	g.byTarget[d.Target] = append(g.byTarget[d.Target], &d)
+	for _, dep := range d.Deps {
+		if !slices.Contains(g.dependents[dep], d.Target) {
+			g.dependents[dep] = append(g.dependents[dep], d.Target)
+		}
+		g.raise(d.Target, g.rank[dep]+1)
+	}
+	t.MarkDirty(d.Target)
+	return nil
+}
+
+// DerivationErr returns the errors of the derivations that failed during the
+// last flush or recompute, joined, or nil. Each is a *DerivationError.
+func (t *Table) DerivationErr() error {
+	if t.derive == nil {
+		return nil
+	}
+	return errors.Join(t.derive.errs...)
+}
+
+func (g *derivGraph) hasSource(source uint64) bool {
+	for _, ds := range g.byTarget {
+		for _, d := range ds {
+			if d.Mod != nil && d.Source == source {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// reaches reports whether to depends on from, directly or transitively.
+func (g *derivGraph) reaches(from, to Key) bool {
+	for _, next := range g.dependents[from] {
+		if next == to || g.reaches(next, to) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *derivGraph) raise(key Key, rank int32) {
+	if g.rank[key] >= rank {
+		return
+	}
+	g.rank[key] = rank
+	for _, next := range g.dependents[key] {
+		g.raise(next, rank+1)
+	}
+}
+
+// flush recomputes the queued and dirty keys by ascending rank. Evaluating a
+// derivation only writes its target, and a key whose Current changes queues
+// its dependents, which always have a higher rank. Keys that hooks mark dirty
+// during the flush are queued again once the queue drains.
+func (t *Table) flush(out *[]Change) int {
+	g := t.derive
+	g.errs = g.errs[:0]
+	changed := 0
+	for {
+		for key := range t.dirty {
+			g.queue.Push(key, struct{}{}, g.rank[key])
+		}
+		clear(t.dirty)
+		if g.queue.Size() == 0 {
+			return changed
+		}
+		for g.queue.Size() > 0 {
+			_, key, _, _ := g.queue.Top()
+			g.queue.Pop()
+			for _, d := range g.byTarget[key] {
+				t.apply(d)
+			}
+			// apply marks the target that is recomputed right below
+			delete(t.dirty, key)
+			if t.recompute(key, out) {
+				changed++
+				for _, next := range g.dependents[key] {
+					g.queue.Push(next, struct{}{}, g.rank[next])
+				}
+			}
+		}
+	}
+}
+
+func (t *Table) apply(d *Derivation) {
+	v, e := d.Fn(t)
+	if e != nil {
+		t.derive.errs = append(t.derive.errs, &DerivationError{Target: d.Target, Err: e})
+		return
+	}
+	if d.Mod == nil {
+		t.setBase(d.Target, v)
+		return
+	}
+	mod := d.Mod.Bind(d.Source)
+	mod.Attr, mod.Value = d.Target, v
+	if refs := t.bySource[d.Source]; len(refs) == 1 && refs[0].key == d.Target {
+		a := t.mods[d.Target]
+		if a.mods[refs[0].slot] == mod {
+			return
+		}
+		a.mods[refs[0].slot], a.off[refs[0].slot] = mod, !t.matches(mod)
+		a.chans[a.channel(mod.Channel)].stale = true
+		a.stale = true
+		return
+	}
+	t.UpdateModifiersBySource(d.Source, []Modifier{mod})
+}
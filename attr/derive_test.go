@@ -0,0 +1,207 @@
+package attr
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func field(f uint16) Key { return MakeKey(testSetID, f) }
+
+func current(t *testing.T, attrs *Table, key Key) float64 {
+	t.Helper()
+	cur, ok := attrs.GetCurrent(key)
+	require.True(t, ok)
+	return cur
+}
+
+func TestTableDerivations(t *testing.T) {
+	var attrs Table
+	attrs.Put(&benchSet{})
+	stamina, maxHP, regen, armor := field(0), field(1), field(2), field(3)
+	attrs.SetBase(stamina, 10)
+	attrs.SetBase(armor, 5)
+
+	var evals []Key
+	derive := func(target Key, fn func(*Table) float64) func(*Table) (float64, error) {
+		return func(t *Table) (float64, error) {
+			evals = append(evals, target)
+			return fn(t), nil
+		}
+	}
+	// registered out of order: regen depends on maxHP, which depends on stamina
+	require.NoError(t, attrs.AddDerivation(Derivation{
+		Target: regen,
+		Deps:   []Key{maxHP},
+		Fn:     derive(regen, func(t *Table) float64 { v, _ := t.GetCurrent(maxHP); return v / 100 }),
+	}))
+	require.NoError(t, attrs.AddDerivation(Derivation{
+		Target: maxHP,
+		Deps:   []Key{stamina},
+		Fn:     derive(maxHP, func(t *Table) float64 { v, _ := t.GetCurrent(stamina); return v * 10 }),
+	}))
+	// a modifier derivation stacks with other modifiers on the target
+	require.NoError(t, attrs.AddDerivation(Derivation{
+		Target: maxHP,
+		Deps:   []Key{armor},
+		Fn:     derive(maxHP, func(t *Table) float64 { v, _ := t.GetCurrent(armor); return v * 2 }),
+		Mod:    &ModifierTemplate{Op: ModAdd},
+		Source: 7,
+	}))
+	attrs.Flush()
+	require.Equal(t, 110.0, current(t, &attrs, maxHP))
+	require.Equal(t, 1.1, current(t, &attrs, regen))
+	require.Equal(t, []Key{maxHP, maxHP, regen}, evals)
+
+	// a change propagates through every dependent, each evaluated once
+	evals = nil
+	attrs.AddModifier(Modifier{Source: 1, Attr: stamina, Op: ModMul, Value: 2})
+	require.Equal(t, 3, attrs.Flush())
+	require.Equal(t, 210.0, current(t, &attrs, maxHP))
+	require.Equal(t, 2.1, current(t, &attrs, regen))
+	require.Equal(t, []Key{maxHP, maxHP, regen}, evals)
+
+	attrs.SetBase(armor, 10)
+	require.Equal(t, 3, attrs.Flush())
+	require.Equal(t, 220.0, current(t, &attrs, maxHP))
+	require.Equal(t, []Modifier{{Source: 7, Attr: maxHP, Op: ModAdd, Value: 20}}, attrs.Modifiers(maxHP, nil))
+	checkIndex(t, &attrs)
+
+	// an unchanged input stops the propagation
+	evals = nil
+	attrs.MarkDirty(stamina)
+	require.Zero(t, attrs.Flush())
+	require.Empty(t, evals)
+
+	// a dirty target re-evaluates its derivations
+	attrs.MarkDirty(regen)
+	attrs.Flush()
+	require.Equal(t, []Key{regen}, evals)
+
+	attrs.SetBase(stamina, 1)
+	attrs.RemoveModifiersBySource(1)
+	require.Equal(t, 3, attrs.RecomputeAll())
+	require.Equal(t, 30.0, current(t, &attrs, maxHP))
+	require.Equal(t, 0.3, current(t, &attrs, regen))
+}
+
+func TestTableDerivationErrors(t *testing.T) {
+	var attrs Table
+	attrs.Put(&benchSet{})
+	a, b, c := field(0), field(1), field(2)
+	constant := func(*Table) (float64, error) { return 1, nil }
+	require.NoError(t, attrs.AddDerivation(Derivation{Target: b, Deps: []Key{a}, Fn: constant}))
+	require.NoError(t, attrs.AddDerivation(Derivation{Target: c, Deps: []Key{b}, Fn: constant}))
+
+	require.ErrorIs(t, attrs.AddDerivation(Derivation{Target: a, Deps: []Key{a}, Fn: constant}), ErrDerivationCycle)
+	require.ErrorIs(t, attrs.AddDerivation(Derivation{Target: a, Deps: []Key{c}, Fn: constant}), ErrDerivationCycle)
+	require.ErrorIs(t, attrs.AddDerivation(Derivation{
+		Target: a, Deps: []Key{c}, Fn: constant, Mod: &ModifierTemplate{Op: ModAdd}, Source: 1,
+	}), ErrDerivationCycle)
+	require.ErrorIs(t, attrs.AddDerivation(Derivation{Target: c, Deps: []Key{a}, Fn: constant}), ErrDerivationBase)
+
+	// modifier derivations each own a non-zero source
+	mod := &ModifierTemplate{Op: ModAdd}
+	require.ErrorIs(t, attrs.AddDerivation(Derivation{Target: c, Deps: []Key{a}, Fn: constant, Mod: mod}), ErrDerivationSource)
+	require.NoError(t, attrs.AddDerivation(Derivation{Target: c, Deps: []Key{a}, Fn: constant, Mod: mod, Source: 5}))
+	require.ErrorIs(t, attrs.AddDerivation(Derivation{Target: b, Deps: []Key{a}, Fn: constant, Mod: mod, Source: 5}), ErrDerivationSource)
+	require.Len(t, attrs.derive.byTarget[b], 1)
+
+	// rejected derivations leave the graph untouched
+	attrs.Flush()
+	require.Equal(t, int32(2), attrs.derive.rank[c])
+	require.Empty(t, attrs.derive.byTarget[a])
+	require.NoError(t, attrs.AddDerivation(Derivation{Target: field(3), Deps: []Key{c, a}, Fn: constant}))
+	require.Equal(t, int32(3), attrs.derive.rank[field(3)])
+}
+
+func TestTableDerivationEvalError(t *testing.T) {
+	var attrs Table
+	attrs.Put(&benchSet{})
+	stamina, maxHP := field(0), field(1)
+	errBroken := errors.New("broken")
+	var broken bool
+	require.NoError(t, attrs.AddDerivation(Derivation{
+		Target: maxHP,
+		Deps:   []Key{stamina},
+		Fn: func(t *Table) (float64, error) {
+			if broken {
+				return 0, errBroken
+			}
+			v, _ := t.GetCurrent(stamina)
+			return v * 10, nil
+		},
+	}))
+	attrs.SetBase(stamina, 3)
+	attrs.Flush()
+	require.NoError(t, attrs.DerivationErr())
+	require.Equal(t, 30.0, current(t, &attrs, maxHP))
+
+	// a failed evaluation keeps the previous value and is reported
+	broken = true
+	attrs.SetBase(stamina, 5)
+	attrs.Flush()
+	require.Equal(t, 30.0, current(t, &attrs, maxHP))
+	err := attrs.DerivationErr()
+	require.ErrorIs(t, err, errBroken)
+	var de *DerivationError
+	require.ErrorAs(t, err, &de)
+	require.Equal(t, maxHP, de.Target)
+
+	// errors only describe the last flush
+	broken = false
+	attrs.MarkDirty(stamina)
+	attrs.MarkDirty(maxHP)
+	attrs.Flush()
+	require.NoError(t, attrs.DerivationErr())
+	require.Equal(t, 50.0, current(t, &attrs, maxHP))
+}
+
+// postSet calls post from PostCurrentChange, like a set whose hook writes
+// other attributes.
+type postSet struct {
+	benchSet
+	post func(field uint16, next float64)
+}
+
+func (s *postSet) PreBaseChange(_ uint16, next float64) float64    { return next }
+func (s *postSet) PreCurrentChange(_ uint16, next float64) float64 { return next }
+func (s *postSet) PostCurrentChange(field uint16, _, next float64) { s.post(field, next) }
+
+func TestTableFlushHookWrites(t *testing.T) {
+	hp, maxHP, shield, stamina := field(0), field(1), field(2), field(3)
+	for _, derived := range []bool{false, true} {
+		var attrs Table
+		set := &postSet{}
+		attrs.Put(set)
+		if derived {
+			require.NoError(t, attrs.AddDerivation(Derivation{
+				Target: maxHP,
+				Deps:   []Key{stamina},
+				Fn:     func(t *Table) (float64, error) { v, _ := t.GetCurrent(stamina); return v * 10, nil },
+			}))
+		}
+		// the hook mirrors half of every hp change into the shield base
+		set.post = func(field uint16, next float64) {
+			if field == KeyField(hp) {
+				attrs.SetBase(shield, next/2)
+			}
+		}
+		attrs.SetBase(stamina, 3)
+		attrs.SetBase(hp, 40)
+		changes := attrs.FlushInto(nil)
+		require.Equal(t, 20.0, current(t, &attrs, shield), derived)
+		require.Contains(t, changes, Change{Key: shield, Kind: ChangeBase, Old: 0, New: 20}, derived)
+		require.Empty(t, attrs.dirty, derived)
+
+		attrs.SetBase(hp, 60)
+		require.Equal(t, 2, attrs.Flush(), derived)
+		require.Equal(t, 30.0, current(t, &attrs, shield), derived)
+
+		attrs.SetBase(hp, 10)
+		attrs.RecomputeAll()
+		require.Equal(t, 5.0, current(t, &attrs, shield), derived)
+		require.Empty(t, attrs.dirty, derived)
+	}
+}
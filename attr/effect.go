@@ -0,0 +1,257 @@
+package attr
+
+import "github.com/legamerdc/game/lib"
+
+// EffectSourceBit is set on every ActiveEffect handle. Handles double as
+// Modifier.Source, so caller-owned sources below 1<<63 never collide with
+// effect modifiers in the same Table.
+const EffectSourceBit uint64 = 1 << 63
+
+// Stacking decides what happens when an effect template is granted while an
+// instance of the same template is already active.
+type Stacking uint8
+
+const (
+	// StackIndependent creates a new instance with its own duration on every
+	// grant.
+	StackIndependent Stacking = iota
+	// StackRefresh keeps a single instance and restarts its duration.
+	StackRefresh
+	// StackCount keeps a single instance, adds one stack up to MaxStacks and
+	// restarts its duration. Modifier values scale with the stack count: Add
+	// contributes Value*n, Mul and Div contribute 1+(Value-1)*n, which matches
+	// n separate modifiers under PolicyBiasSum, the default. Under the other
+	// policies the stacks aggregate as one scaled modifier: with PolicyProduct
+	// three stacks of a 1.2 multiplier give 1.6, not 1.2^3. Override is not
+	// scaled.
+	StackCount
+)
+
+// EffectTemplate is the static description of an active effect, usually
+// loaded from config. Durations and periods are in scheduler ticks.
+type EffectTemplate struct {
+	ID        uint32
+	Modifiers []ModifierTemplate
+	// Duration <= 0 means the effect lasts until it is removed explicitly.
+	Duration int64
+	// Period > 0 reports a periodic event every Period ticks after the grant,
+	// for damage or healing over time. A period that falls on the expiry tick
+	// is reported before the effect expires.
+	Period    int64
+	Stacking  Stacking
+	MaxStacks int32 // StackCount only, <= 0 means unlimited
+}
+
+// ActiveEffect is a granted instance of an EffectTemplate.
+type ActiveEffect struct {
+	Handle   uint64
+	Template *EffectTemplate
+	Stacks   int32
+	Start    int64
+	Expire   int64 // 0 means the effect never expires
+
+	nextPeriod int64 // 0 means no pending period
+}
+
+// deadline returns the next tick at which the effect needs attention.
+func (e *ActiveEffect) deadline() (int64, bool) {
+	switch {
+	case e.nextPeriod == 0:
+		return e.Expire, e.Expire != 0
+	case e.Expire == 0:
+		return e.nextPeriod, true
+	}
+	return min(e.nextPeriod, e.Expire), true
+}
+
+// ActiveEffects is the duration layer on top of Table described in §5 of
+// docs/design/ability_system.md. It grants effects from templates, binds their
+// modifiers into Table with the effect handle as Source, and expires them from
+// a deadline heap. It only edits modifiers; the owner still calls Table.Flush.
+//
+// Time is whatever tick counter the owner uses. A scheduler Logic typically
+// calls Tick(now, ...) at the start of Think and returns NextDelay(now).
+// Call Init with the Table before use.
+type ActiveEffects struct {
+	table      *Table
+	effects    map[uint64]*ActiveEffect
+	single     map[uint32]uint64 // template id -> handle for refresh/count stacking
+	heap       lib.HeapIndexMap[uint64, int64, *ActiveEffect]
+	nextHandle uint64
+}
+
+func (a *ActiveEffects) Init(t *Table) {
+	a.table = t
+	if a.effects == nil {
+		a.effects = make(map[uint64]*ActiveEffect)
+		a.single = make(map[uint32]uint64)
+		a.heap.Reserve(0)
+	}
+}
+
+func (a *ActiveEffects) Len() int { return len(a.effects) }
+
+func (a *ActiveEffects) Get(handle uint64) *ActiveEffect { return a.effects[handle] }
+
+// Find returns the single instance of a refresh or count stacking template.
+func (a *ActiveEffects) Find(id uint32) *ActiveEffect {
+	if h, ok := a.single[id]; ok {
+		return a.effects[h]
+	}
+	return nil
+}
+
+// Grant applies tpl at tick now and returns the new or stacked instance.
+func (a *ActiveEffects) Grant(tpl *EffectTemplate, now int64) *ActiveEffect {
+	if tpl.Stacking != StackIndependent {
+		if e := a.Find(tpl.ID); e != nil {
+			a.stack(e, now)
+			return e
+		}
+	}
+	a.nextHandle++
+	e := &ActiveEffect{
+		Handle:   EffectSourceBit | a.nextHandle,
+		Template: tpl,
+		Stacks:   1,
+		Start:    now,
+	}
+	if tpl.Duration > 0 {
+		e.Expire = now + tpl.Duration
+	}
+	if tpl.Period > 0 {
+		e.nextPeriod = now + tpl.Period
+	}
+	a.effects[e.Handle] = e
+	if tpl.Stacking != StackIndependent {
+		a.single[tpl.ID] = e.Handle
+	}
+	a.table.AddModifiers(e.modifiers())
+	a.schedule(e)
+	return e
+}
+
+func (a *ActiveEffects) stack(e *ActiveEffect, now int64) {
+	tpl := e.Template
+	if tpl.Stacking == StackCount && (tpl.MaxStacks <= 0 || e.Stacks < tpl.MaxStacks) {
+		e.Stacks++
+		a.table.UpdateModifiersBySource(e.Handle, e.modifiers())
+	}
+	if tpl.Duration > 0 {
+		e.Expire = now + tpl.Duration
+	}
+	if tpl.Period > 0 && e.nextPeriod == 0 {
+		// periods stopped at the old expiry; resume on the original cadence
+		e.nextPeriod = e.Start + ((now-e.Start)/tpl.Period+1)*tpl.Period
+	}
+	a.schedule(e)
+}
+
+// modifiers binds the template modifiers, scaled by the stack count.
+func (e *ActiveEffect) modifiers() []Modifier {
+	mods := make([]Modifier, len(e.Template.Modifiers))
+	n := float64(e.Stacks)
+	for i, t := range e.Template.Modifiers {
+		mod := t.Bind(e.Handle)
+		switch mod.Op {
+		case ModAdd:
+			mod.Value *= n
+		case ModMul, ModDiv:
+			mod.Value = 1 + (mod.Value-1)*n
+		}
+		mods[i] = mod
+	}
+	return mods
+}
+
+// schedule puts e in the deadline heap, or takes it out when it has none.
+func (a *ActiveEffects) schedule(e *ActiveEffect) {
+	if at, ok := a.deadline(e); ok {
+		a.heap.Push(e.Handle, e, at)
+		return
+	}
+	if i, _ := a.heap.Get(e.Handle); i >= 0 {
+		a.heap.Remove(i)
+	}
+}
+
+func (a *ActiveEffects) deadline(e *ActiveEffect) (int64, bool) {
+	if e.nextPeriod != 0 && e.Expire != 0 && e.nextPeriod > e.Expire {
+		e.nextPeriod = 0
+	}
+	return e.deadline()
+}
+
+// Remove ends an effect early, e.g. on dispel, and removes its modifiers.
+func (a *ActiveEffects) Remove(handle uint64) bool {
+	e, ok := a.effects[handle]
+	if !ok {
+		return false
+	}
+	delete(a.effects, handle)
+	if h, ok := a.single[e.Template.ID]; ok && h == handle {
+		delete(a.single, e.Template.ID)
+	}
+	if i, _ := a.heap.Get(handle); i >= 0 {
+		a.heap.Remove(i)
+	}
+	a.table.RemoveModifiersBySource(handle)
+	return true
+}
+
+// RemoveTemplate removes every instance of template id and returns the count.
+func (a *ActiveEffects) RemoveTemplate(id uint32) int {
+	var handles []uint64
+	for h, e := range a.effects {
+		if e.Template.ID == id {
+			handles = append(handles, h)
+		}
+	}
+	for _, h := range handles {
+		a.Remove(h)
+	}
+	return len(handles)
+}
+
+// Tick processes every deadline <= now in deadline order: due periods call
+// onPeriod (which may be nil and may remove effects), expired effects are
+// removed. It returns the number of expired effects.
+func (a *ActiveEffects) Tick(now int64, onPeriod func(*ActiveEffect)) int {
+	expired := 0
+	for a.heap.Size() > 0 {
+		_, h, e, at := a.heap.Top()
+		if at > now {
+			break
+		}
+		if e.nextPeriod == at {
+			e.nextPeriod += e.Template.Period
+			a.schedule(e)
+			if onPeriod != nil {
+				onPeriod(e)
+			}
+			continue
+		}
+		a.Remove(h)
+		expired++
+	}
+	return expired
+}
+
+// NextDeadline returns the earliest pending period or expiry tick.
+func (a *ActiveEffects) NextDeadline() (int64, bool) {
+	if a.heap.Size() == 0 {
+		return 0, false
+	}
+	_, _, _, at := a.heap.Top()
+	return at, true
+}
+
+// NextDelay returns the ticks from now until the next deadline, at least 1,
+// or 0 when nothing is pending. It can be returned from Logic.Think as is.
+func (a *ActiveEffects) NextDelay(now int64) int64 {
+	at, ok := a.NextDeadline()
+	if !ok {
+		return 0
+	}
+	return max(at-now, 1)
+}
@@ -0,0 +1,154 @@
+package attr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEffects(t *testing.T) (*Table, *ActiveEffects) {
+	t.Helper()
+	var attrs Table
+	attrs.Init()
+	attrs.Put(&testSet{})
+	require.True(t, attrs.SetBase(testAttrAttack, 100))
+	attrs.Flush()
+	var effects ActiveEffects
+	effects.Init(&attrs)
+	return &attrs, &effects
+}
+
+func attack(t *testing.T, attrs *Table) float64 {
+	t.Helper()
+	attrs.Flush()
+	cur, ok := attrs.GetCurrent(testAttrAttack)
+	require.True(t, ok)
+	return cur
+}
+
+func TestActiveEffectsExpire(t *testing.T) {
+	attrs, effects := newTestEffects(t)
+	buff := &EffectTemplate{
+		ID:        1,
+		Modifiers: []ModifierTemplate{{Attr: testAttrAttack, Op: ModAdd, Value: 10}},
+		Duration:  5,
+	}
+	a := effects.Grant(buff, 0)
+	b := effects.Grant(buff, 2)
+	require.NotEqual(t, a.Handle, b.Handle)
+	require.NotZero(t, a.Handle&EffectSourceBit)
+	require.Equal(t, 120.0, attack(t, attrs))
+	require.Equal(t, int64(5), effects.NextDelay(0))
+
+	require.Equal(t, 0, effects.Tick(4, nil))
+	require.Equal(t, 1, effects.Tick(5, nil))
+	require.Nil(t, effects.Get(a.Handle))
+	require.Equal(t, 110.0, attack(t, attrs))
+	require.Equal(t, int64(2), effects.NextDelay(5))
+	require.Equal(t, int64(1), effects.NextDelay(9))
+
+	require.Equal(t, 1, effects.Tick(7, nil))
+	require.Equal(t, 0, effects.Len())
+	require.Equal(t, 100.0, attack(t, attrs))
+	require.Equal(t, int64(0), effects.NextDelay(7))
+
+	// infinite effects never enter the heap and must be removed explicitly
+	aura := effects.Grant(&EffectTemplate{ID: 2, Modifiers: buff.Modifiers}, 7)
+	_, ok := effects.NextDeadline()
+	require.False(t, ok)
+	require.Equal(t, 110.0, attack(t, attrs))
+	require.True(t, effects.Remove(aura.Handle))
+	require.False(t, effects.Remove(aura.Handle))
+	require.Equal(t, 100.0, attack(t, attrs))
+}
+
+func TestActiveEffectsStacking(t *testing.T) {
+	attrs, effects := newTestEffects(t)
+	rage := &EffectTemplate{
+		ID: 1,
+		Modifiers: []ModifierTemplate{
+			{Attr: testAttrAttack, Op: ModAdd, Value: 10},
+			{Attr: testAttrAttack, Op: ModMul, Value: 1.1},
+		},
+		Duration:  10,
+		Stacking:  StackCount,
+		MaxStacks: 3,
+	}
+	e := effects.Grant(rage, 0)
+	require.InEpsilon(t, 121, attack(t, attrs), 1e-9)
+	for now := int64(1); now <= 4; now++ {
+		require.Same(t, e, effects.Grant(rage, now))
+	}
+	require.Equal(t, int32(3), e.Stacks)
+	require.Equal(t, int64(14), e.Expire)
+	// three stacks aggregate like three separate modifiers
+	require.InEpsilon(t, Eval(100, []Modifier{
+		{Op: ModAdd, Value: 10}, {Op: ModAdd, Value: 10}, {Op: ModAdd, Value: 10},
+		{Op: ModMul, Value: 1.1}, {Op: ModMul, Value: 1.1}, {Op: ModMul, Value: 1.1},
+	}), attack(t, attrs), 1e-9)
+	require.Equal(t, 1, effects.Tick(14, nil))
+	require.Nil(t, effects.Find(1))
+	require.Equal(t, 100.0, attack(t, attrs))
+
+	shield := &EffectTemplate{
+		ID:        2,
+		Modifiers: []ModifierTemplate{{Attr: testAttrAttack, Op: ModAdd, Value: 5}},
+		Duration:  10,
+		Stacking:  StackRefresh,
+	}
+	s := effects.Grant(shield, 0)
+	require.Same(t, s, effects.Grant(shield, 8))
+	require.Equal(t, int32(1), s.Stacks)
+	require.Equal(t, 105.0, attack(t, attrs))
+	require.Equal(t, 0, effects.Tick(10, nil))
+	require.Equal(t, 1, effects.Tick(18, nil))
+	require.Equal(t, 0, effects.Len())
+
+	independent := &EffectTemplate{ID: 3, Modifiers: shield.Modifiers, Duration: 10}
+	effects.Grant(independent, 20)
+	effects.Grant(independent, 20)
+	require.Equal(t, 110.0, attack(t, attrs))
+	require.Equal(t, 2, effects.RemoveTemplate(3))
+	require.Equal(t, 100.0, attack(t, attrs))
+	_, ok := effects.NextDeadline()
+	require.False(t, ok)
+}
+
+func TestActiveEffectsPeriod(t *testing.T) {
+	_, effects := newTestEffects(t)
+	dot := &EffectTemplate{ID: 1, Duration: 5, Period: 1, Stacking: StackRefresh}
+	var ticks []int64
+	now := int64(0)
+	record := func(*ActiveEffect) { ticks = append(ticks, now) }
+	e := effects.Grant(dot, now)
+	for now = 1; now <= 3; now++ {
+		effects.Tick(now, record)
+		require.Equal(t, int64(1), effects.NextDelay(now))
+	}
+	// a late tick reports every missed period, then the expiry
+	now = 6
+	require.Equal(t, 1, effects.Tick(now, record))
+	require.Equal(t, []int64{1, 2, 3, 6, 6}, ticks)
+	require.Nil(t, effects.Get(e.Handle))
+
+	// onPeriod may remove the effect
+	ticks = nil
+	effects.Grant(dot, 10)
+	now = 12
+	effects.Tick(now, func(x *ActiveEffect) {
+		ticks = append(ticks, now)
+		effects.Remove(x.Handle)
+	})
+	require.Equal(t, []int64{12}, ticks)
+	require.Equal(t, 0, effects.Len())
+
+	// refreshing resumes periods on the original cadence
+	e = effects.Grant(&EffectTemplate{ID: 2, Duration: 3, Period: 2, Stacking: StackRefresh}, 20)
+	effects.Tick(22, nil)
+	at, _ := effects.NextDeadline()
+	require.Equal(t, int64(23), at)
+	effects.Grant(e.Template, 22)
+	at, _ = effects.NextDeadline()
+	require.Equal(t, int64(24), at)
+	require.Equal(t, int64(25), e.Expire)
+}
@@ -1,6 +1,11 @@
 package attr
 
-import "slices"
+import (
+	"cmp"
+	"slices"
+
+	"github.com/legamerdc/game/tag"
+)
 
 // ModOp describes how a Modifier contributes to an attribute channel.
 type ModOp uint8
@@ -18,13 +23,19 @@ const (
 // Modifier is a pure attribute-aggregation contribution. Source is an opaque
 // stable id owned by the caller, commonly an active effect handle in a game
 // layer, but attr does not interpret it.
+//
+// Require gates the modifier on the tags of the Table's owner, as in "+20%
+// damage while state.berserk". A nil Require always applies; otherwise the
+// modifier only takes part in aggregation while the tags set with
+// Table.SetTags match it.
 type Modifier struct {
-	Source   uint64
-	Attr     Key
-	Op       ModOp
-	Channel  uint8
-	Priority int16
-	Value    float64
+	Source   uint64     `json:"source"`
+	Attr     Key        `json:"attr"`
+	Op       ModOp      `json:"op"`
+	Channel  uint8      `json:"channel,omitempty"`
+	Priority int16      `json:"priority,omitempty"`
+	Value    float64    `json:"value"`
+	Require  *tag.Query `json:"-"`
 }
 
 type ModifierTemplate struct {
@@ -33,6 +44,7 @@ type ModifierTemplate struct {
 	Channel  uint8
 	Priority int16
 	Value    float64
+	Require  *tag.Query
 }
 
 func (t ModifierTemplate) Bind(source uint64) Modifier {
@@ -43,24 +55,76 @@ func (t ModifierTemplate) Bind(source uint64) Modifier {
 		Channel:  t.Channel,
 		Priority: t.Priority,
 		Value:    t.Value,
+		Require:  t.Require,
 	}
 }
 
 // Table owns attribute values plus their active modifier lists.
+//
+// Modifiers are stored in a dense slice per attribute and indexed by Source, so
+// removing or updating a source touches only the attributes it modifies. The
+// order of modifiers within an attribute is unspecified: removal moves the last
+// modifier into the freed slot.
+//
+// Derived attributes registered with AddDerivation are evaluated during Flush
+// in dependency order; see Derivation.
 type Table struct {
 	Values Map
 
-	mods  map[Key][]Modifier
-	dirty map[Key]struct{}
+	mods     map[Key]*attrMods
+	bySource map[uint64][]modRef
+	dirty    map[Key]struct{}
+	derive   *derivGraph
+	tags     *tag.Tag
+	policy   *Policies
+	bases    map[Key]float64 // base before its first change since the last flush
+}
+
+// attrMods holds the modifiers of one attribute. back[i] is the position of
+// mods[i] in bySource[mods[i].Source]. off[i] is set while mods[i] is gated
+// out by its Require query, and gated counts the modifiers with one.
+//
+// chans caches the per-channel aggregates in ascending channel order, so a
+// recompute folds channels instead of re-aggregating every modifier. Adding a
+// modifier folds it in directly, which accumulates in the same order as Eval
+// over mods. Removal reorders mods and float sums cannot be undone exactly,
+// so the affected channels are marked stale and rebuilt from mods on the next
+// recompute. The result is always bit-identical to Eval(base, mods).
+type attrMods struct {
+	mods  []Modifier
+	back  []int32
+	off   []bool
+	gated int32
+	chans []chanAgg
+	stale bool
+}
+
+type chanAgg struct {
+	ch    uint8
+	n     int32 // modifiers in this channel, including gated out ones
+	stale bool
+	channelMods
+}
+
+// modRef locates one modifier of a source.
+type modRef struct {
+	key  Key
+	slot int32
 }
 
 func (t *Table) Init() {
 	if t.mods == nil {
-		t.mods = make(map[Key][]Modifier)
+		t.mods = make(map[Key]*attrMods)
+	}
+	if t.bySource == nil {
+		t.bySource = make(map[uint64][]modRef)
 	}
 	if t.dirty == nil {
 		t.dirty = make(map[Key]struct{})
 	}
+	if t.bases == nil {
+		t.bases = make(map[Key]float64)
+	}
 }
 
 func (t *Table) Put(set AttributeSet) { t.Values.Put(set) }
@@ -72,13 +136,32 @@ func (t *Table) GetBase(key Key) (float64, bool) { return t.Values.GetBase(key)
 func (t *Table) GetCurrent(key Key) (float64, bool) { return t.Values.GetCurrent(key) }
 
 func (t *Table) SetBase(key Key, value float64) bool {
-	if !t.Values.SetBase(key, value) {
+	if !t.setBase(key, value) {
 		return false
 	}
 	t.MarkDirty(key)
 	return true
 }
 
+// setBase writes the base and remembers the value it replaced for FlushInto.
+func (t *Table) setBase(key Key, value float64) bool {
+	t.Init()
+	old, _ := t.Values.GetBase(key)
+	if !t.Values.SetBase(key, value) {
+		return false
+	}
+	t.keepBase(key, old)
+	return true
+}
+
+// keepBase remembers the base key had before its first write since the last
+// flush.
+func (t *Table) keepBase(key Key, old float64) {
+	if _, ok := t.bases[key]; !ok {
+		t.bases[key] = old
+	}
+}
+
 func (t *Table) ModifyBase(key Key, delta float64) bool {
 	base, ok := t.GetBase(key)
 	if !ok {
@@ -89,7 +172,21 @@ func (t *Table) ModifyBase(key Key, delta float64) bool {
 
 func (t *Table) AddModifier(mod Modifier) {
 	t.Init()
-	t.mods[mod.Attr] = append(t.mods[mod.Attr], mod)
+	a := t.mods[mod.Attr]
+	if a == nil {
+		a = &attrMods{}
+		t.mods[mod.Attr] = a
+	}
+	refs := t.bySource[mod.Source]
+	off := !t.matches(mod)
+	a.mods = append(a.mods, mod)
+	a.back = append(a.back, int32(len(refs)))
+	a.off = append(a.off, off)
+	if mod.Require != nil {
+		a.gated++
+	}
+	a.aggregate(mod, off, t.policies())
+	t.bySource[mod.Source] = append(refs, modRef{key: mod.Attr, slot: int32(len(a.mods) - 1)})
 	t.MarkDirty(mod.Attr)
 }
 
@@ -109,34 +206,103 @@ func (t *Table) UpdateModifiersBySource(source uint64, mods []Modifier) {
 
 func (t *Table) RemoveModifiersBySource(source uint64) int {
 	t.Init()
-	removed := 0
-	for key, mods := range t.mods {
-		n := 0
-		for _, mod := range mods {
-			if mod.Source == source {
-				removed++
-				continue
+	refs, ok := t.bySource[source]
+	if !ok {
+		return 0
+	}
+	// refs may be rewritten by removeSlot when another modifier of the same
+	// source is moved, so read each entry only when it is reached
+	for j := range refs {
+		r := refs[j]
+		t.removeSlot(r.key, r.slot)
+		t.MarkDirty(r.key)
+	}
+	delete(t.bySource, source)
+	return len(refs)
+}
+
+// removeSlot removes mods[slot] of key by moving the last modifier into it.
+func (t *Table) removeSlot(key Key, slot int32) {
+	a := t.mods[key]
+	c := &a.chans[a.channel(a.mods[slot].Channel)]
+	c.n--
+	if a.mods[slot].Require != nil {
+		a.gated--
+	}
+	c.stale, a.stale = true, true
+	last := int32(len(a.mods) - 1)
+	if slot != last {
+		// moving a modifier changes the accumulation order of its channel too
+		moved := a.mods[last]
+		a.chans[a.channel(moved.Channel)].stale = true
+		a.mods[slot], a.back[slot], a.off[slot] = moved, a.back[last], a.off[last]
+		t.bySource[moved.Source][a.back[slot]].slot = slot
+	}
+	a.mods[last] = Modifier{}
+	a.mods, a.back, a.off = a.mods[:last], a.back[:last], a.off[:last]
+}
+
+func (t *Table) Modifiers(key Key, dst []Modifier) []Modifier {
+	t.Init()
+	if a := t.mods[key]; a != nil {
+		dst = append(dst, a.mods...)
+	}
+	return dst
+}
+
+// ActiveModifiers is Modifiers without the modifiers gated out by their
+// Require query. The current value of key is Eval over these.
+func (t *Table) ActiveModifiers(key Key, dst []Modifier) []Modifier {
+	t.Init()
+	if a := t.mods[key]; a != nil {
+		for i, mod := range a.mods {
+			if !a.off[i] {
+				dst = append(dst, mod)
 			}
-			mods[n] = mod
-			n++
 		}
-		if n != len(mods) {
-			clear(mods[n:])
-			if n == 0 {
-				delete(t.mods, key)
-			} else {
-				t.mods[key] = mods[:n]
+	}
+	return dst
+}
+
+// SetTags sets the tag set that gated modifiers are matched against and
+// re-evaluates them. nil matches like an empty tag set. The Table keeps the
+// pointer, so after changing the tags in place call TagsChanged.
+func (t *Table) SetTags(tags *tag.Tag) {
+	t.tags = tags
+	t.TagsChanged()
+}
+
+// TagsChanged re-evaluates every gated modifier against the current tags and
+// marks the attributes whose active modifiers changed dirty.
+func (t *Table) TagsChanged() {
+	t.Init()
+	for key, a := range t.mods {
+		if a.gated == 0 {
+			continue
+		}
+		for i, mod := range a.mods {
+			if mod.Require == nil {
+				continue
+			}
+			if off := !t.matches(mod); off != a.off[i] {
+				a.off[i] = off
+				a.chans[a.channel(mod.Channel)].stale = true
+				a.stale = true
+				t.MarkDirty(key)
 			}
-			t.MarkDirty(key)
 		}
 	}
-	return removed
 }
 
-func (t *Table) Modifiers(key Key, dst []Modifier) []Modifier {
-	t.Init()
-	dst = append(dst, t.mods[key]...)
-	return dst
+func (t *Table) matches(mod Modifier) bool {
+	switch {
+	case mod.Require == nil:
+		return true
+	case t.tags == nil:
+		var none tag.Tag
+		return none.Match(*mod.Require)
+	}
+	return t.tags.Match(*mod.Require)
 }
 
 func (t *Table) MarkDirty(key Key) {
@@ -144,44 +310,71 @@ func (t *Table) MarkDirty(key Key) {
 	t.dirty[key] = struct{}{}
 }
 
-func (t *Table) Flush() int {
+// Flush recomputes the dirty attributes and returns how many Current values
+// changed.
+func (t *Table) Flush() int { return t.flushDirty(nil) }
+
+// RecomputeAll recomputes every attribute and returns how many Current values
+// changed.
+func (t *Table) RecomputeAll() int { return t.recomputeAll(nil) }
+
+func (t *Table) flushDirty(out *[]Change) int {
 	t.Init()
+	defer clear(t.bases)
+	if t.derive != nil {
+		return t.flush(out)
+	}
 	changed := 0
-	for key := range t.dirty {
-		if t.recompute(key) {
-			changed++
+	// hooks may mark more keys dirty while the loop runs
+	for len(t.dirty) > 0 {
+		for key := range t.dirty {
+			delete(t.dirty, key)
+			if t.recompute(key, out) {
+				changed++
+			}
 		}
-		delete(t.dirty, key)
 	}
 	return changed
 }
 
-func (t *Table) RecomputeAll() int {
+func (t *Table) recomputeAll(out *[]Change) int {
 	t.Init()
+	defer clear(t.bases)
+	// every key is recomputed below; keys that hooks mark dirty meanwhile are
+	// flushed afterwards
+	clear(t.dirty)
 	changed := 0
 	t.Values.sets.Iter(func(_ uint32, set AttributeSet) bool {
 		setID := set.SetID()
 		for field := uint16(0); field < set.FieldCount(); field++ {
-			if t.recompute(MakeKey(setID, field)) {
+			key := MakeKey(setID, field)
+			if g := t.derive; g != nil {
+				g.queue.Push(key, struct{}{}, g.rank[key])
+			} else if t.recompute(key, out) {
 				changed++
 			}
 		}
 		return false
 	})
-	clear(t.dirty)
-	return changed
+	if t.derive != nil {
+		return t.flush(out)
+	}
+	return changed + t.flushDirty(out)
 }
 
 func (t *Table) ClearDirty() {
 	t.Init()
 	clear(t.dirty)
+	clear(t.bases)
 	t.Values.sets.Iter(func(_ uint32, set AttributeSet) bool {
 		set.ClearDirty()
 		return false
 	})
 }
 
-func (t *Table) recompute(key Key) bool {
+// recompute updates the Current value of key and reports whether it changed.
+// With out non-nil it also appends the base and current changes.
+func (t *Table) recompute(key Key, out *[]Change) bool {
 	set := t.Values.Get(KeySetID(key))
 	if set == nil {
 		return false
@@ -191,7 +384,16 @@ func (t *Table) recompute(key Key) bool {
 	if !ok {
 		return false
 	}
-	next := Eval(base, t.mods[key])
+	if out != nil {
+		if old, ok := t.bases[key]; ok && old != base {
+			*out = append(*out, Change{Key: key, Kind: ChangeBase, Old: old, New: base})
+		}
+		delete(t.bases, key)
+	}
+	next := base
+	if a := t.mods[key]; a != nil {
+		next = a.eval(base)
+	}
 	cur, _ := set.GetCurrent(field)
 	if hooks, ok := set.(Hooks); ok {
 		next = hooks.PreCurrentChange(field, next)
@@ -205,11 +407,23 @@ func (t *Table) recompute(key Key) bool {
 	if hooks, ok := set.(Hooks); ok {
 		hooks.PostCurrentChange(field, cur, next)
 	}
+	if out != nil {
+		*out = append(*out, Change{Key: key, Kind: ChangeCurrent, Old: cur, New: next})
+	}
 	return true
 }
 
-// Eval returns the current value produced by applying mods to base.
+// Eval returns the current value produced by applying mods to base under
+// DefaultPolicies. Table keeps incremental per-channel aggregates instead of
+// calling Eval, but its results are bit-identical to Eval over
+// ActiveModifiers(key) with the table's policies; Eval is the reference. Eval
+// itself ignores Require.
 func Eval(base float64, mods []Modifier) float64 {
+	return DefaultPolicies.Eval(base, mods)
+}
+
+// Eval is the package Eval with the channel policies p.
+func (p *Policies) Eval(base float64, mods []Modifier) float64 {
 	if len(mods) == 0 {
 		return base
 	}
@@ -223,50 +437,158 @@ func Eval(base float64, mods []Modifier) float64 {
 		if !used[ch] {
 			used[ch] = true
 			channels = append(channels, ch)
-			agg[ch].mul = 1
-			agg[ch].div = 1
-		}
-		c := &agg[ch]
-		switch mod.Op {
-		case ModAdd:
-			c.add += mod.Value
-		case ModMul:
-			c.mul += mod.Value - 1
-		case ModDiv:
-			c.div += mod.Value - 1
-		case ModOverride:
-			if !c.hasOverride || betterOverride(mod, c.override) {
-				c.hasOverride = true
-				c.override = mod
-			}
+			agg[ch] = newChannelMods(p[ch])
 		}
+		agg[ch].apply(mod)
 	}
 
 	slices.Sort(channels)
 
 	out := base
 	for _, ch := range channels {
-		c := agg[ch]
-		if c.hasOverride {
-			out = c.override.Value
-			continue
+		out = agg[ch].fold(out)
+	}
+	return out
+}
+
+// eval is Eval over the active mods computed from the cached channel aggregates.
+func (a *attrMods) eval(base float64) float64 {
+	if a.stale {
+		a.rebuild()
+	}
+	out := base
+	for i := range a.chans {
+		out = a.chans[i].fold(out)
+	}
+	return out
+}
+
+// channel returns the index of ch in chans, which must exist.
+func (a *attrMods) channel(ch uint8) int {
+	i, _ := slices.BinarySearchFunc(a.chans, ch, func(c chanAgg, ch uint8) int {
+		return cmp.Compare(c.ch, ch)
+	})
+	return i
+}
+
+func (a *attrMods) aggregate(mod Modifier, off bool, p *Policies) {
+	i := a.channel(mod.Channel)
+	if i == len(a.chans) || a.chans[i].ch != mod.Channel {
+		a.chans = slices.Insert(a.chans, i, chanAgg{ch: mod.Channel, channelMods: newChannelMods(p[mod.Channel])})
+	}
+	c := &a.chans[i]
+	c.n++
+	if !c.stale && !off {
+		c.apply(mod)
+	}
+}
+
+// rebuild re-aggregates the stale channels from mods and drops empty ones.
+func (a *attrMods) rebuild() {
+	for i := range a.chans {
+		if c := &a.chans[i]; c.stale {
+			c.channelMods = newChannelMods(c.policy)
 		}
-		out = (out + c.add) * c.mul
-		if c.div != 0 {
-			out /= c.div
+	}
+	for i, mod := range a.mods {
+		if c := &a.chans[a.channel(mod.Channel)]; c.stale && !a.off[i] {
+			c.apply(mod)
 		}
 	}
-	return out
+	a.chans = slices.DeleteFunc(a.chans, func(c chanAgg) bool { return c.n == 0 })
+	for i := range a.chans {
+		a.chans[i].stale = false
+	}
+	a.stale = false
 }
 
+// channelMods aggregates one channel under its policy. Under PolicyClamp add
+// holds the floor and mul the ceiling. has marks the ops seen by the policies
+// that keep a single value per op.
 type channelMods struct {
 	add         float64
 	mul         float64
 	div         float64
+	policy      Policy
+	has         uint8
 	hasOverride bool
 	override    Modifier
 }
 
+func newChannelMods(p Policy) channelMods {
+	return channelMods{mul: 1, div: 1, policy: p}
+}
+
+func (c *channelMods) apply(mod Modifier) {
+	if mod.Op == ModOverride {
+		if !c.hasOverride || betterOverride(mod, c.override) {
+			c.hasOverride = true
+			c.override = mod
+		}
+		return
+	}
+	switch c.policy {
+	case PolicyBiasSum:
+		switch mod.Op {
+		case ModAdd:
+			c.add += mod.Value
+		case ModMul:
+			c.mul += mod.Value - 1
+		case ModDiv:
+			c.div += mod.Value - 1
+		}
+	case PolicyProduct:
+		switch mod.Op {
+		case ModAdd:
+			c.add += mod.Value
+		case ModMul:
+			c.mul *= mod.Value
+		case ModDiv:
+			c.div *= mod.Value
+		}
+	default:
+		var x *float64
+		switch mod.Op {
+		case ModAdd:
+			x = &c.add
+		case ModMul:
+			x = &c.mul
+		case ModDiv:
+			x = &c.div
+		default:
+			return
+		}
+		// max keeps the highest value of each op, min the lowest, and clamp
+		// the tightest bounds: the highest floor and the lowest ceiling
+		higher := c.policy == PolicyMax || c.policy == PolicyClamp && mod.Op == ModAdd
+		bit := uint8(1) << mod.Op
+		if c.has&bit == 0 || higher && mod.Value > *x || !higher && mod.Value < *x {
+			*x = mod.Value
+		}
+		c.has |= bit
+	}
+}
+
+func (c *channelMods) fold(out float64) float64 {
+	if c.hasOverride {
+		return c.override.Value
+	}
+	if c.policy == PolicyClamp {
+		if c.has&(1<<ModAdd) != 0 {
+			out = max(out, c.add)
+		}
+		if c.has&(1<<ModMul) != 0 {
+			out = min(out, c.mul)
+		}
+		return out
+	}
+	out = (out + c.add) * c.mul
+	if c.div != 0 {
+		out /= c.div
+	}
+	return out
+}
+
 func betterOverride(a, b Modifier) bool {
 	if a.Priority != b.Priority {
 		return a.Priority > b.Priority
@@ -0,0 +1,262 @@
+package attr
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/legamerdc/game/tag"
+	"github.com/stretchr/testify/require"
+)
+
+// checkIndex verifies that bySource and the per-attribute back references agree.
+func checkIndex(t *testing.T, attrs *Table) {
+	t.Helper()
+	n := 0
+	for source, refs := range attrs.bySource {
+		require.NotEmpty(t, refs)
+		for j, r := range refs {
+			a := attrs.mods[r.key]
+			require.Equal(t, source, a.mods[r.slot].Source)
+			require.Equal(t, r.key, a.mods[r.slot].Attr)
+			require.Equal(t, int32(j), a.back[r.slot])
+		}
+		n += len(refs)
+	}
+	for _, a := range attrs.mods {
+		require.Len(t, a.back, len(a.mods))
+		n -= len(a.mods)
+	}
+	require.Zero(t, n)
+}
+
+// checkAggregates verifies that every current value is bit-identical to Eval
+// under the table's policies.
+func checkAggregates(t *testing.T, attrs *Table, keys []Key) {
+	t.Helper()
+	attrs.Flush()
+	for _, key := range keys {
+		base, _ := attrs.GetBase(key)
+		cur, _ := attrs.GetCurrent(key)
+		want := attrs.policies().Eval(base, attrs.ActiveModifiers(key, nil))
+		require.Equal(t, math.Float64bits(want), math.Float64bits(cur), "%v != %v", cur, want)
+	}
+}
+
+func TestTableSourceIndex(t *testing.T) {
+	var attrs Table
+	attrs.Init()
+	attrs.Put(&benchSet{})
+	model := map[uint64][]Modifier{}
+	rng := rand.New(rand.NewPCG(1, 2))
+	keys := []Key{MakeKey(testSetID, 0), MakeKey(testSetID, 1)}
+	randMod := func() Modifier {
+		return Modifier{
+			Attr:     keys[rng.IntN(2)],
+			Op:       ModOp(rng.IntN(4)),
+			Channel:  uint8(rng.IntN(3) * 7),
+			Priority: int16(rng.IntN(2)),
+			Value:    0.5 + rng.Float64(),
+		}
+	}
+	for _, key := range keys {
+		attrs.SetBase(key, 0.1)
+	}
+
+	for i := 0; i < 2000; i++ {
+		source := uint64(rng.IntN(20))
+		switch rng.IntN(3) {
+		case 0:
+			mod := randMod()
+			mod.Source = source
+			attrs.AddModifier(mod)
+			model[source] = append(model[source], mod)
+		case 1:
+			require.Equal(t, len(model[source]), attrs.RemoveModifiersBySource(source))
+			delete(model, source)
+		case 2:
+			var mods []Modifier
+			for range rng.IntN(4) {
+				mods = append(mods, randMod())
+			}
+			attrs.UpdateModifiersBySource(source, mods)
+			delete(model, source)
+			for _, mod := range mods {
+				mod.Source = source
+				model[source] = append(model[source], mod)
+			}
+		}
+		checkIndex(t, &attrs)
+		checkAggregates(t, &attrs, keys)
+	}
+
+	for _, key := range keys {
+		var want []Modifier
+		for _, mods := range model {
+			for _, mod := range mods {
+				if mod.Attr == key {
+					want = append(want, mod)
+				}
+			}
+		}
+		got := attrs.Modifiers(key, nil)
+		order := func(a, b Modifier) int {
+			if a.Source != b.Source {
+				return int(a.Source) - int(b.Source)
+			}
+			return cmp.Compare(a.Value, b.Value)
+		}
+		slices.SortFunc(want, order)
+		slices.SortFunc(got, order)
+		require.Equal(t, want, got)
+	}
+}
+
+const benchFieldCount = 16
+
+type benchSet struct {
+	base, current [benchFieldCount]float64
+}
+
+func (s *benchSet) SetID() uint32      { return testSetID }
+func (s *benchSet) FieldCount() uint16 { return benchFieldCount }
+func (s *benchSet) Dirty() uint64      { return 0 }
+func (s *benchSet) ClearDirty()        {}
+
+func (s *benchSet) GetCurrent(field uint16) (float64, bool) { return s.current[field], true }
+func (s *benchSet) GetBase(field uint16) (float64, bool)    { return s.base[field], true }
+
+func (s *benchSet) SetBase(field uint16, v float64) bool {
+	s.base[field] = v
+	return true
+}
+
+func (s *benchSet) SetCurrent(field uint16, v float64) bool {
+	s.current[field] = v
+	return true
+}
+
+// benchTable returns a table where each of n sources has three modifiers on
+// attributes spread over benchFieldCount fields, plus the modifiers of source 0.
+func benchTable(n int) (*Table, []Modifier) {
+	var attrs Table
+	attrs.Init()
+	attrs.Put(&benchSet{})
+	var first []Modifier
+	for s := range n {
+		for i := range 3 {
+			mod := Modifier{
+				Source: uint64(s),
+				Attr:   MakeKey(testSetID, uint16((s+i*5)%benchFieldCount)),
+				Op:     ModOp(i % 2),
+				Value:  1.1,
+			}
+			attrs.AddModifier(mod)
+			if s == 0 {
+				first = append(first, mod)
+			}
+		}
+	}
+	attrs.Flush()
+	return &attrs, first
+}
+
+func BenchmarkTableRemoveModifiersBySource(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			attrs, mods := benchTable(n)
+			b.ReportAllocs()
+			for b.Loop() {
+				attrs.RemoveModifiersBySource(0)
+				attrs.AddModifiers(mods)
+			}
+		})
+	}
+}
+
+func BenchmarkTableUpdateModifiersBySource(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			attrs, mods := benchTable(n)
+			b.ReportAllocs()
+			for b.Loop() {
+				attrs.UpdateModifiersBySource(0, mods)
+				attrs.Flush()
+			}
+		})
+	}
+}
+
+func BenchmarkTableFlush(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			attrs, _ := benchTable(n)
+			b.ReportAllocs()
+			for b.Loop() {
+				for f := range uint16(benchFieldCount) {
+					attrs.MarkDirty(MakeKey(testSetID, f))
+				}
+				attrs.Flush()
+			}
+		})
+	}
+}
+
+func TestTableTagGatedModifiers(t *testing.T) {
+	db, err := tag.Build(slices.Values([]string{"state.berserk", "state.stunned", "target.undead"}))
+	require.NoError(t, err)
+	lookup := func(s string) tag.Key {
+		k, ok := db.Lookup(s)
+		require.True(t, ok)
+		return k
+	}
+	berserk, err := tag.NewQuery(db, []tag.Key{lookup("state.berserk")}, nil, nil)
+	require.NoError(t, err)
+	calm, err := tag.NewQuery(db, nil, []tag.Key{lookup("state")}, nil)
+	require.NoError(t, err)
+
+	var attrs Table
+	attrs.Put(&testSet{})
+	attrs.SetBase(testAttrAttack, 100)
+	var tags tag.Tag
+	attrs.SetTags(&tags)
+	attrs.AddModifier(Modifier{Source: 1, Attr: testAttrAttack, Op: ModMul, Value: 1.2, Require: &berserk})
+	attrs.AddModifier(Modifier{Source: 2, Attr: testAttrAttack, Op: ModAdd, Value: 10, Require: &calm})
+	attrs.AddModifier(Modifier{Source: 3, Attr: testAttrAttack, Op: ModAdd, Value: 5, Channel: 1})
+	require.Equal(t, 115.0, attack(t, &attrs))
+	require.Len(t, attrs.Modifiers(testAttrAttack, nil), 3)
+	require.Len(t, attrs.ActiveModifiers(testAttrAttack, nil), 2)
+
+	tags.AddTag(db, lookup("state.berserk"))
+	attrs.TagsChanged()
+	require.Equal(t, 125.0, attack(t, &attrs))
+	checkAggregates(t, &attrs, []Key{testAttrAttack})
+
+	// a modifier added while its query matches is active right away
+	attrs.AddModifier(Modifier{Source: 4, Attr: testAttrAttack, Op: ModMul, Value: 1.5, Require: &berserk})
+	require.Equal(t, 175.0, attack(t, &attrs))
+
+	// unchanged tags leave the aggregates alone
+	attrs.TagsChanged()
+	require.Zero(t, attrs.Flush())
+
+	tags.RemoveTag(db, lookup("state.berserk"))
+	tags.AddTag(db, lookup("state.stunned"))
+	attrs.TagsChanged()
+	require.Equal(t, 105.0, attack(t, &attrs))
+	attrs.RemoveModifiersBySource(1)
+	checkIndex(t, &attrs)
+
+	// nil tags match like an empty set
+	attrs.SetTags(nil)
+	require.Equal(t, 115.0, attack(t, &attrs))
+	checkAggregates(t, &attrs, []Key{testAttrAttack})
+	b, _ := attrs.Breakdown(testAttrAttack)
+	require.Equal(t, []uint64{4}, sources(b.Gated))
+
+	tpl := ModifierTemplate{Attr: testAttrAttack, Op: ModAdd, Value: 1, Require: &berserk}
+	require.Same(t, &berserk, tpl.Bind(5).Require)
+}
@@ -0,0 +1,57 @@
+package attr
+
+// Policy decides how the modifiers of one channel aggregate. ModOverride works
+// the same under every policy: the winning override replaces the value.
+type Policy uint8
+
+const (
+	// PolicyBiasSum is the GAS bias=1 aggregation: (in + ΣAdd) * (1 + Σ(Mul-1))
+	// / (1 + Σ(Div-1)), so two 1.2 multipliers give 1.4.
+	PolicyBiasSum Policy = iota
+	// PolicyProduct compounds: (in + ΣAdd) * ΠMul / ΠDiv, so two 1.2
+	// multipliers give 1.44.
+	PolicyProduct
+	// PolicyMax keeps only the highest Add, Mul and Div, for non-stacking
+	// auras where the strongest source wins.
+	PolicyMax
+	// PolicyMin keeps only the lowest Add, Mul and Div.
+	PolicyMin
+	// PolicyClamp bounds the value instead of changing it: ModAdd modifiers are
+	// floors and ModMul modifiers ceilings, and the tightest of each applies.
+	// ModDiv is ignored. A floor above the ceiling yields the ceiling.
+	PolicyClamp
+)
+
+// Policies assigns a Policy to every channel. The zero value is
+// PolicyBiasSum everywhere, the aggregation Table has always used.
+type Policies [256]Policy
+
+// DefaultPolicies applies to every Table without its own policies and to Eval.
+// Configure it at startup, before any Table aggregates modifiers; a change
+// does not reach the aggregates Tables already cache.
+var DefaultPolicies Policies
+
+// SetPolicies gives the table its own channel policies, or nil to go back to
+// DefaultPolicies. The table keeps the pointer; call SetPolicies again after
+// changing *p. Every attribute with modifiers is re-aggregated and marked
+// dirty.
+func (t *Table) SetPolicies(p *Policies) {
+	t.Init()
+	t.policy = p
+	policies := t.policies()
+	for key, a := range t.mods {
+		for i := range a.chans {
+			c := &a.chans[i]
+			c.policy, c.stale = policies[c.ch], true
+		}
+		a.stale = true
+		t.MarkDirty(key)
+	}
+}
+
+func (t *Table) policies() *Policies {
+	if t.policy != nil {
+		return t.policy
+	}
+	return &DefaultPolicies
+}
@@ -0,0 +1,121 @@
+package attr
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicies(t *testing.T) {
+	mods := []Modifier{
+		{Source: 1, Op: ModAdd, Value: 10},
+		{Source: 2, Op: ModAdd, Value: 30},
+		{Source: 3, Op: ModMul, Value: 1.2},
+		{Source: 4, Op: ModMul, Value: 1.5},
+		{Source: 5, Op: ModDiv, Value: 2},
+	}
+	cases := []struct {
+		policy Policy
+		want   float64
+	}{
+		{PolicyBiasSum, (100 + 40) * 1.7 / 2},
+		{PolicyProduct, (100 + 40) * (1.2 * 1.5) / 2},
+		{PolicyMax, (100 + 30) * 1.5 / 2},
+		{PolicyMin, (100 + 10) * 1.2 / 2},
+	}
+	for _, c := range cases {
+		var p Policies
+		p[0] = c.policy
+		require.InEpsilon(t, c.want, p.Eval(100, mods), 1e-12, c.policy)
+	}
+
+	// clamp keeps the highest floor and the lowest ceiling
+	var p Policies
+	p[1] = PolicyClamp
+	clamp := []Modifier{
+		{Channel: 1, Op: ModAdd, Value: 20},
+		{Channel: 1, Op: ModAdd, Value: 50},
+		{Channel: 1, Op: ModMul, Value: 90},
+		{Channel: 1, Op: ModMul, Value: 80},
+		{Channel: 1, Op: ModDiv, Value: 1000},
+	}
+	require.Equal(t, 50.0, p.Eval(10, clamp))
+	require.Equal(t, 60.0, p.Eval(60, clamp))
+	require.Equal(t, 80.0, p.Eval(100, clamp))
+	// channels chain as before, and overrides win under every policy
+	require.Equal(t, 80.0, p.Eval(0, append(clamp, Modifier{Op: ModAdd, Value: 200})))
+	require.Equal(t, 7.0, p.Eval(0, append(clamp, Modifier{Channel: 1, Op: ModOverride, Value: 7})))
+}
+
+func TestTablePolicies(t *testing.T) {
+	var attrs Table
+	attrs.Put(&testSet{})
+	attrs.SetBase(testAttrAttack, 100)
+	attrs.AddModifiers([]Modifier{
+		{Source: 1, Attr: testAttrAttack, Op: ModMul, Value: 1.2},
+		{Source: 2, Attr: testAttrAttack, Op: ModMul, Value: 1.2},
+		{Source: 3, Attr: testAttrAttack, Op: ModMul, Value: 3, Channel: 9},
+	})
+	require.InEpsilon(t, 140*3.0, attack(t, &attrs), 1e-12)
+
+	var p Policies
+	p[0] = PolicyProduct
+	attrs.SetPolicies(&p)
+	require.InEpsilon(t, 144*3.0, attack(t, &attrs), 1e-12)
+
+	// changing *p needs another SetPolicies; the ModMul of channel 9 is now a ceiling
+	p[9] = PolicyClamp
+	attrs.SetPolicies(&p)
+	require.Equal(t, 3.0, attack(t, &attrs))
+	b, _ := attrs.Breakdown(testAttrAttack)
+	require.Equal(t, PolicyProduct, b.Steps[0].Policy)
+	require.Equal(t, PolicyClamp, b.Steps[1].Policy)
+
+	attrs.AddModifier(Modifier{Source: 4, Attr: testAttrAttack, Op: ModMul, Value: 1.5})
+	attrs.RemoveModifiersBySource(3)
+	require.InEpsilon(t, 216.0, attack(t, &attrs), 1e-12)
+	checkAggregates(t, &attrs, []Key{testAttrAttack})
+
+	attrs.SetPolicies(nil)
+	require.InEpsilon(t, 190.0, attack(t, &attrs), 1e-12)
+
+	// Policies.Eval over the same modifiers matches the aggregate
+	var q Policies
+	q[0] = PolicyMax
+	attrs.SetPolicies(&q)
+	require.Equal(t, 150.0, attack(t, &attrs))
+	require.Equal(t, 150.0, q.Eval(100, attrs.Modifiers(testAttrAttack, nil)))
+}
+
+func TestTablePoliciesRandom(t *testing.T) {
+	var attrs Table
+	attrs.Put(&benchSet{})
+	var p Policies
+	for ch := range p {
+		p[ch] = Policy(ch % 5)
+	}
+	attrs.SetPolicies(&p)
+	keys := []Key{field(0), field(1)}
+	rng := rand.New(rand.NewPCG(3, 4))
+	for i := range 2000 {
+		source := uint64(rng.IntN(20))
+		if rng.IntN(3) == 0 {
+			attrs.RemoveModifiersBySource(source)
+		} else {
+			attrs.AddModifier(Modifier{
+				Source:   source,
+				Attr:     keys[rng.IntN(2)],
+				Op:       ModOp(rng.IntN(4)),
+				Channel:  uint8(rng.IntN(6)),
+				Priority: int16(rng.IntN(2)),
+				Value:    0.5 + rng.Float64(),
+			})
+		}
+		if i%100 == 0 {
+			p[rng.IntN(6)] = Policy(rng.IntN(5))
+			attrs.SetPolicies(&p)
+		}
+		checkAggregates(t, &attrs, keys)
+	}
+}
@@ -0,0 +1,249 @@
+package attr
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"math"
+	"slices"
+)
+
+// SnapshotVersion is the format version written by Snapshot and MarshalBinary.
+const SnapshotVersion uint32 = 1
+
+var (
+	ErrSnapshotVersion = errors.New("attr: unsupported snapshot version")
+	ErrSnapshotCorrupt = errors.New("attr: corrupt snapshot")
+	// ErrSnapshotGated is returned by MarshalBinary for a modifier with a
+	// Require query; Table.Snapshot never produces one.
+	ErrSnapshotGated = errors.New("attr: gated modifiers cannot be saved")
+)
+
+var snapshotMagic = [4]byte{'A', 'T', 'T', 'R'}
+
+// Snapshot is the persistent state of a Table: the Base of every field, which
+// for scalar fields is the value itself, and the full modifier list. Current
+// values are not saved; they are recomputed from the rest.
+//
+// Fields are identified by set id and the explicit field ids assigned in the
+// mk_attr config, so a snapshot restores into a build that added sets or
+// fields: unknown sets and fields are skipped and new ones keep their
+// defaults. The zero Version is treated as 1.
+type Snapshot struct {
+	Version   uint32        `json:"version"`
+	Sets      []SetSnapshot `json:"sets"`
+	Modifiers []Modifier    `json:"modifiers,omitempty"`
+}
+
+type SetSnapshot struct {
+	ID     uint32          `json:"id"`
+	Fields []FieldSnapshot `json:"fields"`
+}
+
+type FieldSnapshot struct {
+	ID   uint16  `json:"id"`
+	Base float64 `json:"base"`
+}
+
+// Snapshot captures the table in a deterministic order: sets and fields by id,
+// modifiers by source. Modifiers with a Require query hold tag keys, which are
+// not stable across tag dictionaries, so they are left out of s and returned
+// in gated; the owner should re-add them from their source after a restore.
+func (t *Table) Snapshot() (s Snapshot, gated []Modifier) {
+	t.Init()
+	s = Snapshot{Version: SnapshotVersion}
+	t.Values.sets.Iter(func(id uint32, set AttributeSet) bool {
+		ss := SetSnapshot{ID: id}
+		for field := range set.FieldCount() {
+			if base, ok := set.GetBase(field); ok {
+				ss.Fields = append(ss.Fields, FieldSnapshot{ID: field, Base: base})
+			}
+		}
+		s.Sets = append(s.Sets, ss)
+		return false
+	})
+	slices.SortFunc(s.Sets, func(a, b SetSnapshot) int { return cmp.Compare(a.ID, b.ID) })
+
+	sources := make([]uint64, 0, len(t.bySource))
+	for source := range t.bySource {
+		sources = append(sources, source)
+	}
+	slices.Sort(sources)
+	for _, source := range sources {
+		for _, r := range t.bySource[source] {
+			mod := t.mods[r.key].mods[r.slot]
+			if mod.Require != nil {
+				gated = append(gated, mod)
+				continue
+			}
+			s.Modifiers = append(s.Modifiers, mod)
+		}
+	}
+	return s, gated
+}
+
+// Restore writes the saved bases into the registered sets and replaces every
+// modifier with the saved ones. Bases are written without PreBaseChange, and
+// modifiers on attributes that no longer exist are dropped. Every attribute
+// is marked dirty, so call Flush afterwards; FlushInto reports the restored
+// bases as ChangeBase like any other base write.
+func (t *Table) Restore(s Snapshot) error {
+	if s.Version > SnapshotVersion {
+		return ErrSnapshotVersion
+	}
+	t.Init()
+	for _, ss := range s.Sets {
+		set := t.Values.Get(ss.ID)
+		if set == nil {
+			continue
+		}
+		for _, f := range ss.Fields {
+			old, _ := set.GetBase(f.ID)
+			if set.SetBase(f.ID, f.Base) {
+				t.keepBase(MakeKey(ss.ID, f.ID), old)
+			}
+		}
+	}
+	for source := range t.bySource {
+		t.RemoveModifiersBySource(source)
+	}
+	for _, mod := range s.Modifiers {
+		if _, ok := t.Values.GetBase(mod.Attr); ok {
+			mod.Require = nil
+			t.AddModifier(mod)
+		}
+	}
+	t.Values.sets.Iter(func(id uint32, set AttributeSet) bool {
+		for field := range set.FieldCount() {
+			t.MarkDirty(MakeKey(id, field))
+		}
+		return false
+	})
+	return nil
+}
+
+// MarshalBinary encodes s as "ATTR", the version, then the sets and the
+// modifiers with varint ids and little-endian float64 values.
+func (s *Snapshot) MarshalBinary() ([]byte, error) {
+	b := append([]byte(nil), snapshotMagic[:]...)
+	b = binary.AppendUvarint(b, uint64(SnapshotVersion))
+	b = binary.AppendUvarint(b, uint64(len(s.Sets)))
+	for _, ss := range s.Sets {
+		b = binary.AppendUvarint(b, uint64(ss.ID))
+		b = binary.AppendUvarint(b, uint64(len(ss.Fields)))
+		for _, f := range ss.Fields {
+			b = binary.AppendUvarint(b, uint64(f.ID))
+			b = binary.LittleEndian.AppendUint64(b, math.Float64bits(f.Base))
+		}
+	}
+	b = binary.AppendUvarint(b, uint64(len(s.Modifiers)))
+	for _, mod := range s.Modifiers {
+		if mod.Require != nil {
+			return nil, ErrSnapshotGated
+		}
+		b = binary.AppendUvarint(b, mod.Source)
+		b = binary.AppendUvarint(b, uint64(mod.Attr))
+		b = append(b, byte(mod.Op), mod.Channel)
+		b = binary.AppendVarint(b, int64(mod.Priority))
+		b = binary.LittleEndian.AppendUint64(b, math.Float64bits(mod.Value))
+	}
+	return b, nil
+}
+
+func (s *Snapshot) UnmarshalBinary(data []byte) error {
+	if len(data) < len(snapshotMagic) || [4]byte(data) != snapshotMagic {
+		return ErrSnapshotCorrupt
+	}
+	r := byteReader{b: data[len(snapshotMagic):]}
+	version := uint32(r.uvarint())
+	if r.err == nil && version > SnapshotVersion {
+		return ErrSnapshotVersion
+	}
+	out := Snapshot{Version: version}
+	for range r.count() {
+		ss := SetSnapshot{ID: uint32(r.uvarint())}
+		for range r.count() {
+			ss.Fields = append(ss.Fields, FieldSnapshot{ID: uint16(r.uvarint()), Base: r.float()})
+		}
+		out.Sets = append(out.Sets, ss)
+	}
+	for range r.count() {
+		var mod Modifier
+		mod.Source = r.uvarint()
+		mod.Attr = Key(r.uvarint())
+		mod.Op, mod.Channel = ModOp(r.byte()), r.byte()
+		mod.Priority = int16(r.varint())
+		mod.Value = r.float()
+		out.Modifiers = append(out.Modifiers, mod)
+	}
+	if r.err == nil && len(r.b) > 0 {
+		r.fail()
+	}
+	if r.err != nil {
+		return r.err
+	}
+	*s = out
+	return nil
+}
+
+// byteReader decodes the binary forms and keeps the first error, so the
+// decoder reads straight through and checks once at the end.
+type byteReader struct {
+	b   []byte
+	err error
+}
+
+func (r *byteReader) fail() {
+	r.b, r.err = nil, ErrSnapshotCorrupt
+}
+
+func (r *byteReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *byteReader) varint() int64 {
+	v, n := binary.Varint(r.b)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+// count reads a length that is at most the remaining bytes, since every
+// element takes at least one.
+func (r *byteReader) count() int {
+	n := r.uvarint()
+	if n > uint64(len(r.b)) {
+		r.fail()
+		return 0
+	}
+	return int(n)
+}
+
+func (r *byteReader) byte() byte {
+	if len(r.b) < 1 {
+		r.fail()
+		return 0
+	}
+	v := r.b[0]
+	r.b = r.b[1:]
+	return v
+}
+
+func (r *byteReader) float() float64 {
+	if len(r.b) < 8 {
+		r.fail()
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(r.b)
+	r.b = r.b[8:]
+	return math.Float64frombits(v)
+}
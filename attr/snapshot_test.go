@@ -0,0 +1,147 @@
+package attr
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/legamerdc/game/tag"
+	"github.com/stretchr/testify/require"
+)
+
+// otherSet is a second set, standing in for a set added in a later version.
+type otherSet struct{ benchSet }
+
+func (s *otherSet) SetID() uint32 { return testSetID + 1 }
+
+func snapshotTable(t *testing.T) *Table {
+	t.Helper()
+	var attrs Table
+	attrs.Put(&testSet{})
+	attrs.SetBase(testAttrHP, 80)
+	attrs.SetBase(testAttrAttack, 100)
+	attrs.AddModifiers([]Modifier{
+		{Source: 9, Attr: testAttrAttack, Op: ModMul, Value: 1.5, Channel: 2},
+		{Source: 3, Attr: testAttrAttack, Op: ModAdd, Value: 20},
+		{Source: 3, Attr: testAttrHP, Op: ModOverride, Priority: -4, Value: 1},
+	})
+	attrs.Flush()
+	return &attrs
+}
+
+func TestTableSnapshot(t *testing.T) {
+	src := snapshotTable(t)
+	s, gated := src.Snapshot()
+	require.Empty(t, gated)
+	require.Equal(t, Snapshot{
+		Version: SnapshotVersion,
+		Sets:    []SetSnapshot{{ID: testSetID, Fields: []FieldSnapshot{{ID: 0}, {ID: testFieldHP, Base: 80}, {ID: testFieldAttack, Base: 100}}}},
+		Modifiers: []Modifier{
+			{Source: 3, Attr: testAttrAttack, Op: ModAdd, Value: 20},
+			{Source: 3, Attr: testAttrHP, Op: ModOverride, Priority: -4, Value: 1},
+			{Source: 9, Attr: testAttrAttack, Op: ModMul, Value: 1.5, Channel: 2},
+		},
+	}, s)
+
+	b, err := s.MarshalBinary()
+	require.NoError(t, err)
+	var fromBinary Snapshot
+	require.NoError(t, fromBinary.UnmarshalBinary(b))
+	require.Equal(t, s, fromBinary)
+
+	j, err := json.Marshal(s)
+	require.NoError(t, err)
+	var fromJSON Snapshot
+	require.NoError(t, json.Unmarshal(j, &fromJSON))
+	require.Equal(t, s, fromJSON)
+
+	// restoring replaces existing state
+	var dst Table
+	dst.Put(&testSet{})
+	dst.SetBase(testAttrHP, 5)
+	dst.AddModifier(Modifier{Source: 3, Attr: testAttrHP, Op: ModAdd, Value: 7})
+	dst.AddModifier(Modifier{Source: 4, Attr: testAttrHP, Op: ModAdd, Value: 7})
+	require.NoError(t, dst.Restore(fromBinary))
+	dst.Flush()
+	for _, key := range []Key{testAttrHP, testAttrAttack} {
+		want, _ := src.GetCurrent(key)
+		got, _ := dst.GetCurrent(key)
+		require.Equal(t, want, got)
+	}
+	checkIndex(t, &dst)
+	again, _ := dst.Snapshot()
+	require.Equal(t, s, again)
+}
+
+func TestTableSnapshotVersions(t *testing.T) {
+	s, _ := snapshotTable(t).Snapshot()
+
+	// a later build added fields to the set and a whole new set
+	var grown Table
+	grown.Put(&benchSet{})
+	grown.Put(&otherSet{})
+	grown.SetBase(field(5), 7)
+	require.NoError(t, grown.Restore(s))
+	grown.Flush()
+	require.Equal(t, 180.0, current(t, &grown, testAttrAttack))
+	require.Equal(t, 7.0, current(t, &grown, field(5)))
+
+	// and an older build restores the grown snapshot, skipping what it lacks
+	grown.AddModifier(Modifier{Source: 1, Attr: field(5), Op: ModAdd, Value: 1})
+	g, _ := grown.Snapshot()
+	require.Len(t, g.Sets, 2)
+	var old Table
+	old.Put(&testSet{})
+	require.NoError(t, old.Restore(g))
+	old.Flush()
+	require.Equal(t, 180.0, current(t, &old, testAttrAttack))
+	require.Len(t, old.bySource, 2)
+
+	s.Version = SnapshotVersion + 1
+	require.ErrorIs(t, old.Restore(s), ErrSnapshotVersion)
+	b, _ := s.MarshalBinary()
+	b[4] = byte(SnapshotVersion + 1)
+	require.ErrorIs(t, s.UnmarshalBinary(b), ErrSnapshotVersion)
+}
+
+func TestTableSnapshotErrors(t *testing.T) {
+	s, _ := snapshotTable(t).Snapshot()
+	b, _ := s.MarshalBinary()
+	for n := range len(b) {
+		var x Snapshot
+		require.ErrorIs(t, x.UnmarshalBinary(b[:n]), ErrSnapshotCorrupt, n)
+	}
+	require.ErrorIs(t, s.UnmarshalBinary(append(b, 0)), ErrSnapshotCorrupt)
+	b[0] = 'X'
+	require.ErrorIs(t, s.UnmarshalBinary(b), ErrSnapshotCorrupt)
+
+	s.Modifiers[0].Require = &tag.Query{}
+	_, err := s.MarshalBinary()
+	require.ErrorIs(t, err, ErrSnapshotGated)
+}
+
+func TestTableSnapshotGated(t *testing.T) {
+	attrs := snapshotTable(t)
+	gate := Modifier{Source: 1, Attr: testAttrHP, Op: ModAdd, Value: 1, Require: &tag.Query{}}
+	attrs.AddModifier(gate)
+	s, gated := attrs.Snapshot()
+	require.Equal(t, []Modifier{gate}, gated)
+	want, _ := snapshotTable(t).Snapshot()
+	require.Equal(t, want, s)
+	_, err := s.MarshalBinary()
+	require.NoError(t, err)
+}
+
+func TestTableRestoreChanges(t *testing.T) {
+	s, _ := snapshotTable(t).Snapshot()
+	var attrs Table
+	attrs.Put(&testSet{})
+	attrs.SetBase(testAttrHP, 80)
+	attrs.SetBase(testAttrAttack, 10)
+	attrs.Flush()
+	require.NoError(t, attrs.Restore(s))
+	changes := attrs.FlushInto(nil)
+	require.Contains(t, changes, Change{Key: testAttrAttack, Kind: ChangeBase, Old: 10, New: 100})
+	for _, c := range changes {
+		require.False(t, c.Key == testAttrHP && c.Kind == ChangeBase, c)
+	}
+}
@@ -0,0 +1,89 @@
+package cc
+
+import "github.com/legamerdc/game/attr"
+
+// Info 是表达式的静态分析结果。黑板变量以名字为键（编译时经 Key 映射前的名字），
+// 值为该变量经过类型推断后的类型；WithAttrs 绑定的属性单独以 attr.Key 报告。
+type Info struct {
+	Reads      map[string]Type // 以 x 形式读取的变量，不存在时取零值
+	ForceReads map[string]Type // 以 x! 形式读取的变量，不存在时求值失败
+	Writes     map[string]Type // 被赋值的变量
+	Calls      map[string]Type // 调用的函数及其返回类型，包括注册函数与走 Exec 的函数
+
+	AttrReads      map[AttrRef]struct{}  // 以 x 形式读取的属性，不存在时取 0
+	AttrForceReads map[AttrRef]struct{}  // 以 x! 形式读取的属性，不存在时求值失败
+	AttrWrites     map[attr.Key]struct{} // 被赋值的属性，赋值总是写入 Base
+}
+
+// AttrRef 是一次属性读取，Base 为 true 时读取 Base（`Health.base`），否则读取 Current
+type AttrRef struct {
+	Key  attr.Key
+	Base bool
+}
+
+// Analyze 对 code 做语法分析和类型推断，但不生成可执行代码。它与 Compile 使用同一套
+// 检查流程，但不知道求值上下文的类型，总是假定上下文实现了 RandCtx、AttrCtx 与 TagCtx：
+// 使用随机函数、属性或标签的代码可以通过 Analyze，而在上下文缺少这些能力时被 Compile 拒绝。
+// 除此之外 Compile 会拒绝的代码 Analyze 同样返回错误。
+// opts 中的函数表会影响类型推断结果，应当与编译时保持一致。已编译的程序可以通过
+// Program.Info 取得同样的结果。
+func Analyze(code string, opts ...Option) (*Info, error) {
+	o := newOptions(opts)
+	o.rand, o.attr, o.tag = true, true, true // 静态分析不关心求值上下文的能力
+	t, e := check(code, o)
+	if e != nil {
+		return nil, e
+	}
+	return t.info(), nil
+}
+
+// info 从类型推断后的语法树收集读写的变量与属性
+func (t *tree) info() *Info {
+	info := &Info{
+		Reads:          make(map[string]Type),
+		ForceReads:     make(map[string]Type),
+		Writes:         make(map[string]Type),
+		Calls:          make(map[string]Type),
+		AttrReads:      make(map[AttrRef]struct{}),
+		AttrForceReads: make(map[AttrRef]struct{}),
+		AttrWrites:     make(map[attr.Key]struct{}),
+	}
+	t.root.analyze(t.vars, info)
+	return info
+}
+
+func (n *Node) analyze(m map[string]exprType, info *Info) {
+	switch {
+	case n.local != nil:
+		// let 局部变量不经过黑板
+	case n.attr != nil && n.Type == NodeAssign:
+		info.AttrWrites[n.attr.key] = struct{}{}
+	case n.attr != nil && n.Type == NodeIdent:
+		info.AttrForceReads[AttrRef{n.attr.key, n.attr.base}] = struct{}{}
+	case n.attr != nil:
+		info.AttrReads[AttrRef{n.attr.key, n.attr.base}] = struct{}{}
+	case n.Type == NodeTryIdent:
+		info.Reads[n.Token] = _static(m[n.Token])
+	case n.Type == NodeIdent:
+		info.ForceReads[n.Token] = _static(m[n.Token])
+	case n.Type == NodeAssign:
+		info.Writes[n.Token] = _static(m[n.Token])
+	case n.Type == NodeFunc:
+		if n.def != nil {
+			info.Calls[n.Token] = n.def.ret
+		} else {
+			info.Calls[n.Token] = _static(m[n.Token])
+		}
+	}
+	for _, x := range n.Children {
+		x.analyze(m, info)
+	}
+}
+
+// _static 返回定点模式改写前的类型
+func _static(t exprType) Type {
+	if t == exprFixed {
+		return exprFloat
+	}
+	return t
+}
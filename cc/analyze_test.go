@@ -0,0 +1,61 @@
+package cc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyze(t *testing.T) {
+	t.Run("读写与调用", func(t *testing.T) {
+		info, err := Analyze("int hp, hp_max, f1; float r, dist; string s; r = hp / hp_max; s = 'idle'; r < 0.35 && dist! < sqrt(f1(hp))")
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]Type{"hp": TypeInt, "hp_max": TypeInt, "r": TypeFloat}, info.Reads)
+		assert.Equal(t, map[string]Type{"dist": TypeFloat}, info.ForceReads)
+		assert.Equal(t, map[string]Type{"r": TypeFloat, "s": TypeString}, info.Writes)
+		assert.Equal(t, map[string]Type{"sqrt": TypeFloat, "f1": TypeInt}, info.Calls)
+	})
+
+	t.Run("赋值后读取", func(t *testing.T) {
+		info, err := Analyze("int a, b; a = 1; b = a + 1; b > 0")
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]Type{"a": TypeInt, "b": TypeInt}, info.Reads)
+		assert.Equal(t, map[string]Type{"a": TypeInt, "b": TypeInt}, info.Writes)
+		assert.Empty(t, info.ForceReads)
+		assert.Empty(t, info.Calls)
+	})
+
+	t.Run("函数表影响分析", func(t *testing.T) {
+		_, err := Analyze("float x; sqrt(x)", WithFuncs(nil))
+		assert.NotNil(t, err)
+
+		fs := NewFuncs().MustRegister("even(int) bool", func(x int64) bool { return x%2 == 0 })
+		info, err := Analyze("int x; even(x)", WithFuncs(fs))
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]Type{"even": TypeBool}, info.Calls)
+	})
+
+	t.Run("与编译错误一致", func(t *testing.T) {
+		for _, code := range []string{"int x; x +", "bool a; int b; a + b", "float x; x % 2"} {
+			_, e0 := Analyze(code)
+			_, e1 := Compile[string, *MockKv](code, s2s)
+			assert.NotNil(t, e0, code)
+			assert.NotNil(t, e1, code)
+		}
+	})
+
+	t.Run("假定上下文支持随机函数", func(t *testing.T) {
+		code := "float p; chance(p)"
+		_, e0 := Analyze(code)
+		assert.Nil(t, e0)
+		_, e1 := Compile[string, *MockKv](code, s2s)
+		assert.ErrorContains(t, e1, "chance needs a random source")
+	})
+
+	t.Run("类型名", func(t *testing.T) {
+		assert.Equal(t, "int", TypeInt.String())
+		assert.Equal(t, "float", TypeFloat.String())
+		assert.Equal(t, "bool", TypeBool.String())
+		assert.Equal(t, "string", TypeString.String())
+	})
+}
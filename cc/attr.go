@@ -0,0 +1,168 @@
+package cc
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/legamerdc/game/attr"
+	"github.com/legamerdc/game/lib"
+)
+
+var (
+	fmtNoAttrs      = "%s needs attributes: context does not implement AttrCtx"
+	fmtAttrDefined  = "attribute redefined: %s"
+	fmtAttrConflict = "attribute name bound to different keys: %s"
+	fmtAttrMiss     = "attribute not set: %s"
+)
+
+// attrBase 是读取属性基础值的后缀，Health.base 读取 Health 的 Base
+const attrBase = ".base"
+
+type (
+	// Attrs 是属性绑定模式读写属性的接口，*attr.Table 与 *attr.Map 满足该接口。
+	// 赋值写入 Base，通过 *attr.Table 写入时会标脏，由 Flush 重新计算 Current。
+	Attrs interface {
+		GetBase(attr.Key) (float64, bool)
+		GetCurrent(attr.Key) (float64, bool)
+		SetBase(attr.Key, float64) bool
+	}
+
+	// AttrCtx 是提供属性表的求值上下文。只有 B 实现了 AttrCtx 时，程序才能读写绑定的属性，
+	// 否则编译报错。
+	AttrCtx interface {
+		Attrs() Attrs
+	}
+
+	// attrRef 是名字解析到的属性
+	attrRef struct {
+		key  attr.Key
+		base bool // 读取 Base 而不是 Current
+	}
+)
+
+var attrCtxType = reflect.TypeFor[AttrCtx]()
+
+// WithAttrs 开启属性绑定：没有声明为黑板变量的标识符按 names 解析为属性，通常传入
+// mk_attr 生成的 XxxAttrNames。属性的类型是 float，读取 Current，`Health.base` 读取 Base，
+// 赋值写入 Base。绑定在编译期完成，求值时直接以 attr.Key 访问属性表。
+// 多个属性集中同名的字段必须对应同一个 Key，否则编译报错。
+func WithAttrs(names ...map[string]attr.Key) Option {
+	return func(o *options) {
+		if o.attrs == nil {
+			o.attrs = make(map[string]attr.Key)
+		}
+		for _, m := range names {
+			for name, key := range m {
+				if k0, ok := o.attrs[name]; ok && k0 != key {
+					o.attrErr = fmt.Errorf(fmtAttrConflict, name)
+				}
+				o.attrs[name] = key
+			}
+		}
+	}
+}
+
+// phaseAttr 把没有解析到局部变量和黑板变量的名字绑定到属性，属性名不能再声明为黑板变量或局部变量
+func (n *Node) phaseAttr(m map[string]exprType, o *options) error {
+	if o.attrs == nil {
+		return nil
+	}
+	if o.attrErr != nil {
+		return o.attrErr
+	}
+	for _, x := range n.Children {
+		if x.Type != NodeVarDecl {
+			continue
+		}
+		_, vs, _ := strings.Cut(x.Token, ":")
+		for name := range strings.SplitSeq(vs, ",") {
+			if _, ok := o.attrs[name]; ok {
+				return x.errorf(fmtAttrDefined, name)
+			}
+		}
+	}
+	return n.bindAttr(m, o)
+}
+
+func (n *Node) bindAttr(m map[string]exprType, o *options) error {
+	switch n.Type {
+	case NodeLet:
+		if _, ok := o.attrs[n.Token]; ok {
+			return n.errorf(fmtAttrDefined, n.Token)
+		}
+	case NodeIdent, NodeTryIdent, NodeAssign:
+		if _, ok := m[n.Token]; ok || n.local != nil {
+			break
+		}
+		name, base := strings.CutSuffix(n.Token, attrBase)
+		if key, ok := o.attrs[name]; ok {
+			if !o.attr {
+				return n.errorf(fmtNoAttrs, n.Token)
+			}
+			n.attr = &attrRef{key: key, base: base}
+		}
+	}
+	for _, x := range n.Children {
+		if e := x.bindAttr(m, o); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func _attrs[B any](kv B) Attrs {
+	return any(kv).(AttrCtx).Attrs()
+}
+
+// _attrGet 读取属性，x 读不到时为 0，x! 读不到时报错
+func _attrGet[B any](n *Node) func(B) (float64, error) {
+	key, token := n.attr.key, n.Token
+	must := n.Type == NodeIdent
+	if n.attr.base {
+		return func(kv B) (float64, error) {
+			x, ok := _attrs(kv).GetBase(key)
+			if !ok && must {
+				return 0, n.errorf(fmtAttrMiss, token)
+			}
+			return x, nil
+		}
+	}
+	return func(kv B) (float64, error) {
+		x, ok := _attrs(kv).GetCurrent(key)
+		if !ok && must {
+			return 0, n.errorf(fmtAttrMiss, token)
+		}
+		return x, nil
+	}
+}
+
+// _attrSet 把赋值写入属性的 Base
+func _attrSet[B any](n *Node) func(B, float64) error {
+	key, token := n.attr.key, n.Token
+	return func(kv B, x float64) error {
+		if !_attrs(kv).SetBase(key, x) {
+			return n.errorf(fmtAttrMiss, token)
+		}
+		return nil
+	}
+}
+
+func compileAttr[B any](n *Node) func(frame[B]) (lib.Field, error) {
+	get := _attrGet[B](n)
+	return func(b frame[B]) (lib.Field, error) {
+		x, e := get(b.kv)
+		return lib.Float64(x), e
+	}
+}
+
+func compileAssignAttr[B any](n *Node, f func(frame[B]) (lib.Field, error)) func(frame[B]) (lib.Field, error) {
+	set := _attrSet[B](n)
+	return func(b frame[B]) (v lib.Field, e error) {
+		if v, e = f(b); e != nil {
+			return
+		}
+		x, _ := v.Float64()
+		return v, set(b.kv, x)
+	}
+}
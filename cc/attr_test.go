@@ -0,0 +1,228 @@
+package cc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/legamerdc/game/attr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAttrSetID uint32 = 7
+
+	testAttrHealth uint16 = iota
+	testAttrHealthMax
+	testAttrPower
+	testAttrCount
+)
+
+var testAttrNames = map[string]attr.Key{
+	"Health":    attr.MakeKey(testAttrSetID, testAttrHealth),
+	"HealthMax": attr.MakeKey(testAttrSetID, testAttrHealthMax),
+	"Power":     attr.MakeKey(testAttrSetID, testAttrPower),
+}
+
+type testAttrSet struct {
+	dirty uint64
+	v     [testAttrCount]attr.Value
+}
+
+func (s *testAttrSet) SetID() uint32      { return testAttrSetID }
+func (s *testAttrSet) FieldCount() uint16 { return testAttrCount }
+func (s *testAttrSet) Dirty() uint64      { return s.dirty }
+func (s *testAttrSet) ClearDirty()        { s.dirty = 0 }
+
+func (s *testAttrSet) GetCurrent(field uint16) (float64, bool) {
+	if field >= testAttrCount {
+		return 0, false
+	}
+	return s.v[field].Current, true
+}
+
+func (s *testAttrSet) GetBase(field uint16) (float64, bool) {
+	if field >= testAttrCount {
+		return 0, false
+	}
+	return s.v[field].Base, true
+}
+
+func (s *testAttrSet) SetBase(field uint16, v float64) bool {
+	if field >= testAttrCount {
+		return false
+	}
+	s.v[field].Base = v
+	s.dirty |= 1 << field
+	return true
+}
+
+func (s *testAttrSet) SetCurrent(field uint16, v float64) bool {
+	if field >= testAttrCount {
+		return false
+	}
+	s.v[field].Current = v
+	s.dirty |= 1 << field
+	return true
+}
+
+type attrKv struct {
+	*MockKv
+	t *attr.Table
+}
+
+func (kv *attrKv) Attrs() Attrs {
+	return kv.t
+}
+
+func newAttrKv() *attrKv {
+	kv := &attrKv{MockKv: NewMockKv(), t: &attr.Table{}}
+	kv.t.Init()
+	kv.t.Put(&testAttrSet{})
+	kv.t.SetBase(testAttrNames["Health"], 30)
+	kv.t.SetBase(testAttrNames["HealthMax"], 100)
+	kv.t.SetBase(testAttrNames["Power"], 10)
+	kv.t.AddModifier(attr.Modifier{Source: 1, Attr: testAttrNames["Power"], Op: attr.ModMul, Value: 1.5})
+	kv.t.Flush()
+	return kv
+}
+
+func TestAttrs(t *testing.T) {
+	backends := []Option{WithBackend(BackendClosure), WithBackend(BackendVM)}
+
+	t.Run("读取Current与Base", func(t *testing.T) {
+		for _, backend := range backends {
+			f, err := Compile[string, *attrKv]("Health / HealthMax < 0.35 && Power > Power.base", s2s, WithAttrs(testAttrNames), backend)
+			require.Nil(t, err)
+			v, err := f(newAttrKv())
+			assert.Nil(t, err)
+			b, _ := v.Bool()
+			assert.True(t, b)
+
+			f, err = Compile[string, *attrKv]("int n; Power * n + Power.base", s2s, WithAttrs(testAttrNames), backend)
+			require.Nil(t, err)
+			kv := newAttrKv()
+			kv.SetInt64("n", 2)
+			v, err = f(kv)
+			assert.Nil(t, err)
+			x, _ := v.Float64()
+			assert.Equal(t, 40.0, x)
+		}
+	})
+
+	t.Run("赋值写入Base", func(t *testing.T) {
+		for _, backend := range backends {
+			f, err := Compile[string, *attrKv]("Power = Power.base + 2; Health.base = min(Health + 80, HealthMax)", s2s, WithAttrs(testAttrNames), backend)
+			require.Nil(t, err)
+			kv := newAttrKv()
+			v, err := f(kv)
+			assert.Nil(t, err)
+			x, _ := v.Float64()
+			assert.Equal(t, 100.0, x)
+
+			base, _ := kv.t.GetBase(testAttrNames["Power"])
+			assert.Equal(t, 12.0, base)
+			cur, _ := kv.t.GetCurrent(testAttrNames["Power"])
+			assert.Equal(t, 15.0, cur)
+			kv.t.Flush()
+			cur, _ = kv.t.GetCurrent(testAttrNames["Power"])
+			assert.Equal(t, 18.0, cur)
+			base, _ = kv.t.GetBase(testAttrNames["Health"])
+			assert.Equal(t, 100.0, base)
+		}
+	})
+
+	t.Run("属性不存在", func(t *testing.T) {
+		names := map[string]attr.Key{"Mana": attr.MakeKey(99, 0)}
+		for _, backend := range backends {
+			f, err := Compile[string, *attrKv]("Mana + 1", s2s, WithAttrs(names), backend)
+			require.Nil(t, err)
+			v, err := f(newAttrKv())
+			assert.Nil(t, err)
+			x, _ := v.Float64()
+			assert.Equal(t, 1.0, x)
+
+			for _, code := range []string{"Mana! + 1", "Mana = 1"} {
+				f, err = Compile[string, *attrKv](code, s2s, WithAttrs(names), backend)
+				require.Nil(t, err)
+				_, err = f(newAttrKv())
+				assert.NotNil(t, err, code)
+			}
+		}
+	})
+
+	t.Run("类型化入口", func(t *testing.T) {
+		fb, err := CompileBool[string, *attrKv]("let r = Health / HealthMax; r < 0.35", s2s, WithAttrs(testAttrNames))
+		require.Nil(t, err)
+		b, err := fb(newAttrKv())
+		assert.Nil(t, err)
+		assert.True(t, b)
+
+		ff, err := CompileFloat[string, *attrKv]("Health = Health + 5", s2s, WithAttrs(testAttrNames))
+		require.Nil(t, err)
+		kv := newAttrKv()
+		x, err := ff(kv)
+		assert.Nil(t, err)
+		assert.Equal(t, 35.0, x)
+		base, _ := kv.t.GetBase(testAttrNames["Health"])
+		assert.Equal(t, 35.0, base)
+	})
+
+	t.Run("编译错误", func(t *testing.T) {
+		for _, code := range []string{
+			"float Health; Health",
+			"let Power = 1; Power",
+			"int x; x = Health",
+			"Health && true",
+			"Unknown + 1",
+		} {
+			_, err := Compile[string, *attrKv](code, s2s, WithAttrs(testAttrNames))
+			assert.NotNil(t, err, code)
+		}
+		// 属性名重新声明的错误指向声明
+		for code, span := range map[string]string{
+			"int x; float hp, Health; x": "float hp, Health",
+			"let Power = 1; Power":       "let Power = 1",
+		} {
+			_, err := Compile[string, *attrKv](code, s2s, WithAttrs(testAttrNames))
+			var ce *Error
+			require.True(t, errors.As(err, &ce), code)
+			assert.ErrorContains(t, err, "attribute redefined", code)
+			assert.Equal(t, span, code[ce.Pos:ce.End], code)
+		}
+		// 上下文没有属性表
+		_, err := Compile[string, *MockKv]("Health + 1", s2s, WithAttrs(testAttrNames))
+		assert.NotNil(t, err)
+		// 同名字段对应不同的 Key
+		_, err = Compile[string, *attrKv]("Health", s2s, WithAttrs(testAttrNames, map[string]attr.Key{"Health": 1}))
+		assert.NotNil(t, err)
+		// 没有开启属性绑定时仍然是普通变量
+		_, err = Compile[string, *attrKv]("float Health; Health", s2s)
+		assert.Nil(t, err)
+	})
+
+	t.Run("静态分析", func(t *testing.T) {
+		info, err := Analyze("float r; r = Health / HealthMax! + Health.base; Power.base = 1", WithAttrs(testAttrNames))
+		require.Nil(t, err)
+		health, healthMax, power := testAttrNames["Health"], testAttrNames["HealthMax"], testAttrNames["Power"]
+		// 属性与黑板变量分开报告，Base 与 Current 的读取互不覆盖
+		assert.Empty(t, info.Reads)
+		assert.Empty(t, info.ForceReads)
+		assert.Equal(t, map[string]Type{"r": TypeFloat}, info.Writes)
+		assert.Equal(t, map[AttrRef]struct{}{{health, false}: {}, {health, true}: {}}, info.AttrReads)
+		assert.Equal(t, map[AttrRef]struct{}{{healthMax, false}: {}}, info.AttrForceReads)
+		assert.Equal(t, map[attr.Key]struct{}{power: {}}, info.AttrWrites)
+	})
+}
+
+func BenchmarkAttrs(b *testing.B) {
+	kv := newAttrKv()
+	f, err := CompileBool[string, *attrKv]("Health / HealthMax < 0.35 && Power > 12", s2s, WithAttrs(testAttrNames))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = f(kv)
+	}
+}
@@ -0,0 +1,221 @@
+package cc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/legamerdc/game/lib"
+)
+
+// Program 是缓存中的一个已编译程序，创建后只读，可以被多个 goroutine 同时求值。
+type Program[B any] struct {
+	src  string
+	f    func(B) (lib.Field, error)
+	info *Info
+}
+
+// Source 返回规范化后的源码
+func (p *Program[B]) Source() string {
+	return p.src
+}
+
+func (p *Program[B]) Eval(kv B) (lib.Field, error) {
+	return p.f(kv)
+}
+
+// Info 返回编译时收集的静态分析结果，与对源码调用 Analyze 相同。结果由所有读者共享，
+// 不能修改。
+func (p *Program[B]) Info() *Info {
+	return p.info
+}
+
+// CompileError 是批量编译中单个表达式的错误
+type CompileError struct {
+	Index int    // 表达式在输入中的下标
+	Code  string // 原始源码
+	Err   error
+}
+
+func (e *CompileError) Error() string {
+	return fmt.Sprintf("expr %d %q: %v", e.Index, e.Code, e.Err)
+}
+
+func (e *CompileError) Unwrap() error {
+	return e.Err
+}
+
+// Cache 是共享的表达式缓存。一个 Cache 绑定一个 Key 映射和一组编译选项，
+// 以规范化后的源码（去掉空白差异的 token 序列）为键，文本相同的表达式只编译一次。
+//
+// 读取走原子加载的只读快照，不加锁；写入在互斥锁下复制快照后整体替换，
+// 因此 Reload 对读者是原子的：读者要么看到旧的整张表，要么看到新的整张表。
+type Cache[K any, B Ctx[K]] struct {
+	key  Key[K]
+	opts []Option
+	mu   sync.Mutex
+	m    atomic.Pointer[map[string]*Program[B]]
+}
+
+func NewCache[K any, B Ctx[K]](key Key[K], opts ...Option) *Cache[K, B] {
+	c := &Cache[K, B]{key: key, opts: opts}
+	c.m.Store(&map[string]*Program[B]{})
+	return c
+}
+
+// Len 返回缓存中的程序个数
+func (c *Cache[K, B]) Len() int {
+	return len(*c.m.Load())
+}
+
+// Get 返回 code 对应的程序，未命中时编译并加入缓存。编译错误不会被缓存。
+func (c *Cache[K, B]) Get(code string) (*Program[B], error) {
+	src := normalize(code)
+	if p, ok := (*c.m.Load())[src]; ok {
+		return p, nil
+	}
+	p, e := c.compile(src, code)
+	if e != nil {
+		return nil, e
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old := *c.m.Load()
+	if q, ok := old[src]; ok {
+		// 并发编译了同一段代码，保留先写入的
+		return q, nil
+	}
+	m := maps.Clone(old)
+	m[src] = p
+	c.m.Store(&m)
+	return p, nil
+}
+
+// CompileAll 批量编译 codes 并加入缓存，通常在启动时对整张配置表调用。
+// 所有表达式都会被尝试编译，返回的错误由每个失败表达式的 *CompileError 合并而成；
+// 编译成功的表达式即使有其它失败也会加入缓存。
+func (c *Cache[K, B]) CompileAll(codes []string) error {
+	ps, e := c.compileAll(codes)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := maps.Clone(*c.m.Load())
+	maps.Copy(m, ps)
+	c.m.Store(&m)
+	return e
+}
+
+// Reload 用 codes 重建整个缓存。只要有一个表达式编译失败，缓存保持不变并返回合并的错误；
+// 全部成功时一次性替换，之前取得的 Program 仍然可以继续使用。
+func (c *Cache[K, B]) Reload(codes []string) error {
+	ps, e := c.compileAll(codes)
+	if e != nil {
+		return e
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.m.Store(&ps)
+	return nil
+}
+
+// Watch 每隔 interval 检查 paths 的修改时间和大小，发生变化时调用 load 取得新的表达式列表
+// 并 Reload，结果通过 onReload 通知（可以为 nil）。Watch 阻塞直到 ctx 结束。
+func (c *Cache[K, B]) Watch(ctx context.Context, interval time.Duration, load func() ([]string, error), onReload func(error), paths ...string) {
+	stats := _stats(paths)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		now := _stats(paths)
+		if now == stats {
+			continue
+		}
+		stats = now
+		codes, e := load()
+		if e == nil {
+			e = c.Reload(codes)
+		}
+		if onReload != nil {
+			onReload(e)
+		}
+	}
+}
+
+// compile 编译原始源码 code，使错误的 Pos/End 指向调用方给出的文本；src 只用作缓存的键
+func (c *Cache[K, B]) compile(src, code string) (*Program[B], error) {
+	o := ctxOptions[B](c.opts)
+	t, e := check(code, o)
+	if e != nil {
+		return nil, e
+	}
+	f, e := compileBackend[K, B](t, o, c.key)
+	if e != nil {
+		return nil, e
+	}
+	return &Program[B]{src: src, f: f, info: t.info()}, nil
+}
+
+func (c *Cache[K, B]) compileAll(codes []string) (map[string]*Program[B], error) {
+	var (
+		es []error
+		ps = make(map[string]*Program[B], len(codes))
+	)
+	for i, code := range codes {
+		src := normalize(code)
+		if _, ok := ps[src]; ok {
+			continue
+		}
+		p, e := c.compile(src, code)
+		if e != nil {
+			es = append(es, &CompileError{Index: i, Code: code, Err: e})
+			continue
+		}
+		ps[src] = p
+	}
+	return ps, errors.Join(es...)
+}
+
+// normalize 把源码规范化为以单个空格分隔的 token 序列，词法错误时原样返回
+func normalize(code string) string {
+	var (
+		sb strings.Builder
+		lv yySymType
+		l  = NewLexer(code)
+	)
+	for {
+		p := l.pos
+		if l.Lex(&lv) == 0 {
+			break
+		}
+		if sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(strings.TrimSpace(code[p:l.pos]))
+	}
+	if l.e != nil {
+		return code
+	}
+	return sb.String()
+}
+
+// _stats 把每个文件的修改时间和大小拼成一个可比较的指纹，文件不存在时记为空
+func _stats(paths []string) string {
+	var sb strings.Builder
+	for _, path := range paths {
+		if fi, e := os.Stat(path); e == nil {
+			fmt.Fprintf(&sb, "%d:%d;", fi.ModTime().UnixNano(), fi.Size())
+		} else {
+			sb.WriteString("-;")
+		}
+	}
+	return sb.String()
+}
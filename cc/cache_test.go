@@ -0,0 +1,177 @@
+package cc
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, "int x , y ; x + y * 2", normalize("int x,y;x+y*2"))
+	assert.Equal(t, normalize("int x,y;x+y*2"), normalize("  int x , y;\n\tx + y *2 "))
+	assert.Equal(t, `string s ; s == "a b"`, normalize(`string s;s=="a b"`))
+	assert.NotEqual(t, normalize(`string s;s=="a b"`), normalize(`string s;s=="ab"`))
+	// 词法错误时原样返回
+	assert.Equal(t, "x & y", normalize("x & y"))
+}
+
+func TestCache(t *testing.T) {
+	t.Run("文本相同的表达式只编译一次", func(t *testing.T) {
+		c := NewCache[string, *MockKv](s2s)
+		p0, err := c.Get("int x; x + 1")
+		require.Nil(t, err)
+		p1, err := c.Get("int x;x+1")
+		require.Nil(t, err)
+		assert.Same(t, p0, p1)
+		assert.Equal(t, 1, c.Len())
+
+		kv := NewMockKv()
+		kv.SetInt64("x", 2)
+		v, err := p1.Eval(kv)
+		assert.Nil(t, err)
+		iv, _ := v.Int64()
+		assert.Equal(t, int64(3), iv)
+
+		_, err = c.Get("int x; x +")
+		assert.NotNil(t, err)
+		assert.Equal(t, 1, c.Len())
+	})
+
+	t.Run("批量编译合并错误", func(t *testing.T) {
+		c := NewCache[string, *MockKv](s2s)
+		err := c.CompileAll([]string{
+			"int x; x + 1",
+			"bool a; int b; a + b",
+			"int x; x+1",
+			"float hp, hp_max; hp / hp_max < 0.35",
+			"x &",
+		})
+		require.NotNil(t, err)
+		assert.Equal(t, 2, c.Len())
+
+		var ce *CompileError
+		require.True(t, errors.As(err, &ce))
+		assert.Equal(t, 1, ce.Index)
+		assert.Contains(t, err.Error(), "expr 1")
+		assert.Contains(t, err.Error(), "expr 4")
+	})
+
+	t.Run("错误位置指向原始源码", func(t *testing.T) {
+		code := "int x;\n\n    x +    y"
+		c := NewCache[string, *MockKv](s2s)
+		_, err := c.Get(code)
+		var pe *Error
+		require.True(t, errors.As(err, &pe))
+		assert.Equal(t, "y", code[pe.Pos:pe.End])
+
+		err = c.CompileAll([]string{code})
+		var ce *CompileError
+		require.True(t, errors.As(err, &ce))
+		require.True(t, errors.As(err, &pe))
+		assert.Equal(t, "y", ce.Code[pe.Pos:pe.End])
+	})
+
+	t.Run("Reload原子替换", func(t *testing.T) {
+		c := NewCache[string, *MockKv](s2s)
+		require.Nil(t, c.CompileAll([]string{"int x; x", "int y; y"}))
+		old, _ := c.Get("int x; x")
+
+		// 有错误时保持不变
+		assert.NotNil(t, c.Reload([]string{"int z; z", "int z; z +"}))
+		assert.Equal(t, 2, c.Len())
+
+		require.Nil(t, c.Reload([]string{"int z; z"}))
+		assert.Equal(t, 1, c.Len())
+		// 之前取得的程序仍然可用
+		_, err := old.Eval(NewMockKv())
+		assert.Nil(t, err)
+	})
+
+	t.Run("并发读写", func(t *testing.T) {
+		c := NewCache[string, *MockKv](s2s)
+		var wg sync.WaitGroup
+		ps := make([]*Program[*MockKv], 16)
+		for i := range ps {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					p, err := c.Get("int x; x * 2")
+					assert.Nil(t, err)
+					ps[i] = p
+				}
+				if i%4 == 0 {
+					assert.Nil(t, c.Reload([]string{"int x; x * 2"}))
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, 1, c.Len())
+	})
+
+	t.Run("静态分析随程序缓存", func(t *testing.T) {
+		c := NewCache[string, *MockKv](s2s)
+		p, err := c.Get("int hp, hp_max; float r; r = hp / hp_max; r < 0.35")
+		require.Nil(t, err)
+		info, err := Analyze(p.Source())
+		require.Nil(t, err)
+		assert.Equal(t, info, p.Info())
+		assert.Equal(t, map[string]Type{"r": TypeFloat}, p.Info().Writes)
+	})
+}
+
+func TestCacheWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exprs.txt")
+	require.Nil(t, os.WriteFile(path, []byte("int x; x"), 0o644))
+	load := func() ([]string, error) {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Split(strings.TrimSpace(string(b)), "\n"), nil
+	}
+
+	c := NewCache[string, *MockKv](s2s)
+	codes, _ := load()
+	require.Nil(t, c.Reload(codes))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloaded := make(chan error, 4)
+	go c.Watch(ctx, time.Millisecond, load, func(err error) { reloaded <- err }, path)
+
+	time.Sleep(5 * time.Millisecond)
+	require.Nil(t, os.WriteFile(path, []byte("int x; x\nint y; y + 1\n"), 0o644))
+	select {
+	case err := <-reloaded:
+		assert.Nil(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("reload not triggered")
+	}
+	assert.Equal(t, 2, c.Len())
+}
+
+func BenchmarkCacheGet(b *testing.B) {
+	c := NewCache[string, *MockKv](s2s)
+	codes := make([]string, 1000)
+	for i := range codes {
+		codes[i] = "int x, y; x * " + strings.Repeat("y + ", i%10) + "1"
+	}
+	if err := c.CompileAll(codes); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = c.Get(codes[7])
+		}
+	})
+}
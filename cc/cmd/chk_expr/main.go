@@ -0,0 +1,303 @@
+// chk_expr 检查表达式配置：从文本、TOML 或 CSV 中读取表达式，按声明的变量类型做语法分析和
+// 类型检查，输出带位置的诊断信息；-fmt 时输出每个表达式的规范形式。
+//
+//	chk_expr [-keys cond,formula] [-tags tags.txt] [-attrs attrs.toml] [-fmt] file...
+//
+// 文本文件每一行是一个表达式，空行和以 # 开头的行被忽略；TOML 文件中名字在 -keys 中的字符串
+// 值是表达式；CSV 文件第一行是表头，列名在 -keys 中的单元格是表达式。
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/legamerdc/game/attr"
+	"github.com/legamerdc/game/cc"
+	"github.com/legamerdc/game/tag"
+)
+
+// Expr 是从配置中读出的一个表达式
+type Expr struct {
+	File  string
+	Where string // TOML 的键路径或 CSV 的列名@行号，文本文件为空
+	Line  int    // 文本文件中表达式所在的行号
+	Code  string
+}
+
+// Loc 返回表达式中字节偏移 off 的位置，文本文件为 file:line:col，其它为 file:where:line:col，
+// 行号与列号是相对表达式的
+func (e Expr) Loc(off int) string {
+	line, col := cc.Position(e.Code, off)
+	if e.Where == "" {
+		return fmt.Sprintf("%s:%d:%d", e.File, e.Line+line-1, col)
+	}
+	return fmt.Sprintf("%s:%s:%d:%d", e.File, e.Where, line, col)
+}
+
+// Name 返回表达式本身的位置
+func (e Expr) Name() string {
+	if e.Where == "" {
+		return fmt.Sprintf("%s:%d", e.File, e.Line)
+	}
+	return e.File + ":" + e.Where
+}
+
+// ReadText 读取文本文件，每个非空、不以 # 开头的行是一个表达式
+func ReadText(path string, r io.Reader) ([]Expr, error) {
+	var (
+		es []Expr
+		s  = bufio.NewScanner(r)
+	)
+	for line := 1; s.Scan(); line++ {
+		code := s.Text()
+		if t := strings.TrimSpace(code); t == "" || strings.HasPrefix(t, "#") {
+			continue
+		}
+		es = append(es, Expr{File: path, Line: line, Code: code})
+	}
+	return es, s.Err()
+}
+
+// ReadTOML 读取 TOML 文件中名字在 keys 中的字符串值，按键路径排序
+func ReadTOML(path string, r io.Reader, keys []string) ([]Expr, error) {
+	var doc map[string]any
+	if _, err := toml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	var es []Expr
+	walkTOML(path, "", doc, keys, &es)
+	return es, nil
+}
+
+func walkTOML(path, prefix string, v any, keys []string, es *[]Expr) {
+	switch v := v.(type) {
+	case map[string]any:
+		names := make([]string, 0, len(v))
+		for k := range v {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			where := k
+			if prefix != "" {
+				where = prefix + "." + k
+			}
+			if s, ok := v[k].(string); ok {
+				if slices.Contains(keys, k) {
+					*es = append(*es, Expr{File: path, Where: where, Code: s})
+				}
+				continue
+			}
+			walkTOML(path, where, v[k], keys, es)
+		}
+	case []map[string]any:
+		for i, x := range v {
+			walkTOML(path, prefix+"["+strconv.Itoa(i)+"]", x, keys, es)
+		}
+	case []any:
+		for i, x := range v {
+			walkTOML(path, prefix+"["+strconv.Itoa(i)+"]", x, keys, es)
+		}
+	}
+}
+
+// ReadCSV 读取 CSV 文件中列名在 keys 中的单元格，行号从表头的 1 开始计算，与表格软件一致
+func ReadCSV(path string, r io.Reader, keys []string) ([]Expr, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	var cols []int
+	for i, name := range rows[0] {
+		if slices.Contains(keys, strings.TrimSpace(name)) {
+			cols = append(cols, i)
+		}
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("%s: no column named %s", path, strings.Join(keys, ","))
+	}
+	var es []Expr
+	for r, row := range rows[1:] {
+		for _, c := range cols {
+			if c >= len(row) || strings.TrimSpace(row[c]) == "" {
+				continue
+			}
+			where := fmt.Sprintf("%s@%d", strings.TrimSpace(rows[0][c]), r+2)
+			es = append(es, Expr{File: path, Where: where, Code: row[c]})
+		}
+	}
+	return es, nil
+}
+
+// ReadFile 按扩展名选择格式读取表达式
+func ReadFile(path string, keys []string) ([]Expr, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("%s: -keys is required for TOML", path)
+		}
+		return ReadTOML(path, f, keys)
+	case ".csv":
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("%s: -keys is required for CSV", path)
+		}
+		return ReadCSV(path, f, keys)
+	}
+	return ReadText(path, f)
+}
+
+// Check 对表达式做语法分析和类型检查，返回诊断信息，没有错误时返回空串。
+// 诊断的第一行是位置和错误，之后是出错的源码行和指向出错片段的 ^。
+func Check(e Expr, opts ...cc.Option) string {
+	_, err := cc.Analyze(e.Code, opts...)
+	if err == nil {
+		return ""
+	}
+	var pe *cc.Error
+	if !errors.As(err, &pe) {
+		return fmt.Sprintf("%s: %v\n", e.Name(), err)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: %v\n", e.Loc(pe.Pos), err)
+	// 出错片段所在的源码行
+	begin := strings.LastIndexByte(e.Code[:pe.Pos], '\n') + 1
+	end := strings.IndexByte(e.Code[pe.Pos:], '\n')
+	if end < 0 {
+		end = len(e.Code)
+	} else {
+		end += pe.Pos
+	}
+	sb.WriteString("\t" + e.Code[begin:end] + "\n\t")
+	for i := begin; i < pe.Pos; i++ {
+		if e.Code[i] == '\t' {
+			sb.WriteByte('\t')
+		} else {
+			sb.WriteByte(' ')
+		}
+	}
+	sb.WriteString(strings.Repeat("^", max(min(pe.End, end)-pe.Pos, 1)) + "\n")
+	return sb.String()
+}
+
+// LoadTags 从文本文件构建标签字典，每行一个标签
+func LoadTags(path string) (*tag.DB, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for line := range strings.Lines(string(b)) {
+		if t := strings.TrimSpace(line); t != "" && !strings.HasPrefix(t, "#") {
+			tags = append(tags, t)
+		}
+	}
+	return tag.Build(slices.Values(tags))
+}
+
+// LoadAttrs 从 mk_attr 的 TOML 配置中读取属性名
+func LoadAttrs(paths []string) (map[string]attr.Key, error) {
+	type set struct {
+		SetID  uint32 `toml:"set_id"`
+		Fields map[string]struct {
+			ID uint16 `toml:"id"`
+		} `toml:"fields"`
+	}
+	names := make(map[string]attr.Key)
+	for _, p := range paths {
+		var sets map[string]set
+		if _, err := toml.DecodeFile(p, &sets); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", p, err)
+		}
+		for _, s := range sets {
+			for name, f := range s.Fields {
+				names[name] = attr.MakeKey(s.SetID, f.ID)
+			}
+		}
+	}
+	return names, nil
+}
+
+func _split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func main() {
+	keys := flag.String("keys", "", "comma-separated TOML keys / CSV columns holding expressions")
+	tags := flag.String("tags", "", "tag list file, one tag per line, enables has_tag")
+	attrs := flag.String("attrs", "", "comma-separated mk_attr TOML configs, enables attribute names")
+	canonical := flag.Bool("fmt", false, "print the canonical form of every valid expression")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "error: at least one expression file is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var opts []cc.Option
+	if *tags != "" {
+		db, err := LoadTags(*tags)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+		opts = append(opts, cc.WithTags(db))
+	}
+	if *attrs != "" {
+		names, err := LoadAttrs(_split(*attrs))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+		opts = append(opts, cc.WithAttrs(names))
+	}
+
+	var total, failed int
+	for _, path := range flag.Args() {
+		es, err := ReadFile(path, _split(*keys))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(2)
+		}
+		for _, e := range es {
+			total++
+			if d := Check(e, opts...); d != "" {
+				failed++
+				fmt.Print(d)
+				continue
+			}
+			if *canonical {
+				s, _ := cc.Format(e.Code)
+				fmt.Printf("%s\t%s\n", e.Name(), s)
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d expressions, %d errors\n", total, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
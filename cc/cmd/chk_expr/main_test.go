@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/legamerdc/game/attr"
+	"github.com/legamerdc/game/cc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadText(t *testing.T) {
+	es, err := ReadText("e.txt", strings.NewReader("int hp; hp < 30\n\n# comment\nint x; x +\n"))
+	require.NoError(t, err)
+	require.Len(t, es, 2)
+	assert.Equal(t, Expr{File: "e.txt", Line: 1, Code: "int hp; hp < 30"}, es[0])
+	assert.Equal(t, 4, es[1].Line)
+}
+
+func TestReadTOML(t *testing.T) {
+	data := `
+[buff]
+cond = "int hp; hp < 30"
+note = "not an expression"
+
+[[skills]]
+cond = "bool a; a"
+[skills.damage]
+formula = "float atk; atk * 2"
+
+[[skills]]
+cond = "bool b; b"
+`
+	es, err := ReadTOML("s.toml", strings.NewReader(data), []string{"cond", "formula"})
+	require.NoError(t, err)
+	var wheres []string
+	for _, e := range es {
+		wheres = append(wheres, e.Where)
+	}
+	assert.Equal(t, []string{"buff.cond", "skills[0].cond", "skills[0].damage.formula", "skills[1].cond"}, wheres)
+	assert.Equal(t, "float atk; atk * 2", es[2].Code)
+
+	_, err = ReadTOML("s.toml", strings.NewReader("a = "), []string{"cond"})
+	assert.Error(t, err)
+}
+
+func TestReadCSV(t *testing.T) {
+	data := "id,cond,formula\n1,int a; a > 1,\n2,,\"string s; s == \"\"x\"\"\"\n"
+	es, err := ReadCSV("s.csv", strings.NewReader(data), []string{"cond", "formula"})
+	require.NoError(t, err)
+	require.Len(t, es, 2)
+	assert.Equal(t, "cond@2", es[0].Where)
+	assert.Equal(t, "formula@3", es[1].Where)
+	assert.Equal(t, `string s; s == "x"`, es[1].Code)
+
+	_, err = ReadCSV("s.csv", strings.NewReader(data), []string{"missing"})
+	assert.Error(t, err)
+}
+
+func TestCheck(t *testing.T) {
+	assert.Equal(t, "", Check(Expr{File: "e.txt", Line: 3, Code: "int hp; hp < 30"}))
+
+	d := Check(Expr{File: "e.txt", Line: 3, Code: "int hp;\thp < 30 && hpp > 2"})
+	assert.Equal(t, "e.txt:3:20: variable undefined: hpp\n\tint hp;\thp < 30 && hpp > 2\n\t       \t           ^^^\n", d)
+
+	// 多行表达式的位置相对表达式本身
+	d = Check(Expr{File: "s.toml", Where: "skills[1].cond", Code: "int hp;\nhp < 30 &&\n  x > 1"})
+	assert.True(t, strings.HasPrefix(d, "s.toml:skills[1].cond:3:3: variable undefined: x\n\t  x > 1\n\t  ^\n"), d)
+
+	d = Check(Expr{File: "e.txt", Line: 1, Code: "int x; x +"})
+	assert.True(t, strings.HasPrefix(d, "e.txt:1:11: "), d)
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "attrs.toml")
+	require.NoError(t, os.WriteFile(p, []byte(`[combat]
+set_id = 3
+
+[combat.fields]
+Health = { id = 0, type = "attribute" }
+Power = { id = 1, type = "attribute" }
+`), 0644))
+	names, err := LoadAttrs([]string{p})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]attr.Key{"Health": attr.MakeKey(3, 0), "Power": attr.MakeKey(3, 1)}, names)
+
+	tp := filepath.Join(dir, "tags.txt")
+	require.NoError(t, os.WriteFile(tp, []byte("state.stunned\n# comment\nbuff.haste\n"), 0644))
+	db, err := LoadTags(tp)
+	require.NoError(t, err)
+
+	e := Expr{File: "e.txt", Line: 1, Code: "Health.base > 10 && has_tag('state')"}
+	assert.NotEqual(t, "", Check(e))
+	assert.Equal(t, "", Check(e, cc.WithAttrs(names), cc.WithTags(db)))
+}
@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"math"
 	"strconv"
+	"sync"
 
+	"github.com/legamerdc/game/attr"
 	"github.com/legamerdc/game/lib"
+	"github.com/legamerdc/game/tag"
 )
 
 var (
@@ -15,6 +18,8 @@ var (
 	fmtKeyMiss      = "key not set: %s"
 	fmtConstFormat  = "number ill format: %s"
 	fmtIllFunc      = "ill func: %s"
+	fmtDeclInBlock  = "declaration not allowed in block: %s"
+	fmtLocalDefined = "local variable redefined: %s"
 )
 
 type (
@@ -27,6 +32,37 @@ type (
 	}
 
 	Key[K any] func(string) K
+
+	// Option 调整一次编译的行为
+	Option func(*options)
+
+	options struct {
+		funcs   *Funcs
+		backend Backend
+		rand    bool // 求值上下文实现了 RandCtx
+		attr    bool // 求值上下文实现了 AttrCtx
+		attrs   map[string]attr.Key
+		attrErr error
+		tag     bool // 求值上下文实现了 TagCtx
+		tags    *tag.DB
+		fixed   bool // float 使用定点数，见 WithFixed
+		safe    bool // 检查运行时错误，见 WithSafe
+	}
+
+	// tree 是类型推断完成后的程序
+	tree struct {
+		root   *Node
+		vars   map[string]exprType
+		locals int      // let 局部变量的槽位数
+		ret    exprType // 程序返回值的类型，即最后一条语句的类型
+		vec    bool     // 程序使用了向量，只能由闭包后端执行
+	}
+
+	// frame 是一次求值的上下文：黑板与 let 局部变量的槽位
+	frame[B any] struct {
+		kv B
+		l  []lib.Field
+	}
 )
 
 const (
@@ -34,20 +70,92 @@ const (
 	exprInt
 	exprFloat
 	exprBool
+	exprString
+	exprFixed // WithFixed 时 float 在类型推断完成后改写为定点类型
+	exprVec2
+	exprVec3
 )
 
-func MustCompile[K any, B Ctx[K]](code string, key Key[K]) func(kv B) (lib.Field, error) {
-	f, e := Compile[K, B](code, key)
+// Type 是表达式语言中值的静态类型
+type Type = exprType
+
+const (
+	TypeInt    = exprInt
+	TypeFloat  = exprFloat
+	TypeBool   = exprBool
+	TypeString = exprString
+	TypeVec2   = exprVec2
+	TypeVec3   = exprVec3
+)
+
+func (t exprType) String() string {
+	switch t {
+	case exprInt:
+		return "int"
+	case exprFloat:
+		return "float"
+	case exprBool:
+		return "bool"
+	case exprString:
+		return "string"
+	case exprFixed:
+		return "fixed"
+	case exprVec2:
+		return "vec2"
+	case exprVec3:
+		return "vec3"
+	}
+	return "unknown"
+}
+
+// WithFuncs 指定编译期函数表，默认使用内置数学函数表。传入 nil 时所有函数调用都走 Ctx.Exec。
+func WithFuncs(fs *Funcs) Option {
+	return func(o *options) {
+		o.funcs = fs
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{funcs: mathFuncs}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func MustCompile[K any, B Ctx[K]](code string, key Key[K], opts ...Option) func(kv B) (lib.Field, error) {
+	f, e := Compile[K, B](code, key, opts...)
 	if e != nil {
 		panic(e)
 	}
 	return f
 }
 
-func Compile[K any, B Ctx[K]](code string, key Key[K]) (f func(kv B) (lib.Field, error), e error) {
+func Compile[K any, B Ctx[K]](code string, key Key[K], opts ...Option) (f func(kv B) (lib.Field, error), e error) {
 	var (
-		n *Node
-		m map[string]exprType
+		t *tree
+		o = ctxOptions[B](opts)
+	)
+	if t, e = check(code, o); e != nil {
+		return nil, e
+	}
+	return compileBackend[K, B](t, o, key)
+}
+
+// compileBackend 用 o 选择的后端编译检查过的语法树，定点、安全模式与向量只有闭包后端支持
+func compileBackend[K any, B Ctx[K]](t *tree, o *options, key Key[K]) (func(B) (lib.Field, error), error) {
+	if o.backend == BackendVM && !o.fixed && !o.safe && !t.vec {
+		return compileVM[K, B](t, key)
+	}
+	return compileTree[K, B](t, key)
+}
+
+// check 完成语法分析、变量分析和类型推断，返回带类型标注的语法树
+func check(code string, o *options) (t *tree, e error) {
+	var (
+		n      *Node
+		m      map[string]exprType
+		locals int
 	)
 	if n, e = parse(code); e != nil {
 		return nil, e
@@ -56,23 +164,79 @@ func Compile[K any, B Ctx[K]](code string, key Key[K]) (f func(kv B) (lib.Field,
 	//	return nil, errors.New("invalid expression")
 	//}
 	//n = n.Children[0]
-	//fmt.Println(dfs(n, 0))
 	if m, e = n.phaseVar(); e != nil {
 		return nil, e
 	}
-	if _, e = n.phaseInfectUp(m); e != nil {
+	if locals, e = n.phaseLocal(m); e != nil {
+		return nil, e
+	}
+	if e = n.checkRand(o); e != nil {
+		return nil, e
+	}
+	if e = n.phaseAttr(m, o); e != nil {
+		return nil, e
+	}
+	if e = n.phaseTag(o); e != nil {
+		return nil, e
+	}
+	if _, e = n.phaseInfectUp(m, o.funcs); e != nil {
 		return nil, e
 	}
 	if e = n.phaseInfectDown(m, 0); e != nil {
 		return nil, e
 	}
-	return compile[K, B](n, m, key)
+	v := n.findVec()
+	if o.fixed {
+		if v != nil {
+			return nil, v.errorf(fmtVecFixed, v.Target)
+		}
+		n.phaseFixed(m)
+	}
+	if o.safe {
+		n.phaseSafe()
+	}
+	t = &tree{root: n, vars: m, locals: locals, vec: v != nil}
+	for _, x := range n.Children {
+		if x.Type != NodeVarDecl {
+			t.ret = x.Target
+		}
+	}
+	return t, nil
 }
 
-func compile[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (f func(B) (lib.Field, error), e error) {
+// compileTree 生成闭包，并在每次求值时准备 frame。没有局部变量的程序不需要槽位，
+// 有局部变量时槽位从 sync.Pool 复用，避免每次求值分配。
+func compileTree[K any, B Ctx[K]](t *tree, k Key[K]) (func(B) (lib.Field, error), error) {
+	f, e := compile[K, B](t.root, t.vars, k)
+	if e != nil {
+		return nil, e
+	}
+	return _frame(f, t.locals), nil
+}
+
+func _frame[B, X any](f func(frame[B]) (X, error), locals int) func(B) (X, error) {
+	if locals == 0 {
+		return func(kv B) (X, error) {
+			return f(frame[B]{kv: kv})
+		}
+	}
+	pool := &sync.Pool{New: func() any {
+		l := make([]lib.Field, locals)
+		return &l
+	}}
+	return func(kv B) (X, error) {
+		l := pool.Get().(*[]lib.Field)
+		v, e := f(frame[B]{kv: kv, l: *l})
+		clear(*l)
+		pool.Put(l)
+		return v, e
+	}
+}
+
+func compile[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (f func(frame[B]) (lib.Field, error), e error) {
 	switch n.Type {
-	case NodeProgram:
-		fs := make([]func(B) (lib.Field, error), 0, len(n.Children)+1)
+	case NodeProgram, NodeBlock:
+		fs := make([]func(frame[B]) (lib.Field, error), 0, len(n.Children)+1)
 		for _, x := range n.Children {
 			if x.Type != NodeVarDecl {
 				if f, e = compile[K, B](x, m, k); e != nil {
@@ -100,44 +264,79 @@ func compile[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (f func(
 		return compileNumber[K, B](n, m)
 	case NodeBool:
 		return compileBool[K, B](n, m)
+	case NodeString:
+		return compileString[K, B](n, m)
+	case NodeIf:
+		return compileIf[K, B](n, m, k)
+	case NodeLet:
+		return compileLet[K, B](n, m, k)
+	case NodeBuiltin:
+		return compileBuiltin[K, B](n, m, k)
+	case NodeMember:
+		return compileMember[K, B](n, m, k)
+	case nodeProbe:
+		return n.probe.(func(frame[B]) (lib.Field, error)), nil
 	default:
 	}
 	panic("unreachable")
 }
 
-func compileAssign[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (fr func(B) (lib.Field, error), e error) {
-	var f func(B) (lib.Field, error)
+func compileAssign[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (fr func(frame[B]) (lib.Field, error), e error) {
+	var f func(frame[B]) (lib.Field, error)
 	if f, e = compile[K, B](n.Children[0], m, k); e != nil {
 		return nil, e
 	}
+	if n.local != nil {
+		return compileAssignLocal(n, f), nil
+	}
+	if n.attr != nil {
+		return compileAssignAttr(n, f), nil
+	}
 	token := n.Token
 	key := k(token)
 	switch n.Target {
 	case exprInt:
-		return func(b B) (v lib.Field, e error) {
+		return func(b frame[B]) (v lib.Field, e error) {
 			if v, e = f(b); e != nil {
 				return
 			}
 			vv, _ := v.Int64()
-			b.Set(key, lib.Int64(vv))
+			b.kv.Set(key, lib.Int64(vv))
 			return v, nil
 		}, nil
 	case exprFloat:
-		return func(b B) (v lib.Field, e error) {
+		return func(b frame[B]) (v lib.Field, e error) {
 			if v, e = f(b); e != nil {
 				return
 			}
 			vv, _ := v.Float64()
-			b.Set(key, lib.Float64(vv))
+			b.kv.Set(key, lib.Float64(vv))
 			return v, nil
 		}, nil
 	case exprBool:
-		return func(b B) (v lib.Field, e error) {
+		return func(b frame[B]) (v lib.Field, e error) {
 			if v, e = f(b); e != nil {
 				return
 			}
 			vv, _ := v.Bool()
-			b.Set(key, lib.Bool(vv))
+			b.kv.Set(key, lib.Bool(vv))
+			return v, nil
+		}, nil
+	case exprString, exprVec2, exprVec3:
+		return func(b frame[B]) (v lib.Field, e error) {
+			if v, e = f(b); e != nil {
+				return
+			}
+			b.kv.Set(key, v)
+			return v, nil
+		}, nil
+	case exprFixed:
+		return func(b frame[B]) (v lib.Field, e error) {
+			if v, e = f(b); e != nil {
+				return
+			}
+			vv, _ := v.Fixed()
+			b.kv.Set(key, lib.Fixed(vv))
 			return v, nil
 		}, nil
 	default:
@@ -145,8 +344,63 @@ func compileAssign[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (f
 	}
 }
 
-func compileUnary[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (fr func(B) (lib.Field, error), e error) {
-	var f func(B) (lib.Field, error)
+func compileAssignLocal[B any](n *Node, f func(frame[B]) (lib.Field, error)) func(frame[B]) (lib.Field, error) {
+	slot := n.local.slot
+	switch n.Target {
+	case exprInt:
+		return func(b frame[B]) (v lib.Field, e error) {
+			if v, e = f(b); e != nil {
+				return
+			}
+			vv, _ := v.Int64()
+			b.l[slot] = lib.Int64(vv)
+			return v, nil
+		}
+	case exprFloat:
+		return func(b frame[B]) (v lib.Field, e error) {
+			if v, e = f(b); e != nil {
+				return
+			}
+			vv, _ := v.Float64()
+			b.l[slot] = lib.Float64(vv)
+			return v, nil
+		}
+	case exprBool:
+		return func(b frame[B]) (v lib.Field, e error) {
+			if v, e = f(b); e != nil {
+				return
+			}
+			vv, _ := v.Bool()
+			b.l[slot] = lib.Bool(vv)
+			return v, nil
+		}
+	case exprString, exprVec2, exprVec3:
+		return func(b frame[B]) (v lib.Field, e error) {
+			if v, e = f(b); e != nil {
+				return
+			}
+			b.l[slot] = v
+			return v, nil
+		}
+	case exprFixed:
+		return func(b frame[B]) (v lib.Field, e error) {
+			if v, e = f(b); e != nil {
+				return
+			}
+			vv, _ := v.Fixed()
+			b.l[slot] = lib.Fixed(vv)
+			return v, nil
+		}
+	default:
+		panic("unreachable")
+	}
+}
+
+func compileUnary[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (fr func(frame[B]) (lib.Field, error), e error) {
+	if n.Token == "-" && _isVec(n.Target) {
+		return compileVecBoxed[K, B](n, m, k)
+	}
+	var f func(frame[B]) (lib.Field, error)
 	if f, e = compile[K, B](n.Children[0], m, k); e != nil {
 		return nil, e
 	}
@@ -154,8 +408,17 @@ func compileUnary[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (fr
 	case "+":
 		return f, nil
 	case "-":
+		if n.Target == exprFixed {
+			return func(b frame[B]) (v lib.Field, e error) {
+				if v, e = f(b); e != nil {
+					return
+				}
+				vv, _ := v.Fixed()
+				return lib.Fixed(vv.Neg()), nil
+			}, nil
+		}
 		if n.Target == exprFloat {
-			return func(b B) (v lib.Field, e error) {
+			return func(b frame[B]) (v lib.Field, e error) {
 				if v, e = f(b); e != nil {
 					return
 				}
@@ -163,7 +426,10 @@ func compileUnary[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (fr
 				return lib.Float64(-vv), nil
 			}, nil
 		}
-		return func(b B) (v lib.Field, e error) {
+		if n.safe {
+			return safeNeg(n, f, false), nil
+		}
+		return func(b frame[B]) (v lib.Field, e error) {
 			if v, e = f(b); e != nil {
 				return
 			}
@@ -171,7 +437,7 @@ func compileUnary[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (fr
 			return lib.Int64(-vv), nil
 		}, nil
 	case "!":
-		return func(b B) (v lib.Field, e error) {
+		return func(b frame[B]) (v lib.Field, e error) {
 			if v, e = f(b); e != nil {
 				return
 			}
@@ -183,17 +449,36 @@ func compileUnary[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (fr
 	}
 }
 
-func compileBinary[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (func(B) (lib.Field, error), error) {
+func compileBinary[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (func(frame[B]) (lib.Field, error), error) {
+	if _isVec(n.Target) {
+		return compileVecBoxed[K, B](n, m, k)
+	}
+	if _isVec(n.Children[0].Target) {
+		return compileVecEqual[K, B](n, m, k)
+	}
 	f0, e0 := compile[K, B](n.Children[0], m, k)
 	f1, e1 := compile[K, B](n.Children[1], m, k)
 	if e := errors.Join(e0, e1); e != nil {
 		return nil, e
 	}
+	if n.Children[0].Target == exprString {
+		op := binString(n.Token)
+		return func(b frame[B]) (v lib.Field, e error) {
+			v0, e0 := f0(b)
+			v1, e1 := f1(b)
+			if e = errors.Join(e0, e1); e != nil {
+				return
+			}
+			vv0, _ := v0.Str()
+			vv1, _ := v1.Str()
+			return op(vv0, vv1), nil
+		}, nil
+	}
 	switch n.Token {
 	case "==", "!=":
 		if n.Children[0].Target == exprBool {
 			op := binBool(n.Token)
-			return func(b B) (v lib.Field, e error) {
+			return func(b frame[B]) (v lib.Field, e error) {
 				v0, e0 := f0(b)
 				v1, e1 := f1(b)
 				if e = errors.Join(e0, e1); e != nil {
@@ -207,8 +492,11 @@ func compileBinary[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (f
 		fallthrough
 	case "^", "+", "-", "*", "/", "%", "<", "<=", ">", ">=":
 		if n.Children[0].Target == exprInt {
+			if op := safeInt(n); n.safe && op != nil {
+				return _safeBinary(f0, f1, lib.Field.Int64, op), nil
+			}
 			op := binInt(n.Token)
-			return func(b B) (v lib.Field, e error) {
+			return func(b frame[B]) (v lib.Field, e error) {
 				v0, e0 := f0(b)
 				v1, e1 := f1(b)
 				if e = errors.Join(e0, e1); e != nil {
@@ -221,7 +509,10 @@ func compileBinary[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (f
 		}
 		if n.Children[0].Target == exprFloat {
 			op := binFloat(n.Token)
-			return func(b B) (v lib.Field, e error) {
+			if op := safeFloat(n, op); n.safe && op != nil {
+				return _safeBinary(f0, f1, lib.Field.Float64, op), nil
+			}
+			return func(b frame[B]) (v lib.Field, e error) {
 				v0, e0 := f0(b)
 				v1, e1 := f1(b)
 				if e = errors.Join(e0, e1); e != nil {
@@ -232,8 +523,24 @@ func compileBinary[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (f
 				return op(vv0, vv1), nil
 			}, nil
 		}
+		if n.Children[0].Target == exprFixed {
+			op := binFixed(n.Token)
+			if op := safeFixed(n, op); n.safe && op != nil {
+				return _safeBinary(f0, f1, lib.Field.Fixed, op), nil
+			}
+			return func(b frame[B]) (v lib.Field, e error) {
+				v0, e0 := f0(b)
+				v1, e1 := f1(b)
+				if e = errors.Join(e0, e1); e != nil {
+					return
+				}
+				vv0, _ := v0.Fixed()
+				vv1, _ := v1.Fixed()
+				return op(vv0, vv1), nil
+			}, nil
+		}
 	case "||":
-		return func(b B) (v lib.Field, e error) {
+		return func(b frame[B]) (v lib.Field, e error) {
 			v0, e0 := f0(b)
 			if e0 != nil {
 				return v, e0
@@ -249,7 +556,7 @@ func compileBinary[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (f
 			return v1, nil
 		}, nil
 	case "&&":
-		return func(b B) (v lib.Field, e error) {
+		return func(b frame[B]) (v lib.Field, e error) {
 			v0, e0 := f0(b)
 			if e0 != nil {
 				return v, e0
@@ -269,14 +576,14 @@ func compileBinary[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (f
 	panic("unreachable")
 }
 
-func compileTernary[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (func(B) (lib.Field, error), error) {
+func compileTernary[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (func(frame[B]) (lib.Field, error), error) {
 	f0, e0 := compile[K, B](n.Children[0], m, k)
 	f1, e1 := compile[K, B](n.Children[1], m, k)
 	f2, e2 := compile[K, B](n.Children[2], m, k)
 	if e := errors.Join(e0, e1, e2); e != nil {
 		return nil, e
 	}
-	return func(b B) (v lib.Field, e error) {
+	return func(b frame[B]) (v lib.Field, e error) {
 		v0, e0 := f0(b)
 		if e0 != nil {
 			return v, e0
@@ -288,14 +595,17 @@ func compileTernary[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (
 	}, nil
 }
 
-func compileFunc[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (func(B) (lib.Field, error), error) {
+func compileFunc[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (func(frame[B]) (lib.Field, error), error) {
 	token := n.Token
 	x := len(n.Children)
 	fs, e := _compileNodes[K, B](n.Children, m, k)
 	if e != nil {
 		return nil, e
 	}
-	return func(b B) (v lib.Field, e error) {
+	if n.def != nil {
+		return _fixedLoad(n, safeCall(n, compileCall(n.def, fs))), nil
+	}
+	return _fixedLoad(n, safeCall(n, func(b frame[B]) (v lib.Field, e error) {
 		vs := make([]lib.Field, 0, x)
 		for _, f := range fs {
 			if v, e = f(b); e != nil {
@@ -303,82 +613,275 @@ func compileFunc[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (fun
 			}
 			vs = append(vs, v)
 		}
-		v0, ok := b.Exec(token, vs...)
+		v0, ok := b.kv.Exec(token, vs...)
 		if !ok {
-			return v, fmt.Errorf(fmtIllFunc, token)
+			return v, n.errorf(fmtIllFunc, token)
 		}
 		return v0, nil
-	}, nil
+	})), nil
 }
 
 var (
-	zeroInt   = lib.Int64(0)
-	zeroFloat = lib.Float64(0)
-	zeroBool  = lib.Bool(false)
+	zeroInt    = lib.Int64(0)
+	zeroFloat  = lib.Float64(0)
+	zeroBool   = lib.Bool(false)
+	zeroString = lib.String("")
+	zeroVec2   = lib.Vector2(lib.Vec2{})
+	zeroVec3   = lib.Vector3(lib.Vec3{})
 )
 
-func compileTryIdent[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (func(B) (lib.Field, error), error) {
-	var zero lib.Field
-	switch m[n.Token] {
-	case exprInt:
-		zero = zeroInt
-	case exprFloat:
-		zero = zeroFloat
-	case exprBool:
-		zero = zeroBool
-	default:
-		panic("unreachable")
+func compileTryIdent[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (func(frame[B]) (lib.Field, error), error) {
+	if n.local != nil {
+		return compileLocal[B](n), nil
 	}
+	if n.attr != nil {
+		return _fixedLoad(n, compileAttr[B](n)), nil
+	}
+	zero := _zero(m[n.Token])
 	key := k(n.Token)
-	return func(b B) (v lib.Field, e error) {
-		v0, ok := b.Get(key)
+	return _fixedLoad(n, func(b frame[B]) (v lib.Field, e error) {
+		v0, ok := b.kv.Get(key)
 		if !ok {
 			return zero, nil
 		}
 		return v0, nil
-	}, nil
+	}), nil
 }
 
-func compileIdent[K any, B Ctx[K]](n *Node, _ map[string]exprType, k Key[K]) (func(B) (lib.Field, error), error) {
+func compileIdent[K any, B Ctx[K]](n *Node, _ map[string]exprType, k Key[K]) (func(frame[B]) (lib.Field, error), error) {
+	if n.local != nil {
+		return compileLocal[B](n), nil
+	}
+	if n.attr != nil {
+		return _fixedLoad(n, compileAttr[B](n)), nil
+	}
 	token := n.Token
 	key := k(n.Token)
-	return func(b B) (v lib.Field, e error) {
-		v0, ok := b.Get(key)
+	return _fixedLoad(n, func(b frame[B]) (v lib.Field, e error) {
+		v0, ok := b.kv.Get(key)
 		if !ok {
-			return v, fmt.Errorf(fmtKeyMiss, token)
+			return v, n.errorf(fmtKeyMiss, token)
 		}
 		return v0, nil
+	}), nil
+}
+
+// compileLocal 读取 let 局部变量。局部变量在作用域内总是先赋值后读取，x! 与 x 等价。
+func compileLocal[B any](n *Node) func(frame[B]) (lib.Field, error) {
+	slot := n.local.slot
+	return func(b frame[B]) (lib.Field, error) {
+		return b.l[slot], nil
+	}
+}
+
+func compileLet[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (func(frame[B]) (lib.Field, error), error) {
+	f, e := compile[K, B](n.Children[0], m, k)
+	if e != nil {
+		return nil, e
+	}
+	slot := n.local.slot
+	return func(b frame[B]) (v lib.Field, e error) {
+		if v, e = f(b); e != nil {
+			return
+		}
+		b.l[slot] = v
+		return v, nil
 	}, nil
 }
 
-func compileNumber[K any, B Ctx[K]](n *Node, _ map[string]exprType) (func(B) (lib.Field, error), error) {
-	f, e := strconv.ParseFloat(n.Token, 64)
+// compileIf 的值是执行到的分支块的值，没有 else 且条件不成立时为零值
+func compileIf[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (func(frame[B]) (lib.Field, error), error) {
+	fs, e := _compileNodes[K, B](n.Children, m, k)
 	if e != nil {
-		return nil, fmt.Errorf(fmtConstFormat, n.Token)
+		return nil, e
 	}
-	var v lib.Field
-	switch n.Target {
-	case exprInt:
-		v = lib.Int64(int64(f))
-	case exprFloat:
-		v = lib.Float64(f)
-	case exprBool:
-		v = lib.Bool(int64(f) != 0)
-	default:
-		panic("unreachable")
+	f0, f1 := fs[0], fs[1]
+	if len(fs) == 2 {
+		var zero lib.Field
+		if n.Target != exprUnknown {
+			zero = _zero(n.Target)
+		}
+		return func(b frame[B]) (v lib.Field, e error) {
+			v0, e0 := f0(b)
+			if e0 != nil {
+				return v, e0
+			}
+			if vv0, _ := v0.Bool(); vv0 {
+				return f1(b)
+			}
+			return zero, nil
+		}, nil
+	}
+	f2 := fs[2]
+	return func(b frame[B]) (v lib.Field, e error) {
+		v0, e0 := f0(b)
+		if e0 != nil {
+			return v, e0
+		}
+		if vv0, _ := v0.Bool(); vv0 {
+			return f1(b)
+		}
+		return f2(b)
+	}, nil
+}
+
+// compileBuiltin 编译 abs/min/max/clamp 运算符，参数已经向下推断为运算符的结果类型；随机函数见 compileRand
+func compileBuiltin[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (func(frame[B]) (lib.Field, error), error) {
+	// 随机函数与标签查询会调用求值上下文提供的对象，安全模式下和函数调用一样恢复 panic
+	if randBuiltins[n.Token] {
+		f, e := compileRand[K, B](n, m, k)
+		if e != nil {
+			return nil, e
+		}
+		return safeCall(n, f), nil
+	}
+	if n.tag != nil {
+		return safeCall(n, compileTag[B](n)), nil
+	}
+	if vecBuiltins[n.Token] {
+		return compileVec[K, B](n, m, k)
+	}
+	fs, e := _compileNodes[K, B](n.Children, m, k)
+	if e != nil {
+		return nil, e
+	}
+	if n.Token == "abs" {
+		f0 := fs[0]
+		if n.Target == exprInt && n.safe {
+			return safeNeg(n, f0, true), nil
+		}
+		if n.Target == exprInt {
+			return func(b frame[B]) (v lib.Field, e error) {
+				if v, e = f0(b); e != nil {
+					return
+				}
+				vv, _ := v.Int64()
+				return lib.Int64(_iabs(vv)), nil
+			}, nil
+		}
+		if n.Target == exprFixed {
+			return func(b frame[B]) (v lib.Field, e error) {
+				if v, e = f0(b); e != nil {
+					return
+				}
+				vv, _ := v.Fixed()
+				return lib.Fixed(vv.Abs()), nil
+			}, nil
+		}
+		return func(b frame[B]) (v lib.Field, e error) {
+			if v, e = f0(b); e != nil {
+				return
+			}
+			vv, _ := v.Float64()
+			return lib.Float64(math.Abs(vv)), nil
+		}, nil
+	}
+	if n.Token == "clamp" {
+		f0, f1, f2 := fs[0], fs[1], fs[2]
+		if n.Target == exprInt {
+			return func(b frame[B]) (v lib.Field, e error) {
+				v0, e0 := f0(b)
+				v1, e1 := f1(b)
+				v2, e2 := f2(b)
+				if e = errors.Join(e0, e1, e2); e != nil {
+					return
+				}
+				x, _ := v0.Int64()
+				lo, _ := v1.Int64()
+				hi, _ := v2.Int64()
+				return lib.Int64(min(max(x, lo), hi)), nil
+			}, nil
+		}
+		if n.Target == exprFixed {
+			return func(b frame[B]) (v lib.Field, e error) {
+				v0, e0 := f0(b)
+				v1, e1 := f1(b)
+				v2, e2 := f2(b)
+				if e = errors.Join(e0, e1, e2); e != nil {
+					return
+				}
+				x, _ := v0.Fixed()
+				lo, _ := v1.Fixed()
+				hi, _ := v2.Fixed()
+				return lib.Fixed(min(max(x, lo), hi)), nil
+			}, nil
+		}
+		return func(b frame[B]) (v lib.Field, e error) {
+			v0, e0 := f0(b)
+			v1, e1 := f1(b)
+			v2, e2 := f2(b)
+			if e = errors.Join(e0, e1, e2); e != nil {
+				return
+			}
+			x, _ := v0.Float64()
+			lo, _ := v1.Float64()
+			hi, _ := v2.Float64()
+			return lib.Float64(math.Min(math.Max(x, lo), hi)), nil
+		}, nil
+	}
+	f0, f1 := fs[0], fs[1]
+	if n.Target == exprInt {
+		op := binInt(n.Token)
+		return func(b frame[B]) (v lib.Field, e error) {
+			v0, e0 := f0(b)
+			v1, e1 := f1(b)
+			if e = errors.Join(e0, e1); e != nil {
+				return
+			}
+			vv0, _ := v0.Int64()
+			vv1, _ := v1.Int64()
+			return op(vv0, vv1), nil
+		}, nil
+	}
+	if n.Target == exprFixed {
+		op := binFixed(n.Token)
+		return func(b frame[B]) (v lib.Field, e error) {
+			v0, e0 := f0(b)
+			v1, e1 := f1(b)
+			if e = errors.Join(e0, e1); e != nil {
+				return
+			}
+			vv0, _ := v0.Fixed()
+			vv1, _ := v1.Fixed()
+			return op(vv0, vv1), nil
+		}, nil
+	}
+	op := binFloat(n.Token)
+	return func(b frame[B]) (v lib.Field, e error) {
+		v0, e0 := f0(b)
+		v1, e1 := f1(b)
+		if e = errors.Join(e0, e1); e != nil {
+			return
+		}
+		vv0, _ := v0.Float64()
+		vv1, _ := v1.Float64()
+		return op(vv0, vv1), nil
+	}, nil
+}
+
+func compileNumber[K any, B Ctx[K]](n *Node, _ map[string]exprType) (func(frame[B]) (lib.Field, error), error) {
+	v, e := _number(n)
+	if e != nil {
+		return nil, e
 	}
-	return func(b B) (lib.Field, error) {
+	return func(b frame[B]) (lib.Field, error) {
 		return v, nil
 	}, nil
 }
 
-func compileBool[K any, B Ctx[K]](n *Node, _ map[string]exprType) (func(B) (lib.Field, error), error) {
-	f, e := strconv.ParseBool(n.Token)
+func compileBool[K any, B Ctx[K]](n *Node, _ map[string]exprType) (func(frame[B]) (lib.Field, error), error) {
+	v, e := _bool(n)
 	if e != nil {
-		return nil, fmt.Errorf(fmtConstFormat, n.Token)
+		return nil, e
 	}
-	v := lib.Bool(f)
-	return func(b B) (lib.Field, error) {
+	return func(b frame[B]) (lib.Field, error) {
+		return v, nil
+	}, nil
+}
+
+func compileString[K any, B Ctx[K]](n *Node, _ map[string]exprType) (func(frame[B]) (lib.Field, error), error) {
+	v := lib.String(n.Token)
+	return func(b frame[B]) (lib.Field, error) {
 		return v, nil
 	}, nil
 }
@@ -433,6 +936,14 @@ func binInt(op string) func(a, b int64) lib.Field {
 		return func(a, b int64) lib.Field {
 			return lib.Bool(a >= b)
 		}
+	case "min":
+		return func(a, b int64) lib.Field {
+			return lib.Int64(min(a, b))
+		}
+	case "max":
+		return func(a, b int64) lib.Field {
+			return lib.Int64(max(a, b))
+		}
 	default:
 		panic("unreachable")
 	}
@@ -484,6 +995,14 @@ func binFloat(op string) func(a float64, b float64) lib.Field {
 		return func(a, b float64) lib.Field {
 			return lib.Bool(a >= b)
 		}
+	case "min":
+		return func(a, b float64) lib.Field {
+			return lib.Float64(math.Min(a, b))
+		}
+	case "max":
+		return func(a, b float64) lib.Field {
+			return lib.Float64(math.Max(a, b))
+		}
 	default:
 		panic("unreachable")
 	}
@@ -504,6 +1023,25 @@ func binBool(op string) func(a, b bool) lib.Field {
 	}
 }
 
+func binString(op string) func(a, b string) lib.Field {
+	switch op {
+	case "+":
+		return func(a, b string) lib.Field {
+			return lib.String(a + b)
+		}
+	case "==":
+		return func(a, b string) lib.Field {
+			return lib.Bool(a == b)
+		}
+	case "!=":
+		return func(a, b string) lib.Field {
+			return lib.Bool(a != b)
+		}
+	default:
+		panic("unreachable")
+	}
+}
+
 func _ipower(a, b int64) int64 {
 	var c int64 = 1
 	for b > 0 {
@@ -516,6 +1054,13 @@ func _ipower(a, b int64) int64 {
 	return c
 }
 
+func _iabs(a int64) int64 {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
 func _inline[I, O any](fs []func(I) (O, error)) func(I) (O, error) {
 	// 对常见的参数数量[0-5]做内联，加快函数调用
 	switch l := len(fs); l {
@@ -587,6 +1132,53 @@ func _inline[I, O any](fs []func(I) (O, error)) func(I) (O, error) {
 	}
 }
 
+func _zero(t exprType) lib.Field {
+	switch t {
+	case exprInt:
+		return zeroInt
+	case exprFloat:
+		return zeroFloat
+	case exprBool:
+		return zeroBool
+	case exprString:
+		return zeroString
+	case exprFixed:
+		return zeroFixed
+	case exprVec2:
+		return zeroVec2
+	case exprVec3:
+		return zeroVec3
+	}
+	panic("unreachable")
+}
+
+func _number(n *Node) (lib.Field, error) {
+	f, e := strconv.ParseFloat(n.Token, 64)
+	if e != nil {
+		return lib.Field{}, n.errorf(fmtConstFormat, n.Token)
+	}
+	switch n.Target {
+	case exprInt:
+		return lib.Int64(int64(f)), nil
+	case exprFloat:
+		return lib.Float64(f), nil
+	case exprBool:
+		return lib.Bool(int64(f) != 0), nil
+	case exprFixed:
+		q, _ := lib.ParseQ32(n.Token)
+		return lib.Fixed(q), nil
+	}
+	panic("unreachable")
+}
+
+func _bool(n *Node) (lib.Field, error) {
+	f, e := strconv.ParseBool(n.Token)
+	if e != nil {
+		return lib.Field{}, n.errorf(fmtConstFormat, n.Token)
+	}
+	return lib.Bool(f), nil
+}
+
 func _string2type(s string) (exprType, error) {
 	switch s {
 	case "int":
@@ -595,14 +1187,20 @@ func _string2type(s string) (exprType, error) {
 		return exprFloat, nil
 	case "bool":
 		return exprBool, nil
+	case "string":
+		return exprString, nil
+	case "vec2":
+		return exprVec2, nil
+	case "vec3":
+		return exprVec3, nil
 	}
 	return -1, fmt.Errorf(fmtWrongVarType, s)
 }
 
-func _compileNodes[K any, B Ctx[K]](ns []*Node, m map[string]exprType, k Key[K]) (fs []func(B) (lib.Field, error), e error) {
-	fs = make([]func(B) (lib.Field, error), 0, len(ns))
+func _compileNodes[K any, B Ctx[K]](ns []*Node, m map[string]exprType, k Key[K]) (fs []func(frame[B]) (lib.Field, error), e error) {
+	fs = make([]func(frame[B]) (lib.Field, error), 0, len(ns))
 	for _, n := range ns {
-		var f func(B) (lib.Field, error)
+		var f func(frame[B]) (lib.Field, error)
 		if f, e = compile[K, B](n, m, k); e != nil {
 			return
 		}
@@ -45,6 +45,9 @@ func TestParse(t *testing.T) {
 	_, e = parse("int x,y,z; z = (x+3)*(y+2); z % 2 == 0")
 	assert.Nil(t, e)
 
+	_, e = parse(`string s; s = "a;b" + 'c'`)
+	assert.Nil(t, e)
+
 	_, e = parse("x, y = y, x")
 	assert.NotNil(t, e)
 
@@ -693,6 +696,66 @@ func TestCompile(t *testing.T) {
 		assert.InDelta(t, 8.929, v, 0.01)
 	})
 
+	// 测试字符串比较
+	t.Run("字符串比较", func(t *testing.T) {
+		compiledFunc, err := Compile[string, *MockKv](`string state, faction; state == "combat" && faction != 'horde'`, s2s)
+		assert.Nil(t, err)
+
+		kv := NewMockKv()
+		kv.Set("state", lib.String("combat"))
+		kv.Set("faction", lib.String("alliance"))
+
+		result, err := compiledFunc(kv)
+		assert.Nil(t, err)
+		v, ok := result.Bool()
+		assert.True(t, ok)
+		assert.True(t, v)
+
+		kv.Set("state", lib.String("idle"))
+		result, err = compiledFunc(kv)
+		assert.Nil(t, err)
+		v, _ = result.Bool()
+		assert.False(t, v)
+	})
+
+	// 测试字符串拼接、赋值与零值读取
+	t.Run("字符串拼接", func(t *testing.T) {
+		compiledFunc, err := Compile[string, *MockKv](`string name, title, missing; bool hp_low; title = hp_low ? "weak " + name : name + missing; title`, s2s)
+		assert.Nil(t, err)
+
+		kv := NewMockKv()
+		kv.Set("name", lib.String("orc"))
+		kv.SetBool("hp_low", true)
+
+		result, err := compiledFunc(kv)
+		assert.Nil(t, err)
+		v, ok := result.Str()
+		assert.True(t, ok)
+		assert.Equal(t, "weak orc", v)
+
+		stored, exists := kv.Get("title")
+		assert.True(t, exists)
+		sv, _ := stored.Str()
+		assert.Equal(t, "weak orc", sv)
+
+		kv.SetBool("hp_low", false)
+		result, err = compiledFunc(kv)
+		assert.Nil(t, err)
+		v, _ = result.Str()
+		assert.Equal(t, "orc", v)
+	})
+
+	// 测试字符串转义
+	t.Run("字符串转义", func(t *testing.T) {
+		compiledFunc, err := Compile[string, *MockKv](`"it's" == 'it\'s' && "a\tb" != "a b"`, s2s)
+		assert.Nil(t, err)
+
+		result, err := compiledFunc(NewMockKv())
+		assert.Nil(t, err)
+		v, _ := result.Bool()
+		assert.True(t, v)
+	})
+
 	// 测试除零错误
 	t.Run("除零错误", func(t *testing.T) {
 		compiledFunc, err := Compile[string, *MockKv]("int x, y; x / y", s2s)
@@ -783,8 +846,28 @@ func TestCompileErrors(t *testing.T) {
 
 	// 测试不支持的运算符组合
 	t.Run("不支持的运算符组合", func(t *testing.T) {
-		// 测试对字符串进行操作（不支持的类型）
-		_, err := Compile[string, *MockKv]("string x", s2s)
+		// 测试不支持的类型
+		_, err := Compile[string, *MockKv]("double x", s2s)
+		assert.NotNil(t, err)
+
+		// 测试字符串不支持的运算
+		_, err = Compile[string, *MockKv]("string x, y; x - y", s2s)
+		assert.NotNil(t, err)
+
+		_, err = Compile[string, *MockKv]("string x; x < 'a'", s2s)
+		assert.NotNil(t, err)
+
+		_, err = Compile[string, *MockKv]("string x; int y; x == y", s2s)
+		assert.NotNil(t, err)
+
+		_, err = Compile[string, *MockKv]("string x; x + 1", s2s)
+		assert.NotNil(t, err)
+
+		_, err = Compile[string, *MockKv]("bool c; c ? 1 : 'a'", s2s)
+		assert.NotNil(t, err)
+
+		// 测试未闭合的字符串
+		_, err = Compile[string, *MockKv]("string x; x == 'abc", s2s)
 		assert.NotNil(t, err)
 
 		// 测试不完整的三目运算符
@@ -1407,3 +1490,137 @@ func TestLargeExpression(t *testing.T) {
 			price, profit, viability, viable)
 	})
 }
+
+func TestBlock(t *testing.T) {
+	t.Run("let局部变量不写黑板", func(t *testing.T) {
+		f, err := Compile[string, *MockKv]("int atk, def; float dmg; let raw = atk * 1.5 - def; let crit = raw * 2; dmg = crit; crit", s2s)
+		assert.Nil(t, err)
+
+		kv := NewMockKv()
+		kv.SetInt64("atk", 100)
+		kv.SetInt64("def", 30)
+		v, err := f(kv)
+		assert.Nil(t, err)
+		fv, _ := v.Float64()
+		assert.Equal(t, 240.0, fv)
+		assert.Len(t, kv.data, 3)
+		_, exists := kv.Get("raw")
+		assert.False(t, exists)
+	})
+
+	t.Run("if else分支", func(t *testing.T) {
+		f, err := Compile[string, *MockKv](`
+			float hp, hp_max, heal;
+			let ratio = hp / hp_max;
+			if (ratio < 0.3) {
+				heal = hp_max * 0.5
+			} else if (ratio < 0.6) {
+				heal = hp_max * 0.2;
+			} else {
+				heal = 0;
+			}
+			heal
+		`, s2s)
+		assert.Nil(t, err)
+
+		for hp, want := range map[float64]float64{10: 50, 40: 20, 90: 0} {
+			kv := NewMockKv()
+			kv.SetFloat64("hp", hp)
+			kv.SetFloat64("hp_max", 100)
+			v, err := f(kv)
+			assert.Nil(t, err)
+			fv, _ := v.Float64()
+			assert.Equal(t, want, fv, "hp=%v", hp)
+		}
+	})
+
+	t.Run("块作用域", func(t *testing.T) {
+		_, err := Compile[string, *MockKv]("int a; if (a > 0) { let b = 1 } b", s2s)
+		assert.NotNil(t, err)
+
+		// 兄弟块可以使用同名局部变量
+		_, err = Compile[string, *MockKv]("int a; if (a > 0) { let b = 1 } else { let b = 2.5 }", s2s)
+		assert.Nil(t, err)
+
+		// 不允许遮蔽黑板变量或外层局部变量
+		_, err = Compile[string, *MockKv]("int a; let a = 1", s2s)
+		assert.NotNil(t, err)
+		_, err = Compile[string, *MockKv]("let b = 1; if (true) { let b = 2 }", s2s)
+		assert.NotNil(t, err)
+
+		// 块内不允许声明黑板变量
+		_, err = Compile[string, *MockKv]("if (true) { int a; a }", s2s)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("局部变量类型", func(t *testing.T) {
+		_, err := Compile[string, *MockKv]("let n = 1; n = 2.5", s2s)
+		assert.NotNil(t, err)
+
+		_, err = Compile[string, *MockKv]("let s = 'a'; s + 1", s2s)
+		assert.NotNil(t, err)
+
+		_, err = Compile[string, *MockKv]("int a; if (a) { 1 }", s2s)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("内置运算符类型推断", func(t *testing.T) {
+		f, err := Compile[string, *MockKv]("int a, b, r; r = clamp(a, 0, b) + abs(min(a, -b)); r", s2s)
+		assert.Nil(t, err)
+		kv := NewMockKv()
+		kv.SetInt64("a", 12)
+		kv.SetInt64("b", 10)
+		v, err := f(kv)
+		assert.Nil(t, err)
+		iv, ok := v.Int64()
+		assert.True(t, ok)
+		assert.Equal(t, int64(20), iv)
+
+		// 任一参数为 float 时结果为 float，不能赋给 int
+		_, err = Compile[string, *MockKv]("int a, r; r = max(a, 0.5)", s2s)
+		assert.NotNil(t, err)
+		_, err = Compile[string, *MockKv]("bool t; abs(t)", s2s)
+		assert.NotNil(t, err)
+		_, err = Compile[string, *MockKv]("int a; min(a)", s2s)
+		assert.NotNil(t, err)
+
+		// 内置运算符不能注册为函数
+		assert.NotNil(t, NewFuncs().Register("min(int,int) int", func(a, b int64) int64 { return a }))
+	})
+
+	t.Run("内置运算名可以作为变量名", func(t *testing.T) {
+		// 只有紧跟 ( 时才是内置运算
+		f, err := Compile[string, *MockKv]("int max, min, abs; bool chance, has_tag; max = min + abs; max(max, min) + (chance || has_tag ? 1 : 0)", s2s)
+		assert.Nil(t, err)
+		kv := NewMockKv()
+		kv.SetInt64("min", 3)
+		kv.SetInt64("abs", 4)
+		kv.SetBool("has_tag", true)
+		v, err := f(kv)
+		assert.Nil(t, err)
+		iv, _ := v.Int64()
+		assert.Equal(t, int64(8), iv)
+		iv, _ = kv.data["max"].Int64()
+		assert.Equal(t, int64(7), iv)
+
+		// if、else、let 是保留字
+		for _, code := range []string{"int let; let + 1", "int if; if", "bool else; else"} {
+			_, err = Compile[string, *MockKv](code, s2s)
+			var pe *Error
+			if assert.ErrorAs(t, err, &pe, code) {
+				assert.Contains(t, pe.Error(), "syntax error", code)
+			}
+		}
+	})
+
+	t.Run("语句分隔", func(t *testing.T) {
+		_, err := Compile[string, *MockKv]("int a; a = 1;", s2s)
+		assert.Nil(t, err)
+		_, err = Compile[string, *MockKv]("int a; if (a > 0) { a = 1 }; a", s2s)
+		assert.Nil(t, err)
+		_, err = Compile[string, *MockKv]("int a; a = 1 a", s2s)
+		assert.NotNil(t, err)
+		_, err = Compile[string, *MockKv](";", s2s)
+		assert.NotNil(t, err)
+	})
+}
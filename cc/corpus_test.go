@@ -0,0 +1,140 @@
+package cc
+
+import (
+	"testing"
+
+	"github.com/legamerdc/game/lib"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// corpusCase 是多个后端共用的测试语料：同一段代码在同一份黑板上求值，
+// 各后端的结果（包括写回黑板的值）必须与闭包后端完全一致。
+type corpusCase struct {
+	code string
+	kv   map[string]lib.Field
+}
+
+var corpusKv = map[string]lib.Field{
+	"a":     lib.Int64(7),
+	"b":     lib.Int64(3),
+	"c":     lib.Int64(-2),
+	"x":     lib.Float64(2.5),
+	"y":     lib.Float64(-0.75),
+	"z":     lib.Float64(10),
+	"t":     lib.Bool(true),
+	"f":     lib.Bool(false),
+	"s":     lib.String("combat"),
+	"name":  lib.String("orc"),
+	"hp":    lib.Int64(42),
+	"hpMax": lib.Int64(120),
+	"fz":    lib.Float64(0),
+}
+
+var corpus = []corpusCase{
+	{code: "int a, b; a + b"},
+	{code: "int a, b, c; a - b * c"},
+	{code: "int a, b; a / b"},
+	{code: "int a, b; a % b"},
+	{code: "int a, b; a ^ b"},
+	{code: "int a, c; c ^ a"},
+	{code: "int a, b; -a + +b"},
+	{code: "int a, b; a == b || a != b"},
+	{code: "int a, b; a < b"},
+	{code: "int a, b; a <= b && a >= b"},
+	{code: "int a, b; a > b"},
+	{code: "float x, y; x + y"},
+	{code: "float x, y; x - y"},
+	{code: "float x, y; x * y"},
+	{code: "float x, y; x / y"},
+	{code: "float x, y; x ^ 2 + y ^ 3"},
+	{code: "float x, fz; x / fz"},
+	{code: "float x, y; -x"},
+	{code: "float x, y; x == y || x != y"},
+	{code: "float x, y; x < y || x <= y || x > y || x >= y"},
+	{code: "int a; float x; a * x"},
+	{code: "int a; float x; a > x"},
+	{code: "int hp, hpMax; hp / hpMax < 0.35"},
+	{code: "int hp, hpMax; float r; r = hp / hpMax; r"},
+	{code: "bool t, f; t && f"},
+	{code: "bool t, f; t || f"},
+	{code: "bool t, f; !t || !f"},
+	{code: "bool t, f; t == f"},
+	{code: "bool t, f; t != f"},
+	{code: "int a; bool t; t && a"},
+	{code: "int a; bool f; f || a"},
+	{code: "true"},
+	{code: "false || 0"},
+	{code: "3.25"},
+	{code: "42"},
+	{code: "int a; bool t; t ? a : 1.5"},
+	{code: "int a, b; a > b ? a : b"},
+	{code: "int a, b, c; a > 0 ? (b > 0 ? a + b : a - b) : (c > 0 ? c : 0)"},
+	{code: "int a, r; r = a * 2; r + 1"},
+	{code: "float q; int a; q = a; q"},
+	{code: "bool g; int a; g = a; g"},
+	{code: "int a, b, c, d, e, g; c = a + b; d = c * 2; e = d - a; g = e % 5; g"},
+	{code: "int missing; missing + 1"},
+	{code: "float missing; missing * 2"},
+	{code: "bool missing; !missing"},
+	{code: "string missing; missing == ''"},
+	{code: "int a; a! + 1"},
+	{code: "int missing; missing! + 1"},
+	{code: "int a; float x; sqrt(a * a + x)"},
+	{code: "float x, y; clamp(x, y, 1) + atan2(y, x) + max(x, y)"},
+	{code: "int a, f1, f0; f1(a) + f0()"},
+	{code: "int a, nope; nope(a)"},
+	{code: "string s; s == 'combat'"},
+	{code: "string s, name; s + '-' + name"},
+	{code: "string s, name, w; w = s + name; w != 'x'"},
+	{code: "string s; bool t; t ? s : 'idle'"},
+	{code: "int a, b; float x, y; bool t; (a + b) * 2 > x * y && (t || a % b == 1) ? a ^ 2 - b : -x"},
+	{code: "int a; float x; string s; bool t, f; t = s == 'combat' && x > a / 4; f = !t; t != f"},
+	{code: "int a, b; a = 1; b = 2; a = a + b; b = a * b; a + b"},
+	{code: "int a, b; let d = a * 2 + b; let r = d / 3; r * r - d"},
+	{code: "float x; int a; let k = a; k = k + 1; x * k"},
+	{code: "int a, b; if (a > b) { a - b } else { b - a }"},
+	{code: "int a, b; if (a < b) { a - b }"},
+	{code: "int a, b, r; if (a < 0) { r = 1 } else if (b < 0) { r = 2 } else { r = 3 } r"},
+	{code: "int a, r; let t = a; if (t > 5) { let u = t * 2; r = u } r + t"},
+	{code: "int hp, hpMax; float dmg; let base = hp * 1.5; if (base > hpMax) { base = hpMax } dmg = base * 0.8; dmg"},
+	{code: "int a, b, c; min(a, b) + max(a, c) + abs(c)"},
+	{code: "float x, y; min(x, y) * max(x, 1) + abs(y)"},
+	{code: "int a, b; float x; clamp(a, b, x) + clamp(a, 0, 5)"},
+	{code: "int c; int r; r = abs(c) + min(3, 2); r"},
+	{code: "int a; if (a > 0) {} 1"},
+	{code: "bool t; int a; if (t) { a } else { 2.5 }"},
+}
+
+// runCorpus 对比 compileFn 与闭包后端在整个语料上的结果
+func runCorpus(t *testing.T, compileFn func(code string) (func(*MockKv) (lib.Field, error), error)) {
+	for _, c := range corpus {
+		t.Run(c.code, func(t *testing.T) {
+			want, e0 := Compile[string, *MockKv](c.code, s2s)
+			got, e1 := compileFn(c.code)
+			assert.Equal(t, e0 == nil, e1 == nil, "compile error: %v %v", e0, e1)
+			if e0 != nil || e1 != nil {
+				return
+			}
+			kv0, kv1 := corpusMockKv(c), corpusMockKv(c)
+			v0, e0 := want(kv0)
+			v1, e1 := got(kv1)
+			assert.Equal(t, e0 == nil, e1 == nil, "eval error: %v %v", e0, e1)
+			if e0 == nil {
+				assert.Equal(t, v0, v1)
+				assert.Equal(t, kv0.data, kv1.data)
+			}
+		})
+	}
+}
+
+func corpusMockKv(c corpusCase) *MockKv {
+	kv := NewMockKv()
+	for k, v := range corpusKv {
+		kv.Set(k, v)
+	}
+	for k, v := range c.kv {
+		kv.Set(k, v)
+	}
+	return kv
+}
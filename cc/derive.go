@@ -0,0 +1,75 @@
+package cc
+
+import (
+	"slices"
+
+	"github.com/legamerdc/game/attr"
+	"github.com/legamerdc/game/lib"
+)
+
+var (
+	fmtDeriveVar    = "derivation cannot use blackboard: %s"
+	fmtDeriveAssign = "derivation cannot assign attribute: %s"
+	fmtDeriveBase   = "derivation cannot read base: %s"
+)
+
+// derivCtx 是派生属性的求值上下文，只提供属性表，没有黑板
+type derivCtx struct {
+	t *attr.Table
+}
+
+func (derivCtx) Get(string) (lib.Field, bool)                { return lib.Field{}, false }
+func (derivCtx) Set(string, lib.Field)                       {}
+func (derivCtx) Exec(string, ...lib.Field) (lib.Field, bool) { return lib.Field{}, false }
+func (c derivCtx) Attrs() Attrs                              { return c.t }
+
+// Derive 把表达式编译为 target 的派生属性，表达式读取的属性即为 Deps，通常需要传入
+// WithAttrs。表达式只能读取属性的 Current，不能读写黑板变量、调用走 Exec 的函数或给属性赋值。
+// 返回的 Derivation 写入 target 的 Base，设置 Mod 后改为以修饰器的形式作用，修饰器绑定
+// source，因此每个修饰器派生需要各自的非 0 source。求值出错时 target 保持不变，错误由
+// attr.Table.DerivationErr 报告。
+func Derive(target attr.Key, source uint64, code string, opts ...Option) (d attr.Derivation, e error) {
+	o := ctxOptions[derivCtx](opts)
+	t, e := check(code, o)
+	if e != nil {
+		return d, e
+	}
+	if d.Deps, e = t.root.derivDeps(nil); e != nil {
+		return d, e
+	}
+	f, e := typedTree(t, o, func(s string) string { return s }, exprFloat, typedFloat[string, derivCtx], lib.Field.Float64)
+	if e != nil {
+		return d, e
+	}
+	d.Target, d.Source = target, source
+	d.Fn = func(t *attr.Table) (float64, error) {
+		return f(derivCtx{t})
+	}
+	return d, nil
+}
+
+// derivDeps 收集表达式读取的属性，拒绝派生属性不允许的写法
+func (n *Node) derivDeps(deps []attr.Key) ([]attr.Key, error) {
+	switch {
+	case n.local != nil || n.Type == NodeVarDecl:
+	case n.attr != nil && n.Type == NodeAssign:
+		return nil, n.errorf(fmtDeriveAssign, n.Token)
+	case n.attr != nil && n.attr.base:
+		return nil, n.errorf(fmtDeriveBase, n.Token)
+	case n.attr != nil:
+		if !slices.Contains(deps, n.attr.key) {
+			deps = append(deps, n.attr.key)
+		}
+	case n.Type == NodeIdent, n.Type == NodeTryIdent, n.Type == NodeAssign:
+		return nil, n.errorf(fmtDeriveVar, n.Token)
+	case n.Type == NodeFunc && n.def == nil:
+		return nil, n.errorf(fmtDeriveVar, n.Token)
+	}
+	var e error
+	for _, x := range n.Children {
+		if deps, e = x.derivDeps(deps); e != nil {
+			return nil, e
+		}
+	}
+	return deps, nil
+}
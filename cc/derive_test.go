@@ -0,0 +1,79 @@
+package cc
+
+import (
+	"testing"
+
+	"github.com/legamerdc/game/attr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDerive(t *testing.T) {
+	t.Run("派生Base与修饰器", func(t *testing.T) {
+		kv := newAttrKv()
+		hp, hpMax, power := testAttrNames["Health"], testAttrNames["HealthMax"], testAttrNames["Power"]
+		d, err := Derive(hpMax, 0, "let p = Power; p * 10 + max(Power, 0) * 0", WithAttrs(testAttrNames))
+		require.Nil(t, err)
+		assert.Equal(t, []attr.Key{power}, d.Deps)
+		require.Nil(t, kv.t.AddDerivation(d))
+
+		d, err = Derive(hp, 9, "HealthMax / 10", WithAttrs(testAttrNames))
+		require.Nil(t, err)
+		d.Mod = &attr.ModifierTemplate{Op: attr.ModAdd}
+		require.Nil(t, kv.t.AddDerivation(d))
+		kv.t.Flush()
+		v, _ := kv.t.GetCurrent(hpMax)
+		assert.Equal(t, 150.0, v)
+		v, _ = kv.t.GetCurrent(hp)
+		assert.Equal(t, 45.0, v)
+
+		kv.t.SetBase(power, 20)
+		kv.t.Flush()
+		v, _ = kv.t.GetCurrent(hp)
+		assert.Equal(t, 60.0, v)
+
+		// 依赖成环在注册时报错
+		d, err = Derive(power, 0, "Health", WithAttrs(testAttrNames))
+		require.Nil(t, err)
+		assert.ErrorIs(t, kv.t.AddDerivation(d), attr.ErrDerivationCycle)
+	})
+
+	t.Run("求值错误", func(t *testing.T) {
+		kv := newAttrKv()
+		hp, power := testAttrNames["Health"], testAttrNames["Power"]
+		d, err := Derive(hp, 0, "150 / Power", WithAttrs(testAttrNames), WithSafe())
+		require.Nil(t, err)
+		require.Nil(t, kv.t.AddDerivation(d))
+		kv.t.Flush()
+		require.Nil(t, kv.t.DerivationErr())
+		v, _ := kv.t.GetCurrent(hp)
+		assert.Equal(t, 10.0, v)
+
+		// 除零时保持原值并报告错误
+		kv.t.SetBase(power, 0)
+		kv.t.Flush()
+		v, _ = kv.t.GetCurrent(hp)
+		assert.Equal(t, 10.0, v)
+		var de *attr.DerivationError
+		require.ErrorAs(t, kv.t.DerivationErr(), &de)
+		assert.Equal(t, hp, de.Target)
+	})
+
+	t.Run("拒绝的写法", func(t *testing.T) {
+		key := testAttrNames["Health"]
+		cases := map[string]string{
+			"int n; Power + n":     "derivation cannot use blackboard: n",
+			"int f0; Power + f0()": "derivation cannot use blackboard: f0",
+			"Power = 1; Health":    "derivation cannot assign attribute: Power",
+			"Power.base * 2":       "derivation cannot read base: Power.base",
+			"Power + rand()":       "rand needs a random source",
+			"Mana + 1":             "variable undefined: Mana",
+			"HealthMax > 0":        "result type mismatch",
+		}
+		for code, msg := range cases {
+			_, err := Derive(key, 0, code, WithAttrs(testAttrNames))
+			require.NotNil(t, err, code)
+			assert.ErrorContains(t, err, msg, code)
+		}
+	})
+}
@@ -1,36 +1,171 @@
 package cc
 
 import (
-	"fmt"
-	"strconv"
+	"strings"
 )
 
-func dfs(n *Node, i int) (s string) {
-	idx := strconv.Itoa(i)
+// Format 把 code 重新排版为规范形式：记号之间使用统一的空格，语句以 "; " 分隔，
+// 只保留优先级需要的括号，字符串统一使用双引号。规范形式与原程序的语法树相同，
+// 再次 Format 结果不变。Format 只做语法分析，不检查类型。
+func Format(code string) (string, error) {
+	n, e := parse(code)
+	if e != nil {
+		return "", e
+	}
+	var sb strings.Builder
+	dfs(&sb, n, 0)
+	return sb.String(), nil
+}
+
+// 表达式的优先级，数值越大结合越紧，与 g.y 中的文法层次一致
+const (
+	precTernary = iota + 1
+	precOr
+	precAnd
+	precEquality
+	precRelational
+	precAdditive
+	precMultiplicative
+	precPower
+	precUnary
+	precPrimary
+)
+
+func _prec(n *Node) int {
+	switch n.Type {
+	case NodeTernary:
+		return precTernary
+	case NodeBinOp:
+		switch n.Token {
+		case "||":
+			return precOr
+		case "&&":
+			return precAnd
+		case "==", "!=":
+			return precEquality
+		case "<", "<=", ">", ">=":
+			return precRelational
+		case "+", "-":
+			return precAdditive
+		case "*", "/", "%":
+			return precMultiplicative
+		case "^":
+			return precPower
+		}
+	case NodeUnaryOp:
+		return precUnary
+	}
+	return precPrimary
+}
+
+// dfs 把节点 n 写入 sb，节点的优先级低于 prec 时加括号
+func dfs(sb *strings.Builder, n *Node, prec int) {
+	if _prec(n) < prec {
+		sb.WriteByte('(')
+		defer sb.WriteByte(')')
+	}
 	switch n.Type {
 	case NodeProgram:
-		for p, x := range n.Children {
-			if p == 0 {
-				s = dfs(x, i+1)
-			} else {
-				s += ";" + dfs(x, i+1)
-			}
+		_statements(sb, n.Children)
+	case NodeBlock:
+		if len(n.Children) == 0 {
+			sb.WriteString("{}")
+			return
 		}
-		return idx + "[" + s + "]"
+		sb.WriteString("{ ")
+		_statements(sb, n.Children)
+		sb.WriteString(" }")
 	case NodeVarDecl:
-		return idx + n.Token
+		t, vs, _ := strings.Cut(n.Token, ":")
+		sb.WriteString(t + " " + strings.ReplaceAll(vs, ",", ", "))
 	case NodeAssign:
-		return idx + n.Token + "=" + dfs(n.Children[0], i+1)
-	case NodeUnaryOp:
-		return idx + n.Token + dfs(n.Children[0], i+1)
-	case NodeBinOp:
-		return idx + dfs(n.Children[0], i+1) + n.Token + dfs(n.Children[1], i+1)
+		sb.WriteString(n.Token + " = ")
+		dfs(sb, n.Children[0], 0)
+	case NodeLet:
+		sb.WriteString("let " + n.Token + " = ")
+		dfs(sb, n.Children[0], 0)
+	case NodeIf:
+		sb.WriteString("if (")
+		dfs(sb, n.Children[0], 0)
+		sb.WriteString(") ")
+		dfs(sb, n.Children[1], 0)
+		if len(n.Children) == 3 {
+			sb.WriteString(" else ")
+			// else { if ... } 与 else if ... 的语法树相同
+			if b := n.Children[2]; len(b.Children) == 1 && b.Children[0].Type == NodeIf {
+				dfs(sb, b.Children[0], 0)
+			} else {
+				dfs(sb, b, 0)
+			}
+		}
 	case NodeTernary:
-		return idx + dfs(n.Children[0], i+1) + "?" + dfs(n.Children[1], i+1) + ":" + dfs(n.Children[2], i+1)
-	case NodeIdent, NodeNumber, NodeBool:
-		return idx + n.Token
+		dfs(sb, n.Children[0], precOr)
+		sb.WriteString(" ? ")
+		dfs(sb, n.Children[1], 0)
+		sb.WriteString(" : ")
+		dfs(sb, n.Children[2], precTernary)
+	case NodeBinOp:
+		p := _prec(n)
+		if n.Token == "^" {
+			// 右结合，左侧只能是一元表达式
+			dfs(sb, n.Children[0], precUnary)
+			sb.WriteString(" ^ ")
+			dfs(sb, n.Children[1], precPower)
+			return
+		}
+		dfs(sb, n.Children[0], p)
+		sb.WriteString(" " + n.Token + " ")
+		dfs(sb, n.Children[1], p+1)
+	case NodeUnaryOp:
+		sb.WriteString(n.Token)
+		dfs(sb, n.Children[0], precUnary)
+	case NodeIdent:
+		sb.WriteString(n.Token + "!")
+	case NodeTryIdent, NodeNumber, NodeBool:
+		sb.WriteString(n.Token)
+	case NodeString:
+		_quote(sb, n.Token)
+	case NodeMember:
+		dfs(sb, n.Children[0], precPrimary)
+		sb.WriteString("." + n.Token)
+	case NodeFunc, NodeBuiltin:
+		sb.WriteString(n.Token + "(")
+		for i, x := range n.Children {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			dfs(sb, x, 0)
+		}
+		sb.WriteByte(')')
 	default:
+		panic("unreachable")
+	}
+}
+
+func _statements(sb *strings.Builder, ns []*Node) {
+	for i, x := range ns {
+		if i > 0 {
+			sb.WriteString("; ")
+		}
+		dfs(sb, x, 0)
+	}
+}
+
+// _quote 按词法分析支持的转义写出字符串字面量
+func _quote(sb *strings.Builder, s string) {
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			sb.WriteByte(c)
+		}
 	}
-	fmt.Println("unknown node type", n.Type)
-	panic("unreachable")
+	sb.WriteByte('"')
 }
@@ -0,0 +1,99 @@
+package cc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		code, want string
+	}{
+		{"int x,y;x+y*2", "int x, y; x + y * 2"},
+		{"int x,y;(x+y)*2", "int x, y; (x + y) * 2"},
+		{"int a,b,c;a-(b-c)", "int a, b, c; a - (b - c)"},
+		{"int a,b,c;(a-b)-c", "int a, b, c; a - b - c"},
+		{"int a,b,c;a^(b^c)", "int a, b, c; a ^ b ^ c"},
+		{"int a,b,c;(a^b)^c", "int a, b, c; (a ^ b) ^ c"},
+		{"int a;-(a^2)", "int a; -(a ^ 2)"},
+		{"int a;(-a)^2", "int a; -a ^ 2"},
+		{"bool p,q;!(p||q)&&p", "bool p, q; !(p || q) && p"},
+		{"int a;a>3?(a>5?1:2):(a<0?3:4)", "int a; a > 3 ? a > 5 ? 1 : 2 : a < 0 ? 3 : 4"},
+		{"int a;(a>3?1:2)>1?a:0", "int a; (a > 3 ? 1 : 2) > 1 ? a : 0"},
+		{"string s;s=='a\"b'+\"\\t\"", `string s; s == "a\"b" + "\t"`},
+		{"float x;x=sqrt(x!)", "float x; x = sqrt(x!)"},
+		{"int x;let r=clamp(x,0,10);if(r>5){r=5}else if(r<1){r=1;};r", "int x; let r = clamp(x, 0, 10); if (r > 5) { r = 5 } else if (r < 1) { r = 1 }; r"},
+		{"int x;if(x>0){}else{if(x<0){1}else{2}}", "int x; if (x > 0) {} else if (x < 0) { 1 } else { 2 }"},
+		{"has_tag('a.b')&&chance(0.5)", `has_tag("a.b") && chance(0.5)`},
+		{"Health.base*2", "Health.base * 2"},
+	}
+	for _, c := range cases {
+		s, err := Format(c.code)
+		require.Nil(t, err, c.code)
+		assert.Equal(t, c.want, s, c.code)
+		s, err = Format(s)
+		assert.Nil(t, err)
+		assert.Equal(t, c.want, s, "idempotent")
+	}
+
+	_, err := Format("int x; x +")
+	assert.NotNil(t, err)
+}
+
+// TestFormatCorpus 规范形式的求值结果必须与原程序一致
+func TestFormatCorpus(t *testing.T) {
+	for _, c := range corpus {
+		t.Run(c.code, func(t *testing.T) {
+			s, err := Format(c.code)
+			if err != nil {
+				_, e0 := Compile[string, *MockKv](c.code, s2s)
+				assert.NotNil(t, e0)
+				return
+			}
+			s2, err := Format(s)
+			assert.Nil(t, err)
+			assert.Equal(t, s, s2)
+
+			f0, e0 := Compile[string, *MockKv](c.code, s2s)
+			f1, e1 := Compile[string, *MockKv](s, s2s)
+			require.Equal(t, e0 == nil, e1 == nil, "%v %v", e0, e1)
+			if e0 != nil {
+				return
+			}
+			kv0, kv1 := corpusMockKv(c), corpusMockKv(c)
+			v0, e0 := f0(kv0)
+			v1, e1 := f1(kv1)
+			assert.Equal(t, e0 == nil, e1 == nil)
+			assert.Equal(t, v0, v1)
+			assert.Equal(t, kv0.data, kv1.data)
+		})
+	}
+}
+
+func TestErrorPosition(t *testing.T) {
+	cases := []struct {
+		code, at  string
+		line, col int
+	}{
+		{"int x; x + y", "y", 1, 12},
+		{"int x;\nx & 1", "&", 2, 3},
+		{"bool b;\nint x;\nlet r = x * 2;\nr + b", "r + b", 4, 1},
+		{"int x; x = 'a'", "'a'", 1, 12},
+		{"has_tag('a')", "has_tag('a')", 1, 1},
+		{"int x; if (x) { 1 }", "if (x) { 1 }", 1, 8},
+		{"int x; x +", "", 1, 11},
+	}
+	for _, c := range cases {
+		_, err := Compile[string, *MockKv](c.code, s2s)
+		require.NotNil(t, err, c.code)
+		var pe *Error
+		require.True(t, errors.As(err, &pe), "%s: %v", c.code, err)
+		assert.Equal(t, c.at, c.code[pe.Pos:pe.End], c.code)
+		line, col := Position(c.code, pe.Pos)
+		assert.Equal(t, c.line, line, c.code)
+		assert.Equal(t, c.col, col, c.code)
+	}
+}
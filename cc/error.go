@@ -0,0 +1,34 @@
+package cc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error 是带源码位置的错误，Pos/End 是出错片段在源码中的字节区间 [Pos, End)。
+// 语法错误、类型错误与求值错误（变量或属性不存在、Exec 失败等）都以 *Error 返回（可能被包装），
+// 用 errors.As 取出位置。
+type Error struct {
+	Pos, End int
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Position 返回源码中字节偏移 off 所在的行号与列号，均从 1 开始，列号按字节计算
+func Position(src string, off int) (line, col int) {
+	off = min(max(off, 0), len(src))
+	line = 1 + strings.Count(src[:off], "\n")
+	return line, off - strings.LastIndexByte(src[:off], '\n')
+}
+
+// errorf 生成指向节点 n 的错误
+func (n *Node) errorf(format string, args ...any) error {
+	return &Error{Pos: n.Pos, End: n.End, Err: fmt.Errorf(format, args...)}
+}
@@ -0,0 +1,115 @@
+package cc
+
+import (
+	"github.com/legamerdc/game/lib"
+)
+
+// WithFixed 让 float 使用 Q32.32 定点数（lib.Q32）代替 float64，用于帧同步等需要跨平台
+// 逐位一致的场景。字面量按十进制精确舍入，算术、比较、幂以及 abs/min/max/clamp 只使用
+// 整数运算，溢出饱和，舍入与除以零的规则见 lib.Q32。从黑板、属性读到的 int/float 值
+// 在使用时转换为定点数，赋值写回 lib.Fixed。
+//
+// 注册函数（sqrt 等）仍以 float64 计算，结果再舍入为定点数，其确定性取决于函数本身。
+// 定点模式总是使用闭包后端，CompileFloat 返回定点结果转换出的 float64。
+func WithFixed() Option {
+	return func(o *options) {
+		o.fixed = true
+	}
+}
+
+var zeroFixed = lib.Fixed(0)
+
+// phaseFixed 在类型推断完成后把 float 改写为定点类型
+func (n *Node) phaseFixed(m map[string]exprType) {
+	for k, t := range m {
+		if t == exprFloat {
+			m[k] = exprFixed
+		}
+	}
+	n.rewriteFixed()
+}
+
+func (n *Node) rewriteFixed() {
+	if n.Target == exprFloat {
+		n.Target = exprFixed
+	}
+	if n.local != nil && n.local.t == exprFloat {
+		n.local.t = exprFixed
+	}
+	for _, x := range n.Children {
+		x.rewriteFixed()
+	}
+}
+
+// _fixedLoad 把从黑板、属性或注册函数得到的值转换为定点数，结果类型不是定点数时原样返回
+func _fixedLoad[B any](n *Node, f func(frame[B]) (lib.Field, error)) func(frame[B]) (lib.Field, error) {
+	if n.Target != exprFixed {
+		return f
+	}
+	return func(b frame[B]) (v lib.Field, e error) {
+		if v, e = f(b); e != nil {
+			return
+		}
+		q, _ := v.Fixed()
+		return lib.Fixed(q), nil
+	}
+}
+
+func binFixed(op string) func(a, b lib.Q32) lib.Field {
+	switch op {
+	case "^":
+		return func(a, b lib.Q32) lib.Field {
+			return lib.Fixed(a.Pow(b))
+		}
+	case "+":
+		return func(a, b lib.Q32) lib.Field {
+			return lib.Fixed(a.Add(b))
+		}
+	case "-":
+		return func(a, b lib.Q32) lib.Field {
+			return lib.Fixed(a.Sub(b))
+		}
+	case "*":
+		return func(a, b lib.Q32) lib.Field {
+			return lib.Fixed(a.Mul(b))
+		}
+	case "/":
+		return func(a, b lib.Q32) lib.Field {
+			return lib.Fixed(a.Div(b))
+		}
+	case "==":
+		return func(a, b lib.Q32) lib.Field {
+			return lib.Bool(a == b)
+		}
+	case "!=":
+		return func(a, b lib.Q32) lib.Field {
+			return lib.Bool(a != b)
+		}
+	case "<":
+		return func(a, b lib.Q32) lib.Field {
+			return lib.Bool(a < b)
+		}
+	case "<=":
+		return func(a, b lib.Q32) lib.Field {
+			return lib.Bool(a <= b)
+		}
+	case ">":
+		return func(a, b lib.Q32) lib.Field {
+			return lib.Bool(a > b)
+		}
+	case ">=":
+		return func(a, b lib.Q32) lib.Field {
+			return lib.Bool(a >= b)
+		}
+	case "min":
+		return func(a, b lib.Q32) lib.Field {
+			return lib.Fixed(min(a, b))
+		}
+	case "max":
+		return func(a, b lib.Q32) lib.Field {
+			return lib.Fixed(max(a, b))
+		}
+	default:
+		panic("unreachable")
+	}
+}
@@ -0,0 +1,118 @@
+package cc
+
+import (
+	"testing"
+
+	"github.com/legamerdc/game/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixedCorpus 是定点模式的结果语料，期望值是 lib.Q32 的原始位，在任何平台上都必须逐位一致
+var fixedCorpus = []struct {
+	code string
+	want int64
+}{
+	{"float x, y; x * y + 1.5", -1610612736},
+	{"float hp, hpMax; hp / hpMax", 1503238554},
+	{"float x; x ^ 0.5", 6790939566},
+	{"float x, y; x ^ 3 - x ^ -2 + y ^ 2", 68837588337},
+	{"float x, z; z ^ 1.7", 215258277717},
+	{"float z; 2 ^ (z / 4) * 0.001", 24296002},
+	{"float x; x / 0", int64(lib.MaxQ32)},
+	{"float y; y / 0", int64(lib.MinQ32)},
+	{"float x, fz; x / fz + 1", int64(lib.MaxQ32)},
+	{"float z; z * 1000000000 * 1000000000", int64(lib.MaxQ32)},
+	{"float x, y; clamp(x * y, -1, 1)", -4294967296},
+	{"float x, y; min(x, y) + max(x, y) * abs(y)", 4831838208},
+	{"int a; float x; a + x", 40802189312},
+	{"int a, b; float r; r = a / 3.0 + b; r", 22906492245},
+	{"float x, y; x > y ? x - y : y - x", 13958643712},
+	{"float x; let r = x / 3; r * 3", 10737418239},
+	{"0.1 + 0.2", 1288490189},
+	{"float y; -y * -y", 2415919104},
+	{"float x; sqrt(x) * 2", 13581879132},
+}
+
+func TestFixed(t *testing.T) {
+	t.Run("逐位一致", func(t *testing.T) {
+		for _, c := range fixedCorpus {
+			f, err := Compile[string, *MockKv](c.code, s2s, WithFixed())
+			require.Nil(t, err, c.code)
+			v, err := f(corpusMockKv(corpusCase{}))
+			require.Nil(t, err, c.code)
+			assert.Equal(t, lib.Fixed(lib.Q32(c.want)), v, c.code)
+		}
+	})
+
+	t.Run("比较", func(t *testing.T) {
+		cases := map[string]bool{
+			"float hp, hpMax; hp / hpMax < 0.35":  false,
+			"float hp, hpMax; hp / hpMax <= 0.35": true,
+			"0.1 + 0.2 == 0.3":                    true,
+			"float x; x / 3 * 3 == x":             false,
+			"int a; float x; a > x":               true,
+		}
+		for code, want := range cases {
+			f, err := CompileBool[string, *MockKv](code, s2s, WithFixed())
+			require.Nil(t, err, code)
+			v, err := f(corpusMockKv(corpusCase{}))
+			require.Nil(t, err, code)
+			assert.Equal(t, want, v, code)
+		}
+	})
+
+	t.Run("赋值写回定点数", func(t *testing.T) {
+		f, err := Compile[string, *MockKv]("float x, y; int a; y = x * 2; a = a + 1", s2s, WithFixed())
+		require.Nil(t, err)
+		kv := corpusMockKv(corpusCase{})
+		_, err = f(kv)
+		require.Nil(t, err)
+		assert.Equal(t, lib.Fixed(lib.Q32FromInt(5)), kv.data["y"])
+		assert.Equal(t, lib.Int64(8), kv.data["a"])
+	})
+
+	t.Run("各入口结果一致", func(t *testing.T) {
+		for _, c := range fixedCorpus {
+			want := lib.Q32(c.want).Float64()
+			f, err := CompileFloat[string, *MockKv](c.code, s2s, WithFixed())
+			require.Nil(t, err, c.code)
+			v, err := f(corpusMockKv(corpusCase{}))
+			require.Nil(t, err, c.code)
+			assert.Equal(t, want, v, c.code)
+
+			g, err := Compile[string, *MockKv](c.code, s2s, WithFixed(), WithBackend(BackendVM))
+			require.Nil(t, err, c.code)
+			x, err := g(corpusMockKv(corpusCase{}))
+			require.Nil(t, err, c.code)
+			assert.Equal(t, lib.Fixed(lib.Q32(c.want)), x, c.code)
+
+			h, err := CompileTraced[string, *MockKv](c.code, s2s, WithFixed())
+			require.Nil(t, err, c.code)
+			x, _, err = h(corpusMockKv(corpusCase{}))
+			require.Nil(t, err, c.code)
+			assert.Equal(t, lib.Fixed(lib.Q32(c.want)), x, c.code)
+		}
+	})
+
+	t.Run("通用语料重复求值一致", func(t *testing.T) {
+		for _, c := range corpus {
+			f, err := Compile[string, *MockKv](c.code, s2s, WithFixed())
+			if err != nil {
+				continue
+			}
+			kv0, kv1 := corpusMockKv(c), corpusMockKv(c)
+			v0, e0 := f(kv0)
+			v1, e1 := f(kv1)
+			assert.Equal(t, e0, e1, c.code)
+			assert.Equal(t, v0, v1, c.code)
+			assert.Equal(t, kv0.data, kv1.data, c.code)
+		}
+	})
+
+	t.Run("静态分析不受影响", func(t *testing.T) {
+		info, err := Analyze("float x; x * 2", WithFixed())
+		require.Nil(t, err)
+		assert.Equal(t, map[string]Type{"x": TypeFloat}, info.Reads)
+	})
+}
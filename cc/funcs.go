@@ -0,0 +1,328 @@
+package cc
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/legamerdc/game/lib"
+)
+
+var (
+	fmtFuncSig      = "ill func signature: %s"
+	fmtFuncArgCount = "wrong argument count for %s: want %d, got %d"
+	fmtFuncArgType  = "wrong argument type for %s: argument %d"
+)
+
+// Funcs 是编译期函数表。表中的函数带有声明的签名，编译时调用会被解析为
+// 直接的函数指针，参数个数与类型在编译期检查，并参与类型推断。
+// 不在表中的函数仍然按旧方式走 Ctx.Exec，其返回类型由变量声明给出。
+//
+// Funcs 在注册完成后只读，可以被多个 goroutine 并发用于编译。
+type Funcs struct {
+	m map[string]*funcDef
+}
+
+type funcDef struct {
+	name string
+	args []exprType
+	ret  exprType
+	raw  any // 注册时传入的 Go 函数，用于按常见形态特化
+	fn   reflect.Value
+}
+
+func NewFuncs() *Funcs {
+	return &Funcs{m: make(map[string]*funcDef)}
+}
+
+// DefaultFuncs 返回一份内置数学函数表的拷贝，调用方可以在其上继续注册。
+func DefaultFuncs() *Funcs {
+	return mathFuncs.Clone()
+}
+
+func (r *Funcs) Clone() *Funcs {
+	return &Funcs{m: maps.Clone(r.m)}
+}
+
+// Register 注册一个函数。sig 的格式与声明语句一致，例如 "clamp(float,float,float) float"；
+// fn 必须是参数与返回值一一对应的 Go 函数：int->int64, float->float64,
+// bool->bool, string->string, vec2->lib.Vec2, vec3->lib.Vec3。例如 Register("sqrt(float) float", math.Sqrt)。
+func (r *Funcs) Register(sig string, fn any) error {
+	d, e := parseSig(sig)
+	if e != nil {
+		return e
+	}
+	if fn == nil {
+		return fmt.Errorf(fmtFuncSig, sig)
+	}
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func || t.IsVariadic() || t.NumIn() != len(d.args) || t.NumOut() != 1 {
+		return fmt.Errorf(fmtFuncSig, sig)
+	}
+	for i, a := range d.args {
+		if t.In(i) != _type2go(a) {
+			return fmt.Errorf(fmtFuncSig, sig)
+		}
+	}
+	if t.Out(0) != _type2go(d.ret) {
+		return fmt.Errorf(fmtFuncSig, sig)
+	}
+	d.raw, d.fn = fn, v
+	r.m[d.name] = d
+	return nil
+}
+
+func (r *Funcs) MustRegister(sig string, fn any) *Funcs {
+	if e := r.Register(sig, fn); e != nil {
+		panic(e)
+	}
+	return r
+}
+
+func (r *Funcs) lookup(name string) *funcDef {
+	if r == nil {
+		return nil
+	}
+	return r.m[name]
+}
+
+func parseSig(sig string) (*funcDef, error) {
+	head, ret, ok := strings.Cut(sig, ")")
+	if !ok {
+		return nil, fmt.Errorf(fmtFuncSig, sig)
+	}
+	name, args, ok := strings.Cut(head, "(")
+	if !ok {
+		return nil, fmt.Errorf(fmtFuncSig, sig)
+	}
+	d := &funcDef{name: strings.TrimSpace(name)}
+	// 内置运算符（abs/min/max/clamp、随机函数、标签查询）不能注册为函数
+	if d.name == "" || builtinOps[d.name] {
+		return nil, fmt.Errorf(fmtFuncSig, sig)
+	}
+	if args = strings.TrimSpace(args); args != "" {
+		for a := range strings.SplitSeq(args, ",") {
+			et, e := _string2type(strings.TrimSpace(a))
+			if e != nil {
+				return nil, fmt.Errorf(fmtFuncSig, sig)
+			}
+			d.args = append(d.args, et)
+		}
+	}
+	et, e := _string2type(strings.TrimSpace(ret))
+	if e != nil {
+		return nil, fmt.Errorf(fmtFuncSig, sig)
+	}
+	d.ret = et
+	return d, nil
+}
+
+func _type2go(t exprType) reflect.Type {
+	switch t {
+	case exprInt:
+		return reflect.TypeFor[int64]()
+	case exprFloat:
+		return reflect.TypeFor[float64]()
+	case exprBool:
+		return reflect.TypeFor[bool]()
+	case exprString:
+		return reflect.TypeFor[string]()
+	case exprVec2:
+		return reflect.TypeFor[lib.Vec2]()
+	case exprVec3:
+		return reflect.TypeFor[lib.Vec3]()
+	}
+	panic("unreachable")
+}
+
+// compileCall 把调用解析为对 fn 的直接调用。参数已经在编译期按签名做过类型检查并
+// 向下推断为参数类型，因此这里取值时不再检查 ok。对常见的数学函数形态做特化，
+// 避免反射和每次调用的参数切片分配；其余形态走反射调用。
+func compileCall[B any](d *funcDef, fs []func(B) (lib.Field, error)) func(B) (lib.Field, error) {
+	switch fn := d.raw.(type) {
+	case func() float64:
+		return func(B) (lib.Field, error) {
+			return lib.Float64(fn()), nil
+		}
+	case func(float64) float64:
+		f0 := fs[0]
+		return func(b B) (v lib.Field, e error) {
+			if v, e = f0(b); e != nil {
+				return
+			}
+			a0, _ := v.Float64()
+			return lib.Float64(fn(a0)), nil
+		}
+	case func(float64, float64) float64:
+		f0, f1 := fs[0], fs[1]
+		return func(b B) (v lib.Field, e error) {
+			v0, e0 := f0(b)
+			if e0 != nil {
+				return v, e0
+			}
+			v1, e1 := f1(b)
+			if e1 != nil {
+				return v, e1
+			}
+			a0, _ := v0.Float64()
+			a1, _ := v1.Float64()
+			return lib.Float64(fn(a0, a1)), nil
+		}
+	case func(float64, float64, float64) float64:
+		f0, f1, f2 := fs[0], fs[1], fs[2]
+		return func(b B) (v lib.Field, e error) {
+			v0, e0 := f0(b)
+			if e0 != nil {
+				return v, e0
+			}
+			v1, e1 := f1(b)
+			if e1 != nil {
+				return v, e1
+			}
+			v2, e2 := f2(b)
+			if e2 != nil {
+				return v, e2
+			}
+			a0, _ := v0.Float64()
+			a1, _ := v1.Float64()
+			a2, _ := v2.Float64()
+			return lib.Float64(fn(a0, a1, a2)), nil
+		}
+	case func(int64) int64:
+		f0 := fs[0]
+		return func(b B) (v lib.Field, e error) {
+			if v, e = f0(b); e != nil {
+				return
+			}
+			a0, _ := v.Int64()
+			return lib.Int64(fn(a0)), nil
+		}
+	case func(int64, int64) int64:
+		f0, f1 := fs[0], fs[1]
+		return func(b B) (v lib.Field, e error) {
+			v0, e0 := f0(b)
+			if e0 != nil {
+				return v, e0
+			}
+			v1, e1 := f1(b)
+			if e1 != nil {
+				return v, e1
+			}
+			a0, _ := v0.Int64()
+			a1, _ := v1.Int64()
+			return lib.Int64(fn(a0, a1)), nil
+		}
+	}
+	fn, args, ret := d.fn, d.args, d.ret
+	return func(b B) (v lib.Field, e error) {
+		in := make([]reflect.Value, len(fs))
+		for i, f := range fs {
+			if v, e = f(b); e != nil {
+				return
+			}
+			in[i] = _field2value(v, args[i])
+		}
+		return _value2field(fn.Call(in)[0], ret), nil
+	}
+}
+
+// invoke 以参数切片调用 fn，供字节码后端使用。args 由调用方持有，invoke 不会保留它。
+func (d *funcDef) invoke(args []lib.Field) lib.Field {
+	switch fn := d.raw.(type) {
+	case func() float64:
+		return lib.Float64(fn())
+	case func(float64) float64:
+		a0, _ := args[0].Float64()
+		return lib.Float64(fn(a0))
+	case func(float64, float64) float64:
+		a0, _ := args[0].Float64()
+		a1, _ := args[1].Float64()
+		return lib.Float64(fn(a0, a1))
+	case func(float64, float64, float64) float64:
+		a0, _ := args[0].Float64()
+		a1, _ := args[1].Float64()
+		a2, _ := args[2].Float64()
+		return lib.Float64(fn(a0, a1, a2))
+	case func(int64) int64:
+		a0, _ := args[0].Int64()
+		return lib.Int64(fn(a0))
+	case func(int64, int64) int64:
+		a0, _ := args[0].Int64()
+		a1, _ := args[1].Int64()
+		return lib.Int64(fn(a0, a1))
+	}
+	in := make([]reflect.Value, len(args))
+	for i, v := range args {
+		in[i] = _field2value(v, d.args[i])
+	}
+	return _value2field(d.fn.Call(in)[0], d.ret)
+}
+
+func _field2value(v lib.Field, t exprType) reflect.Value {
+	switch t {
+	case exprInt:
+		x, _ := v.Int64()
+		return reflect.ValueOf(x)
+	case exprFloat:
+		x, _ := v.Float64()
+		return reflect.ValueOf(x)
+	case exprBool:
+		x, _ := v.Bool()
+		return reflect.ValueOf(x)
+	case exprString:
+		x, _ := v.Str()
+		return reflect.ValueOf(x)
+	case exprVec2:
+		x, _ := v.Vec2()
+		return reflect.ValueOf(x)
+	case exprVec3:
+		x, _ := v.Vec3()
+		return reflect.ValueOf(x)
+	}
+	panic("unreachable")
+}
+
+func _value2field(v reflect.Value, t exprType) lib.Field {
+	switch t {
+	case exprInt:
+		return lib.Int64(v.Int())
+	case exprFloat:
+		return lib.Float64(v.Float())
+	case exprBool:
+		return lib.Bool(v.Bool())
+	case exprString:
+		return lib.String(v.String())
+	case exprVec2:
+		return lib.Vector2(v.Interface().(lib.Vec2))
+	case exprVec3:
+		return lib.Vector3(v.Interface().(lib.Vec3))
+	}
+	panic("unreachable")
+}
+
+var builtinOps = map[string]bool{"abs": true, "min": true, "max": true, "clamp": true, "rand": true, "randint": true, "chance": true, "has_tag": true, "has_tag_exact": true,
+	"vec2": true, "vec3": true, "dist": true, "len": true, "dot": true, "normalize": true, "angle": true}
+
+var mathFuncs = NewFuncs().
+	MustRegister("sqrt(float) float", math.Sqrt).
+	MustRegister("cbrt(float) float", math.Cbrt).
+	MustRegister("floor(float) float", math.Floor).
+	MustRegister("ceil(float) float", math.Ceil).
+	MustRegister("round(float) float", math.Round).
+	MustRegister("trunc(float) float", math.Trunc).
+	MustRegister("sin(float) float", math.Sin).
+	MustRegister("cos(float) float", math.Cos).
+	MustRegister("tan(float) float", math.Tan).
+	MustRegister("asin(float) float", math.Asin).
+	MustRegister("acos(float) float", math.Acos).
+	MustRegister("atan(float) float", math.Atan).
+	MustRegister("atan2(float,float) float", math.Atan2).
+	MustRegister("exp(float) float", math.Exp).
+	MustRegister("log(float) float", math.Log).
+	MustRegister("log2(float) float", math.Log2).
+	MustRegister("log10(float) float", math.Log10).
+	MustRegister("pow(float,float) float", math.Pow).
+	MustRegister("hypot(float,float) float", math.Hypot)
@@ -0,0 +1,159 @@
+package cc
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/legamerdc/game/lib"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFuncs(t *testing.T) {
+	t.Run("内置数学函数", func(t *testing.T) {
+		f, err := Compile[string, *MockKv]("int x; sqrt(x * x + 16)", s2s)
+		assert.Nil(t, err)
+
+		kv := NewMockKv()
+		kv.SetInt64("x", 3)
+		v, err := f(kv)
+		assert.Nil(t, err)
+		fv, ok := v.Float64()
+		assert.True(t, ok)
+		assert.Equal(t, 5.0, fv)
+	})
+
+	t.Run("多参数与嵌套调用", func(t *testing.T) {
+		f, err := Compile[string, *MockKv]("float hp, hp_max; clamp(hp / hp_max, 0, 1) + max(floor(2.7), 1) * atan2(0, 1)", s2s)
+		assert.Nil(t, err)
+
+		kv := NewMockKv()
+		kv.SetFloat64("hp", 150)
+		kv.SetFloat64("hp_max", 100)
+		v, err := f(kv)
+		assert.Nil(t, err)
+		fv, _ := v.Float64()
+		assert.Equal(t, 1.0, fv)
+	})
+
+	t.Run("返回值参与类型推断", func(t *testing.T) {
+		_, err := Compile[string, *MockKv]("float x; sqrt(x) > 2 && abs(x) < 10", s2s)
+		assert.Nil(t, err)
+
+		// float 返回值不能赋给 int 变量
+		_, err = Compile[string, *MockKv]("int y; float x; y = sqrt(x)", s2s)
+		assert.NotNil(t, err)
+
+		// float 返回值不能参与 %
+		_, err = Compile[string, *MockKv]("float x; sqrt(x) % 2", s2s)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("参数检查", func(t *testing.T) {
+		_, err := Compile[string, *MockKv]("float x; sqrt(x, x)", s2s)
+		assert.NotNil(t, err)
+
+		_, err = Compile[string, *MockKv]("sqrt()", s2s)
+		assert.NotNil(t, err)
+
+		_, err = Compile[string, *MockKv]("bool x; sqrt(x)", s2s)
+		assert.NotNil(t, err)
+
+		_, err = Compile[string, *MockKv]("string x; sqrt(x)", s2s)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("自定义函数表", func(t *testing.T) {
+		fs := DefaultFuncs().
+			MustRegister("double(int) int", func(x int64) int64 { return x * 2 }).
+			MustRegister("prefix(string,int) string", func(s string, n int64) string { return s[:n] }).
+			MustRegister("even(int) bool", func(x int64) bool { return x%2 == 0 })
+		f, err := Compile[string, *MockKv](`int x; string s; even(double(x)) && prefix(s, 2) == "or" && sqrt(4) == 2`, s2s, WithFuncs(fs))
+		assert.Nil(t, err)
+
+		kv := NewMockKv()
+		kv.SetInt64("x", 3)
+		kv.Set("s", lib.String("orc"))
+		v, err := f(kv)
+		assert.Nil(t, err)
+		bv, _ := v.Bool()
+		assert.True(t, bv)
+
+		// 自定义函数不会污染默认函数表
+		_, err = Compile[string, *MockKv]("int x; double(x)", s2s)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("未注册函数走Exec", func(t *testing.T) {
+		f, err := Compile[string, *MockKv]("int x, f1; f1(x)", s2s)
+		assert.Nil(t, err)
+
+		kv := NewMockKv()
+		kv.SetInt64("x", 4)
+		v, err := f(kv)
+		assert.Nil(t, err)
+		iv, _ := v.Int64()
+		assert.Equal(t, int64(16), iv)
+
+		// 关闭函数表后 sqrt 也需要声明并走 Exec
+		_, err = Compile[string, *MockKv]("float x; sqrt(x)", s2s, WithFuncs(nil))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("参数错误传递", func(t *testing.T) {
+		f, err := Compile[string, *MockKv]("float x; sqrt(x!)", s2s)
+		assert.Nil(t, err)
+
+		_, err = f(NewMockKv())
+		assert.NotNil(t, err)
+	})
+}
+
+func TestFuncsRegister(t *testing.T) {
+	fs := NewFuncs()
+	assert.Nil(t, fs.Register("sqrt(float) float", math.Sqrt))
+	assert.Nil(t, fs.Register(" upper ( string ) string ", strings.ToUpper))
+	assert.Nil(t, fs.Register("now() int", func() int64 { return 0 }))
+
+	assert.NotNil(t, fs.Register("sqrt(float) int", math.Sqrt))
+	assert.NotNil(t, fs.Register("sqrt(int) float", math.Sqrt))
+	assert.NotNil(t, fs.Register("sqrt(float, float) float", math.Sqrt))
+	assert.NotNil(t, fs.Register("sqrt(double) float", math.Sqrt))
+	assert.NotNil(t, fs.Register("sqrt float", math.Sqrt))
+	assert.NotNil(t, fs.Register("(float) float", math.Sqrt))
+	assert.NotNil(t, fs.Register("sqrt(float) float", 3))
+	assert.NotNil(t, fs.Register("sqrt(float) float", nil))
+	assert.NotNil(t, fs.Register("n(int) int", func(x int) int { return x }))
+}
+
+// BenchmarkFuncCall 以注册函数和 Ctx.Exec 两种方式调用同一个函数 f1(x) = x * x
+func BenchmarkFuncCall(b *testing.B) {
+	kv := NewMockKv()
+	kv.SetInt64("x", 3)
+	fs := DefaultFuncs().MustRegister("f1(int) int", func(x int64) int64 { return x * x })
+	cases := []struct {
+		name string
+		code string
+		opts []Option
+	}{
+		{"registry", "int x; f1(x) > 4", []Option{WithFuncs(fs)}},
+		{"exec", "int x, f1; f1(x) > 4", nil},
+	}
+	for _, c := range cases {
+		b.Run(c.name, func(b *testing.B) {
+			f, err := Compile[string, *MockKv](c.code, s2s, c.opts...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if v, _ := f(kv); v != lib.Bool(true) {
+				b.Fatal(v)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, _ = f(kv)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ package cc
 import (
     "fmt"
     "strconv"
+    "strings"
 )
 
 // 语法树节点类型
@@ -21,6 +22,12 @@ const (
     NodeFunc
     NodeNumber
     NodeBool
+    NodeString
+    NodeBlock
+    NodeIf
+    NodeLet
+    NodeBuiltin
+    NodeMember // 向量分量 v.x，Token 为分量名
 )
 
 // 语法树节点
@@ -29,6 +36,14 @@ type Node struct {
     Target   exprType
     Token    string
     Children []*Node
+    Pos, End int // 节点在源码中的字节区间 [Pos, End)
+
+    def   *funcDef // 类型推断阶段解析出的注册函数，nil 表示走 Ctx.Exec
+    local *local   // 名字解析到的 let 局部变量，nil 表示黑板变量
+    attr  *attrRef // 名字解析到的属性，见 WithAttrs
+    tag   *tagRef  // has_tag 解析到的标签，见 WithTags
+    probe any      // 追踪求值时替代子节点的已编译闭包，见 CompileTraced
+    safe  bool     // 求值时检查除以零、溢出等运行时错误，见 WithSafe
 }
 
 // 注意：不再使用全局变量，改为在 lexer 实例中存储结果
@@ -39,12 +54,15 @@ type Node struct {
     str     string
     num     float64
     bool    bool
+    pos     int // 记号在源码中的起始字节偏移
+    end     int // 记号结束的字节偏移
 }
 
 %token <str> IDENT
 %token <str> NUMBER
 %token <bool> BOOLEAN
-%token INT FLOAT BOOL
+%token <str> STRING_LIT
+%token INT FLOAT BOOL STRING
 %token TRUE FALSE
 %token ASSIGN
 %token SEMICOLON
@@ -55,10 +73,22 @@ type Node struct {
 %token AND OR NOT
 %token LT LE GT GE EQ NE
 %token DOLLAR
+%token LBRACE RBRACE
+%token IF ELSE LET
+%token MIN MAX CLAMP ABS
+%token RAND RANDINT CHANCE
+%token HAS_TAG HAS_TAG_EXACT
+%token VEC2 VEC3 DIST LEN DOT NORMALIZE ANGLE
+%token PERIOD
 
 %type <node> program
 %type <node> statement_list
+%type <node> open_list
+%type <node> closed_list
 %type <node> statement
+%type <node> block
+%type <node> if_stmt
+%type <node> let_stmt
 %type <node> var_decl
 %type <str> var_list
 %type <node> assignment
@@ -76,6 +106,8 @@ type Node struct {
 %type <node> expr_list
 %type <str> type_name
 
+%nonassoc LOWER_THAN_ELSE
+%nonassoc ELSE
 %right QUESTION COLON
 %left OR
 %left AND
@@ -91,43 +123,112 @@ type Node struct {
 program:
     statement_list
     {
-        if $1.Type == NodeProgram {
-            $$ = $1
+        if len($1.Children) == 0 {
+            yylex.Error("empty program")
         } else {
-            $$ = &Node{Type: NodeProgram, Children: []*Node{$1}}
+            $1.Pos, $1.End = $1.Children[0].Pos, $1.Children[len($1.Children)-1].End
         }
+        $$ = $1
         yylex.(*SimpleLexer).result = $$
     }
 ;
 
+// 语句之间用分号分隔；以 } 结尾的 if 语句后面可以省略分号，末尾多余的分号会被忽略
 statement_list:
-    statement
+    open_list       { $$ = $1 }
+|   closed_list     { $$ = $1 }
+;
+
+// closed_list 以分号或 if 语句结尾，后面可以直接跟下一条语句
+closed_list:
+    /* empty */
+    {
+        $$ = &Node{Type: NodeProgram}
+    }
+|   open_list SEMICOLON
     {
         $$ = $1
     }
-|   statement_list SEMICOLON statement
+|   closed_list SEMICOLON
     {
-        // 如果第一个节点不是NodeProgram类型，创建一个包装节点
-        if $1.Type != NodeProgram {
-            $$ = &Node{Type: NodeProgram, Children: []*Node{$1, $3}}
-        } else {
-            $1.Children = append($1.Children, $3)
-            $$ = $1
-        }
+        $$ = $1
+    }
+|   closed_list if_stmt
+    {
+        $1.Children = append($1.Children, $2)
+        $$ = $1
+    }
+;
+
+open_list:
+    closed_list statement
+    {
+        $1.Children = append($1.Children, $2)
+        $$ = $1
     }
 ;
 
 statement:
     var_decl        { $$ = $1 }
 |   assignment      { $$ = $1 }
+|   let_stmt        { $$ = $1 }
 |   expr            { $$ = $1 }
 ;
 
+block:
+    LBRACE statement_list RBRACE
+    {
+        $2.Type = NodeBlock
+        $2.Pos, $2.End = $<pos>1, $<end>3
+        $$ = $2
+    }
+;
+
+if_stmt:
+    IF LPAREN expr RPAREN block %prec LOWER_THAN_ELSE
+    {
+        $$ = &Node{
+            Type: NodeIf,
+            Pos: $<pos>1, End: $5.End,
+            Children: []*Node{$3, $5},
+        }
+    }
+|   IF LPAREN expr RPAREN block ELSE block
+    {
+        $$ = &Node{
+            Type: NodeIf,
+            Pos: $<pos>1, End: $7.End,
+            Children: []*Node{$3, $5, $7},
+        }
+    }
+|   IF LPAREN expr RPAREN block ELSE if_stmt
+    {
+        $$ = &Node{
+            Type: NodeIf,
+            Pos: $<pos>1, End: $7.End,
+            Children: []*Node{$3, $5, {Type: NodeBlock, Pos: $7.Pos, End: $7.End, Children: []*Node{$7}}},
+        }
+    }
+;
+
+let_stmt:
+    LET IDENT ASSIGN expr
+    {
+        $$ = &Node{
+            Type: NodeLet,
+            Pos: $<pos>1, End: $4.End,
+            Token: $2,
+            Children: []*Node{$4},
+        }
+    }
+;
+
 var_decl:
     type_name var_list
     {
         $$ = &Node{
             Type: NodeVarDecl,
+            Pos: $<pos>1, End: $<end>2,
             Token: $1 + ":" + $2,
         }
     }
@@ -141,6 +242,7 @@ var_list:
 |   var_list COMMA IDENT
     {
         $$ = $1 + "," + $3
+        $<end>$ = $<end>3
     }
 ;
 
@@ -148,6 +250,9 @@ type_name:
     INT     { $$ = "int" }
 |   FLOAT   { $$ = "float" }
 |   BOOL    { $$ = "bool" }
+|   STRING  { $$ = "string" }
+|   VEC2    { $$ = "vec2" }
+|   VEC3    { $$ = "vec3" }
 ;
 
 assignment:
@@ -155,6 +260,7 @@ assignment:
     {
         $$ = &Node{
             Type: NodeAssign,
+            Pos: $<pos>1, End: $3.End,
             Token: $1,
             Children: []*Node{$3},
         }
@@ -174,6 +280,7 @@ ternary_expr:
     {
         $$ = &Node{
             Type: NodeTernary,
+            Pos: $1.Pos, End: $5.End,
             Token: "?:",
             Children: []*Node{$1, $3, $5},
         }
@@ -189,6 +296,7 @@ logical_or_expr:
     {
         $$ = &Node{
             Type: NodeBinOp,
+            Pos: $1.Pos, End: $3.End,
             Token: "||",
             Children: []*Node{$1, $3},
         }
@@ -204,6 +312,7 @@ logical_and_expr:
     {
         $$ = &Node{
             Type: NodeBinOp,
+            Pos: $1.Pos, End: $3.End,
             Token: "&&",
             Children: []*Node{$1, $3},
         }
@@ -219,6 +328,7 @@ equality_expr:
     {
         $$ = &Node{
             Type: NodeBinOp,
+            Pos: $1.Pos, End: $3.End,
             Token: "==",
             Children: []*Node{$1, $3},
         }
@@ -227,6 +337,7 @@ equality_expr:
     {
         $$ = &Node{
             Type: NodeBinOp,
+            Pos: $1.Pos, End: $3.End,
             Token: "!=",
             Children: []*Node{$1, $3},
         }
@@ -242,6 +353,7 @@ relational_expr:
     {
         $$ = &Node{
             Type: NodeBinOp,
+            Pos: $1.Pos, End: $3.End,
             Token: "<",
             Children: []*Node{$1, $3},
         }
@@ -250,6 +362,7 @@ relational_expr:
     {
         $$ = &Node{
             Type: NodeBinOp,
+            Pos: $1.Pos, End: $3.End,
             Token: "<=",
             Children: []*Node{$1, $3},
         }
@@ -258,6 +371,7 @@ relational_expr:
     {
         $$ = &Node{
             Type: NodeBinOp,
+            Pos: $1.Pos, End: $3.End,
             Token: ">",
             Children: []*Node{$1, $3},
         }
@@ -266,6 +380,7 @@ relational_expr:
     {
         $$ = &Node{
             Type: NodeBinOp,
+            Pos: $1.Pos, End: $3.End,
             Token: ">=",
             Children: []*Node{$1, $3},
         }
@@ -281,6 +396,7 @@ additive_expr:
     {
         $$ = &Node{
             Type: NodeBinOp,
+            Pos: $1.Pos, End: $3.End,
             Token: "+",
             Children: []*Node{$1, $3},
         }
@@ -289,6 +405,7 @@ additive_expr:
     {
         $$ = &Node{
             Type: NodeBinOp,
+            Pos: $1.Pos, End: $3.End,
             Token: "-",
             Children: []*Node{$1, $3},
         }
@@ -304,6 +421,7 @@ multiplicative_expr:
     {
         $$ = &Node{
             Type: NodeBinOp,
+            Pos: $1.Pos, End: $3.End,
             Token: "*",
             Children: []*Node{$1, $3},
         }
@@ -312,6 +430,7 @@ multiplicative_expr:
     {
         $$ = &Node{
             Type: NodeBinOp,
+            Pos: $1.Pos, End: $3.End,
             Token: "/",
             Children: []*Node{$1, $3},
         }
@@ -320,6 +439,7 @@ multiplicative_expr:
     {
         $$ = &Node{
             Type: NodeBinOp,
+            Pos: $1.Pos, End: $3.End,
             Token: "%",
             Children: []*Node{$1, $3},
         }
@@ -335,6 +455,7 @@ power_expr:
     {
         $$ = &Node{
             Type: NodeBinOp,
+            Pos: $1.Pos, End: $3.End,
             Token: "^",
             Children: []*Node{$1, $3},
         }
@@ -350,6 +471,7 @@ unary_expr:
     {
         $$ = &Node{
             Type: NodeUnaryOp,
+            Pos: $<pos>1, End: $2.End,
             Token: "+",
             Children: []*Node{$2},
         }
@@ -358,6 +480,7 @@ unary_expr:
     {
         $$ = &Node{
             Type: NodeUnaryOp,
+            Pos: $<pos>1, End: $2.End,
             Token: "-",
             Children: []*Node{$2},
         }
@@ -366,6 +489,7 @@ unary_expr:
     {
         $$ = &Node{
             Type: NodeUnaryOp,
+            Pos: $<pos>1, End: $2.End,
             Token: "!",
             Children: []*Node{$2},
         }
@@ -375,22 +499,34 @@ unary_expr:
 primary_expr:
     IDENT NOT
     {
-        $$ = &Node{
+        $$ = _member(&Node{
             Type: NodeIdent,
+            Pos: $<pos>1, End: $<end>2,
             Token: $1,
-        }
+        })
     }
 |   IDENT
     {
-        $$ = &Node{
+        $$ = _member(&Node{
             Type: NodeTryIdent,
+            Pos: $<pos>1, End: $<end>1,
             Token: $1,
+        })
+    }
+|   primary_expr PERIOD IDENT
+    {
+        $$ = &Node{
+            Type: NodeMember,
+            Pos: $1.Pos, End: $<end>3,
+            Token: $3,
+            Children: []*Node{$1},
         }
     }
 |   IDENT LPAREN RPAREN
     {
         $$ = &Node{
             Type: NodeFunc,
+            Pos: $<pos>1, End: $<end>3,
             Token: $1,
         }
     }
@@ -398,14 +534,167 @@ primary_expr:
     {
         $$ = &Node{
             Type: NodeFunc,
+            Pos: $<pos>1, End: $<end>4,
             Token: $1,
             Children: $3.Children,
         }
     }
+|   ABS LPAREN expr RPAREN
+    {
+        $$ = &Node{
+            Type: NodeBuiltin,
+            Pos: $<pos>1, End: $<end>4,
+            Token: "abs",
+            Children: []*Node{$3},
+        }
+    }
+|   MIN LPAREN expr COMMA expr RPAREN
+    {
+        $$ = &Node{
+            Type: NodeBuiltin,
+            Pos: $<pos>1, End: $<end>6,
+            Token: "min",
+            Children: []*Node{$3, $5},
+        }
+    }
+|   MAX LPAREN expr COMMA expr RPAREN
+    {
+        $$ = &Node{
+            Type: NodeBuiltin,
+            Pos: $<pos>1, End: $<end>6,
+            Token: "max",
+            Children: []*Node{$3, $5},
+        }
+    }
+|   CLAMP LPAREN expr COMMA expr COMMA expr RPAREN
+    {
+        $$ = &Node{
+            Type: NodeBuiltin,
+            Pos: $<pos>1, End: $<end>8,
+            Token: "clamp",
+            Children: []*Node{$3, $5, $7},
+        }
+    }
+|   RAND LPAREN RPAREN
+    {
+        $$ = &Node{
+            Type: NodeBuiltin,
+            Pos: $<pos>1, End: $<end>3,
+            Token: "rand",
+        }
+    }
+|   RANDINT LPAREN expr COMMA expr RPAREN
+    {
+        $$ = &Node{
+            Type: NodeBuiltin,
+            Pos: $<pos>1, End: $<end>6,
+            Token: "randint",
+            Children: []*Node{$3, $5},
+        }
+    }
+|   CHANCE LPAREN expr RPAREN
+    {
+        $$ = &Node{
+            Type: NodeBuiltin,
+            Pos: $<pos>1, End: $<end>4,
+            Token: "chance",
+            Children: []*Node{$3},
+        }
+    }
+|   HAS_TAG LPAREN STRING_LIT RPAREN
+    {
+        $$ = &Node{
+            Type: NodeBuiltin,
+            Pos: $<pos>1, End: $<end>4,
+            Token: "has_tag",
+            Children: []*Node{{Type: NodeString, Token: $3, Pos: $<pos>3, End: $<end>3}},
+        }
+    }
+|   HAS_TAG_EXACT LPAREN STRING_LIT RPAREN
+    {
+        $$ = &Node{
+            Type: NodeBuiltin,
+            Pos: $<pos>1, End: $<end>4,
+            Token: "has_tag_exact",
+            Children: []*Node{{Type: NodeString, Token: $3, Pos: $<pos>3, End: $<end>3}},
+        }
+    }
+|   VEC2 LPAREN expr COMMA expr RPAREN
+    {
+        $$ = &Node{
+            Type: NodeBuiltin,
+            Pos: $<pos>1, End: $<end>6,
+            Token: "vec2",
+            Children: []*Node{$3, $5},
+        }
+    }
+|   VEC3 LPAREN expr COMMA expr COMMA expr RPAREN
+    {
+        $$ = &Node{
+            Type: NodeBuiltin,
+            Pos: $<pos>1, End: $<end>8,
+            Token: "vec3",
+            Children: []*Node{$3, $5, $7},
+        }
+    }
+|   DIST LPAREN expr COMMA expr RPAREN
+    {
+        $$ = &Node{
+            Type: NodeBuiltin,
+            Pos: $<pos>1, End: $<end>6,
+            Token: "dist",
+            Children: []*Node{$3, $5},
+        }
+    }
+|   DOT LPAREN expr COMMA expr RPAREN
+    {
+        $$ = &Node{
+            Type: NodeBuiltin,
+            Pos: $<pos>1, End: $<end>6,
+            Token: "dot",
+            Children: []*Node{$3, $5},
+        }
+    }
+|   ANGLE LPAREN expr COMMA expr RPAREN
+    {
+        $$ = &Node{
+            Type: NodeBuiltin,
+            Pos: $<pos>1, End: $<end>6,
+            Token: "angle",
+            Children: []*Node{$3, $5},
+        }
+    }
+|   LEN LPAREN expr RPAREN
+    {
+        $$ = &Node{
+            Type: NodeBuiltin,
+            Pos: $<pos>1, End: $<end>4,
+            Token: "len",
+            Children: []*Node{$3},
+        }
+    }
+|   NORMALIZE LPAREN expr RPAREN
+    {
+        $$ = &Node{
+            Type: NodeBuiltin,
+            Pos: $<pos>1, End: $<end>4,
+            Token: "normalize",
+            Children: []*Node{$3},
+        }
+    }
 |   NUMBER
     {
         $$ = &Node{
             Type: NodeNumber,
+            Pos: $<pos>1, End: $<end>1,
+            Token: $1,
+        }
+    }
+|   STRING_LIT
+    {
+        $$ = &Node{
+            Type: NodeString,
+            Pos: $<pos>1, End: $<end>1,
             Token: $1,
         }
     }
@@ -413,6 +702,7 @@ primary_expr:
     {
         $$ = &Node{
             Type: NodeBool,
+            Pos: $<pos>1, End: $<end>1,
             Token: "true",
         }
     }
@@ -420,11 +710,13 @@ primary_expr:
     {
         $$ = &Node{
             Type: NodeBool,
+            Pos: $<pos>1, End: $<end>1,
             Token: "false",
         }
     }
 |   LPAREN expr RPAREN
     {
+        $2.Pos, $2.End = $<pos>1, $<end>3
         $$ = $2
     }
 ;
@@ -456,6 +748,7 @@ type Lexer interface {
 type SimpleLexer struct {
     input  string
     pos    int
+    start  int    // 当前记号的起始位置
     line   int
     result *Node  // 存储解析结果，替代全局变量
     e      error  // 存储编译过程中遇到的错误
@@ -465,11 +758,23 @@ func NewLexer(input string) *SimpleLexer {
     return &SimpleLexer{input: input, pos: 0, line: 1}
 }
 
+// Error 记录第一个错误，位置是出错的记号
 func (l *SimpleLexer) Error(s string) {
-    l.e = fmt.Errorf("parse fail line:%d pos:%d error:%s", l.line, l.pos, s)
+    if l.e != nil {
+        return
+    }
+    end := min(max(l.pos, l.start+1), len(l.input))
+    l.e = &Error{Pos: min(l.start, end), End: end, Err: fmt.Errorf("parse fail line:%d pos:%d error:%s", l.line, l.pos, s)}
 }
 
+// Lex 返回下一个记号，并在 lval 中记录记号的字节区间
 func (l *SimpleLexer) Lex(lval *yySymType) int {
+    t := l.lex(lval)
+    lval.pos, lval.end = l.start, l.pos
+    return t
+}
+
+func (l *SimpleLexer) lex(lval *yySymType) int {
     for l.pos < len(l.input) {
         ch := l.input[l.pos]
         
@@ -484,6 +789,7 @@ func (l *SimpleLexer) Lex(lval *yySymType) int {
             l.pos++
             continue
         }
+        l.start = l.pos
         
         // 识别各种token
         switch ch {
@@ -503,6 +809,12 @@ func (l *SimpleLexer) Lex(lval *yySymType) int {
         case ')':
             l.pos++
             return RPAREN
+        case '{':
+            l.pos++
+            return LBRACE
+        case '}':
+            l.pos++
+            return RBRACE
         case '+':
             l.pos++
             return PLUS
@@ -533,6 +845,8 @@ func (l *SimpleLexer) Lex(lval *yySymType) int {
         case '$':
             l.pos++
             return DOLLAR
+        case '"', '\'':
+            return l.lexString(lval)
         case '!':
             if l.pos+1 < len(l.input) && l.input[l.pos+1] == '=' {
                 l.pos += 2
@@ -574,6 +888,12 @@ func (l *SimpleLexer) Lex(lval *yySymType) int {
             continue
         }
         
+        // . 后紧跟名字是分量访问，如 (a - b).x
+        if ch == '.' && l.pos+1 < len(l.input) && isIdentStart(l.input[l.pos+1]) {
+            l.pos++
+            return PERIOD
+        }
+
         // 识别数字（包括以点开头的小数）
         if (ch >= '0' && ch <= '9') || 
            (ch == '.' && l.pos+1 < len(l.input) && l.input[l.pos+1] >= '0' && l.input[l.pos+1] <= '9') {
@@ -589,6 +909,7 @@ func (l *SimpleLexer) Lex(lval *yySymType) int {
         l.Error(fmt.Sprintf("unexpected character '%c' at position %d", ch, l.pos))
         l.pos++
     }
+    l.start = l.pos
     return 0 // EOF
 }
 
@@ -618,7 +939,7 @@ func (l *SimpleLexer) lexNumber(lval *yySymType) int {
         l.pos = start + 1
         l.Error(fmt.Sprintf("invalid number format '%s' at position %d", 
                           l.input[start:l.pos], start))
-        return l.Lex(lval)  // 递归调用继续处理
+        return l.lex(lval)  // 递归调用继续处理
     }
     
     if _, err := strconv.ParseFloat(numStr, 64); err == nil {
@@ -629,7 +950,42 @@ func (l *SimpleLexer) lexNumber(lval *yySymType) int {
     // 如果数字格式无效，回退并报错
     l.pos = start + 1
     l.Error(fmt.Sprintf("invalid number format '%s' at position %d", numStr, start))
-    return l.Lex(lval)  // 递归调用继续处理
+    return l.lex(lval)  // 递归调用继续处理
+}
+
+// lexString 识别单引号或双引号包围的字符串字面量，支持 \\ \" \' \n \t 转义
+func (l *SimpleLexer) lexString(lval *yySymType) int {
+    start := l.pos
+    quote := l.input[l.pos]
+    l.pos++
+    var sb strings.Builder
+    for l.pos < len(l.input) {
+        ch := l.input[l.pos]
+        switch {
+        case ch == quote:
+            l.pos++
+            lval.str = sb.String()
+            return STRING_LIT
+        case ch == '\\' && l.pos+1 < len(l.input):
+            switch esc := l.input[l.pos+1]; esc {
+            case 'n':
+                sb.WriteByte('\n')
+            case 't':
+                sb.WriteByte('\t')
+            case '\\', '"', '\'':
+                sb.WriteByte(esc)
+            default:
+                l.Error(fmt.Sprintf("invalid escape '\\%c' at position %d", esc, l.pos))
+            }
+            l.pos += 2
+        default:
+            sb.WriteByte(ch)
+            l.pos++
+        }
+    }
+    // 未闭合的字符串，报告错误后把剩余输入视为结束
+    l.Error(fmt.Sprintf("unterminated string at position %d", start))
+    return 0
 }
 
 func (l *SimpleLexer) lexIdent(lval *yySymType) int {
@@ -645,8 +1001,21 @@ func (l *SimpleLexer) lexIdent(lval *yySymType) int {
         }
     }
     
+    // 标识符后紧跟的 .name 是标识符的一部分，如 Health.base
+    for l.pos+1 < len(l.input) && l.input[l.pos] == '.' && isIdentStart(l.input[l.pos+1]) {
+        l.pos += 2
+        for l.pos < len(l.input) && (isIdentStart(l.input[l.pos]) || (l.input[l.pos] >= '0' && l.input[l.pos] <= '9')) {
+            l.pos++
+        }
+    }
+
     ident := l.input[start:l.pos]
     lval.str = ident
+
+    // 函数形式的内置运算只在调用时是关键字，min、rand、has_tag、dist 等仍可以作为变量名
+    if builtinOps[ident] && ident != "vec2" && ident != "vec3" && !l.callFollows() {
+        return IDENT
+    }
     
     // 检查关键字
     switch ident {
@@ -656,6 +1025,46 @@ func (l *SimpleLexer) lexIdent(lval *yySymType) int {
         return FLOAT
     case "bool":
         return BOOL
+    case "string":
+        return STRING
+    case "if":
+        return IF
+    case "else":
+        return ELSE
+    case "let":
+        return LET
+    case "min":
+        return MIN
+    case "max":
+        return MAX
+    case "clamp":
+        return CLAMP
+    case "abs":
+        return ABS
+    case "rand":
+        return RAND
+    case "randint":
+        return RANDINT
+    case "chance":
+        return CHANCE
+    case "has_tag":
+        return HAS_TAG
+    case "has_tag_exact":
+        return HAS_TAG_EXACT
+    case "vec2":
+        return VEC2
+    case "vec3":
+        return VEC3
+    case "dist":
+        return DIST
+    case "len":
+        return LEN
+    case "dot":
+        return DOT
+    case "normalize":
+        return NORMALIZE
+    case "angle":
+        return ANGLE
     case "true":
         lval.bool = true
         return TRUE
@@ -667,11 +1076,43 @@ func (l *SimpleLexer) lexIdent(lval *yySymType) int {
     }
 }
 
+// _member 把 v.x 形式的标识符拆为对变量 v 的分量访问，v! 的强制读取作用于 v。
+// 属性名中的 .base 等后缀不是分量名，保持不变。
+func _member(n *Node) *Node {
+    i := strings.LastIndexByte(n.Token, '.')
+    if i < 0 || !vecComponents[n.Token[i+1:]] {
+        return n
+    }
+    v := &Node{Type: n.Type, Pos: n.Pos, End: n.Pos + i, Token: n.Token[:i]}
+    return &Node{Type: NodeMember, Pos: n.Pos, End: n.End, Token: n.Token[i+1:], Children: []*Node{_member(v)}}
+}
+
+// callFollows 判断跳过空白后的下一个字符是否为 (
+func (l *SimpleLexer) callFollows() bool {
+    for i := l.pos; i < len(l.input); i++ {
+        switch l.input[i] {
+        case ' ', '\t', '\n', '\r':
+            continue
+        case '(':
+            return true
+        }
+        return false
+    }
+    return false
+}
+
+func isIdentStart(ch byte) bool {
+    return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || ch == '_'
+}
+
 // 解析函数
 func parse(input string) (*Node, error) {
     lexer := NewLexer(input)
     if yyParse(lexer) != 0 {
-        return nil, fmt.Errorf("fail: %v", lexer.e)
+        return nil, fmt.Errorf("fail: %w", lexer.e)
+    }
+    if lexer.e != nil {
+        return nil, fmt.Errorf("fail: %w", lexer.e)
     }
     return lexer.result, nil
 }
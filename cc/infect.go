@@ -21,6 +21,77 @@ func (n *Node) phaseVar() (m map[string]exprType, e error) {
 	return m, nil
 }
 
+// local 是一个 let 局部变量，类型在推断阶段由初始化表达式确定
+type local struct {
+	slot int
+	t    exprType
+}
+
+// phaseLocal 按块作用域解析 let 局部变量，把引用局部变量的节点绑定到对应槽位，
+// 返回槽位总数。局部变量不能与声明的黑板变量或外层可见的局部变量重名。
+func (n *Node) phaseLocal(m map[string]exprType) (int, error) {
+	s := &scope{m: m, vars: []map[string]*local{{}}}
+	for _, x := range n.Children {
+		if e := s.resolve(x); e != nil {
+			return 0, e
+		}
+	}
+	return s.n, nil
+}
+
+type scope struct {
+	m    map[string]exprType
+	vars []map[string]*local
+	n    int
+}
+
+func (s *scope) lookup(name string) *local {
+	for i := len(s.vars) - 1; i >= 0; i-- {
+		if l, ok := s.vars[i][name]; ok {
+			return l
+		}
+	}
+	return nil
+}
+
+func (s *scope) resolve(n *Node) (e error) {
+	switch n.Type {
+	case NodeVarDecl:
+		if len(s.vars) > 1 {
+			return n.errorf(fmtDeclInBlock, n.Token)
+		}
+		return nil
+	case NodeBlock:
+		s.vars = append(s.vars, map[string]*local{})
+		for _, x := range n.Children {
+			if e = s.resolve(x); e != nil {
+				return e
+			}
+		}
+		s.vars = s.vars[:len(s.vars)-1]
+		return nil
+	case NodeLet:
+		if e = s.resolve(n.Children[0]); e != nil {
+			return e
+		}
+		if _, ok := s.m[n.Token]; ok || s.lookup(n.Token) != nil {
+			return n.errorf(fmtLocalDefined, n.Token)
+		}
+		n.local = &local{slot: s.n}
+		s.n++
+		s.vars[len(s.vars)-1][n.Token] = n.local
+		return nil
+	case NodeAssign, NodeIdent, NodeTryIdent:
+		n.local = s.lookup(n.Token)
+	}
+	for _, x := range n.Children {
+		if e = s.resolve(x); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
 func (n *Node) varType(m map[string]exprType) error {
 	var (
 		idx int
@@ -28,10 +99,10 @@ func (n *Node) varType(m map[string]exprType) error {
 		e   error
 	)
 	if idx = strings.IndexByte(n.Token, ':'); idx == -1 {
-		return fmt.Errorf(fmtWrongVarType, n.Token)
+		return n.errorf(fmtWrongVarType, n.Token)
 	}
 	if et, e = _string2type(n.Token[:idx]); e != nil {
-		return fmt.Errorf(fmtWrongVarType, n.Token)
+		return n.errorf(fmtWrongVarType, n.Token)
 	}
 	vs := strings.SplitSeq(n.Token[idx+1:], ",")
 	for v := range vs {
@@ -43,7 +114,7 @@ func (n *Node) varType(m map[string]exprType) error {
 func (n *Node) phaseInfectDown(m map[string]exprType, down exprType) (e error) {
 	var ok bool
 	switch n.Type {
-	case NodeProgram:
+	case NodeProgram, NodeBlock:
 		for _, x := range n.Children {
 			if e = x.phaseInfectDown(m, 0); e != nil {
 				return e
@@ -52,27 +123,58 @@ func (n *Node) phaseInfectDown(m map[string]exprType, down exprType) (e error) {
 		return nil
 	case NodeVarDecl:
 		return
-	case NodeAssign:
+	case NodeAssign, NodeLet:
 		return n.Children[0].phaseInfectDown(m, n.Target)
+	case NodeIf:
+		e = n.Children[0].phaseInfectDown(m, exprBool)
+		for _, x := range n.Children[1:] {
+			e = errors.Join(e, x.phaseInfectDown(m, 0))
+		}
+		return e
+	case NodeBuiltin:
+		if randBuiltins[n.Token] {
+			return n.randInfectDown(m, down)
+		}
+		if tagBuiltins[n.Token] {
+			return n.tagInfect(down)
+		}
+		if vecBuiltins[n.Token] {
+			return n.vecInfectDown(m, down)
+		}
+		// 内置运算符的结果只能是数值
+		if n.Target, ok = _infect(n.Target, down); !ok || n.Target == exprBool {
+			return n.errorf(fmtWrongVarType, n.Token)
+		}
+		for _, x := range n.Children {
+			if e = x.phaseInfectDown(m, n.Target); e != nil {
+				return e
+			}
+		}
+		return nil
+	case NodeMember:
+		return n.vecInfectDown(m, down)
 	case NodeUnaryOp:
 		if n.Target, ok = _infect(n.Target, down); !ok {
-			return fmt.Errorf(fmtWrongVarType, n.Token)
+			return n.errorf(fmtWrongVarType, n.Token)
 		}
 		return n.Children[0].phaseInfectDown(m, n.Target)
 	case NodeBinOp:
 		switch n.Token {
 		case "^", "+", "-", "*", "/":
 			if n.Target, ok = _infect(n.Target, down); !ok {
-				return fmt.Errorf(fmtWrongVarType, n.Token)
+				return n.errorf(fmtWrongVarType, n.Token)
+			}
+			if _isVec(n.Target) {
+				return n.vecArithDown(m)
 			}
 			return errors.Join(n.Children[0].phaseInfectDown(m, n.Target), n.Children[1].phaseInfectDown(m, n.Target))
 		case "==", "!=", "<", "<=", ">", ">=":
 			if n.Target, ok = _infect(n.Target, down); !ok {
-				return fmt.Errorf(fmtWrongVarType, n.Token)
+				return n.errorf(fmtWrongVarType, n.Token)
 			}
 			l, r := n.Children[0].Target, n.Children[1].Target
 			if (l == exprBool && r == exprFloat) || (l == exprFloat && r == exprBool) {
-				return fmt.Errorf(fmtWrongVarType, n.Token)
+				return n.errorf(fmtWrongVarType, n.Token)
 			}
 			target := exprInt
 			if l == exprFloat || r == exprFloat {
@@ -81,6 +183,12 @@ func (n *Node) phaseInfectDown(m map[string]exprType, down exprType) (e error) {
 			if l == exprBool || r == exprBool {
 				target = exprBool
 			}
+			if l == exprString || r == exprString {
+				target = exprString
+			}
+			if _isVec(l) {
+				target = l
+			}
 			return errors.Join(n.Children[0].phaseInfectDown(m, target), n.Children[1].phaseInfectDown(m, target))
 		case "||", "&&":
 			return errors.Join(n.Children[0].phaseInfectDown(m, exprBool), n.Children[1].phaseInfectDown(m, exprBool))
@@ -89,19 +197,23 @@ func (n *Node) phaseInfectDown(m map[string]exprType, down exprType) (e error) {
 		}
 	case NodeTernary:
 		if n.Target, ok = _infect(n.Target, down); !ok {
-			return fmt.Errorf(fmtWrongVarType, n.Token)
+			return n.errorf(fmtWrongVarType, n.Token)
 		}
 		return errors.Join(n.Children[1].phaseInfectDown(m, n.Target), n.Children[2].phaseInfectDown(m, n.Target))
 	case NodeFunc:
-		for _, x := range n.Children {
-			if e = x.phaseInfectDown(m, 0); e != nil {
+		for i, x := range n.Children {
+			var arg exprType
+			if n.def != nil {
+				arg = n.def.args[i]
+			}
+			if e = x.phaseInfectDown(m, arg); e != nil {
 				return e
 			}
 		}
 		fallthrough
-	case NodeIdent, NodeTryIdent, NodeNumber, NodeBool:
+	case NodeIdent, NodeTryIdent, NodeNumber, NodeBool, NodeString:
 		if n.Target, ok = _infect(n.Target, down); !ok {
-			return fmt.Errorf(fmtWrongVarType, n.Token)
+			return n.errorf(fmtWrongVarType, n.Token)
 		}
 		return nil
 	default:
@@ -109,42 +221,108 @@ func (n *Node) phaseInfectDown(m map[string]exprType, down exprType) (e error) {
 	panic(fmt.Sprintf("unknown node type: %d", n.Type))
 }
 
-func (n *Node) phaseInfectUp(m map[string]exprType) (up exprType, e error) {
+func (n *Node) phaseInfectUp(m map[string]exprType, fs *Funcs) (up exprType, e error) {
 	switch n.Type {
 	case NodeProgram:
 		for _, x := range n.Children {
-			if _, e = x.phaseInfectUp(m); e != nil {
+			if _, e = x.phaseInfectUp(m, fs); e != nil {
 				return 0, e
 			}
 		}
 		return 0, nil
 	case NodeVarDecl:
 		return
+	case NodeBlock:
+		// 块的类型是最后一条语句的类型
+		for _, x := range n.Children {
+			if up, e = x.phaseInfectUp(m, fs); e != nil {
+				return 0, e
+			}
+		}
+		n.Target = up
+		return up, nil
+	case NodeIf:
+		ups := make([]exprType, len(n.Children))
+		for i, x := range n.Children {
+			if ups[i], e = x.phaseInfectUp(m, fs); e != nil {
+				return 0, e
+			}
+		}
+		if ups[0] != exprBool {
+			return 0, n.errorf(fmtWrongVarType, "if")
+		}
+		// 两个分支类型一致时 if 语句才有确定的类型，没有 else 时不成立的结果是该类型的零值
+		n.Target = exprUnknown
+		if len(ups) == 2 || ups[1] == ups[2] {
+			n.Target = ups[1]
+		}
+		return n.Target, nil
+	case NodeLet:
+		if up, e = n.Children[0].phaseInfectUp(m, fs); e != nil {
+			return 0, e
+		}
+		if up == exprUnknown {
+			return 0, n.errorf(fmtWrongVarType, n.Token)
+		}
+		n.local.t, n.Target = up, up
+		return up, nil
+	case NodeBuiltin:
+		if randBuiltins[n.Token] {
+			return n.randInfectUp(m, fs)
+		}
+		if tagBuiltins[n.Token] {
+			n.Target = exprBool
+			return n.Target, n.tagInfect(0)
+		}
+		if vecBuiltins[n.Token] {
+			return n.vecInfectUp(m, fs)
+		}
+		up = exprInt
+		for _, x := range n.Children {
+			t, e := x.phaseInfectUp(m, fs)
+			if e != nil {
+				return 0, e
+			}
+			if t != exprInt && t != exprFloat {
+				return 0, n.errorf(fmtWrongVarType, n.Token)
+			}
+			if t == exprFloat {
+				up = exprFloat
+			}
+		}
+		n.Target = up
+		return up, nil
 	case NodeAssign:
 		et, ok := m[n.Token]
+		if n.local != nil {
+			et, ok = n.local.t, true
+		}
+		if n.attr != nil {
+			et, ok = exprFloat, true
+		}
 		if !ok {
-			return 0, fmt.Errorf(fmtWrongVarType, n.Token)
+			return 0, n.errorf(fmtWrongVarType, n.Token)
 		}
-		_, e = n.Children[0].phaseInfectUp(m)
+		_, e = n.Children[0].phaseInfectUp(m, fs)
 		n.Target = et
 		return et, e
 	case NodeUnaryOp:
 		switch n.Token {
 		case "+", "-":
-			if up, e = n.Children[0].phaseInfectUp(m); e != nil {
+			if up, e = n.Children[0].phaseInfectUp(m, fs); e != nil {
 				return 0, e
 			}
-			if up == exprBool {
-				return 0, fmt.Errorf(fmtWrongVarType, n.Token)
+			if up == exprBool || up == exprString {
+				return 0, n.errorf(fmtWrongVarType, n.Token)
 			}
 			n.Target = up
 			return up, nil
 		case "!":
-			if up, e = n.Children[0].phaseInfectUp(m); e != nil {
+			if up, e = n.Children[0].phaseInfectUp(m, fs); e != nil {
 				return 0, e
 			}
-			if up == exprFloat {
-				return 0, fmt.Errorf(fmtWrongVarType, n.Token)
+			if up == exprFloat || up == exprString || _isVec(up) {
+				return 0, n.errorf(fmtWrongVarType, n.Token)
 			}
 			n.Target = exprBool
 			return exprBool, nil
@@ -152,13 +330,24 @@ func (n *Node) phaseInfectUp(m map[string]exprType) (up exprType, e error) {
 	case NodeBinOp:
 		switch n.Token {
 		case "^", "*", "/", "+", "-":
-			up0, e0 := n.Children[0].phaseInfectUp(m)
-			up1, e1 := n.Children[1].phaseInfectUp(m)
+			up0, e0 := n.Children[0].phaseInfectUp(m, fs)
+			up1, e1 := n.Children[1].phaseInfectUp(m, fs)
 			if e = errors.Join(e0, e1); e != nil {
 				return 0, e
 			}
+			if up0 == exprString || up1 == exprString {
+				// 字符串只支持 + 拼接，且两侧都必须是字符串
+				if n.Token != "+" || up0 != up1 {
+					return 0, n.errorf(fmtWrongVarType, n.Token)
+				}
+				n.Target = exprString
+				return exprString, nil
+			}
 			if up0 == exprBool || up1 == exprBool {
-				return 0, fmt.Errorf(fmtWrongVarType, n.Token)
+				return 0, n.errorf(fmtWrongVarType, n.Token)
+			}
+			if _isVec(up0) || _isVec(up1) {
+				return n.vecArithUp(up0, up1)
 			}
 			up = exprInt
 			if up0 == exprFloat || up1 == exprFloat {
@@ -167,65 +356,71 @@ func (n *Node) phaseInfectUp(m map[string]exprType) (up exprType, e error) {
 			n.Target = up
 			return up, nil
 		case "==", "!=":
-			l, e0 := n.Children[0].phaseInfectUp(m)
-			r, e1 := n.Children[1].phaseInfectUp(m)
+			l, e0 := n.Children[0].phaseInfectUp(m, fs)
+			r, e1 := n.Children[1].phaseInfectUp(m, fs)
 			if e = errors.Join(e0, e1); e != nil {
 				return 0, e
 			}
 			if (l == exprBool && r == exprFloat) || (l == exprFloat && r == exprBool) {
-				return 0, fmt.Errorf(fmtWrongVarType, n.Token)
+				return 0, n.errorf(fmtWrongVarType, n.Token)
+			}
+			if (l == exprString) != (r == exprString) {
+				return 0, n.errorf(fmtWrongVarType, n.Token)
+			}
+			if (_isVec(l) || _isVec(r)) && l != r {
+				return 0, n.errorf(fmtWrongVarType, n.Token)
 			}
 			n.Target = exprBool
 			return exprBool, nil
 		case "<", "<=", ">", ">=":
-			up0, e0 := n.Children[0].phaseInfectUp(m)
-			up1, e1 := n.Children[1].phaseInfectUp(m)
+			up0, e0 := n.Children[0].phaseInfectUp(m, fs)
+			up1, e1 := n.Children[1].phaseInfectUp(m, fs)
 			if e = errors.Join(e0, e1); e != nil {
 				return 0, e
 			}
-			if up0 == exprBool || up1 == exprBool {
-				return 0, fmt.Errorf(fmtWrongVarType, n.Token)
+			if !_isScalar(up0) || !_isScalar(up1) {
+				return 0, n.errorf(fmtWrongVarType, n.Token)
 			}
 			n.Target = exprBool
 			return exprBool, nil
 		case "||", "&&":
-			up0, e0 := n.Children[0].phaseInfectUp(m)
-			up1, e1 := n.Children[1].phaseInfectUp(m)
+			up0, e0 := n.Children[0].phaseInfectUp(m, fs)
+			up1, e1 := n.Children[1].phaseInfectUp(m, fs)
 			if e = errors.Join(e0, e1); e != nil {
 				return 0, e
 			}
-			if up0 == exprFloat || up1 == exprFloat {
-				return 0, fmt.Errorf(fmtWrongVarType, n.Token)
+			if up0 == exprFloat || up1 == exprFloat || up0 == exprString || up1 == exprString || _isVec(up0) || _isVec(up1) {
+				return 0, n.errorf(fmtWrongVarType, n.Token)
 			}
 			n.Target = exprBool
 			return exprBool, nil
 		case "%":
-			up0, e0 := n.Children[0].phaseInfectUp(m)
-			up1, e1 := n.Children[1].phaseInfectUp(m)
+			up0, e0 := n.Children[0].phaseInfectUp(m, fs)
+			up1, e1 := n.Children[1].phaseInfectUp(m, fs)
 			if e = errors.Join(e0, e1); e != nil {
 				return 0, e
 			}
 			if !(up0 == exprInt && up1 == exprInt) {
-				return 0, fmt.Errorf(fmtWrongVarType, n.Token)
+				return 0, n.errorf(fmtWrongVarType, n.Token)
 			}
 			n.Target = exprInt
 			return exprInt, nil
 		}
 	case NodeTernary:
-		up0, e0 := n.Children[0].phaseInfectUp(m)
-		up1, e1 := n.Children[1].phaseInfectUp(m)
-		up2, e2 := n.Children[2].phaseInfectUp(m)
+		up0, e0 := n.Children[0].phaseInfectUp(m, fs)
+		up1, e1 := n.Children[1].phaseInfectUp(m, fs)
+		up2, e2 := n.Children[2].phaseInfectUp(m, fs)
 		if e = errors.Join(e0, e1, e2); e != nil {
 			return 0, e
 		}
 		if up0 != exprBool {
-			return 0, fmt.Errorf(fmtWrongVarType, n.Token)
+			return 0, n.errorf(fmtWrongVarType, n.Token)
 		}
-		if up1 == exprInt {
+		if up1 == exprInt && up2 != exprString && !_isVec(up2) {
 			n.Target = up2
 			return up2, nil
 		}
-		if up2 == exprInt {
+		if up2 == exprInt && up1 != exprString && !_isVec(up1) {
 			n.Target = up1
 			return up1, nil
 		}
@@ -233,21 +428,34 @@ func (n *Node) phaseInfectUp(m map[string]exprType) (up exprType, e error) {
 			n.Target = up1
 			return up1, nil
 		}
-		return 0, fmt.Errorf(fmtWrongVarType, n.Token)
+		return 0, n.errorf(fmtWrongVarType, n.Token)
 	case NodeFunc:
+		if n.def = fs.lookup(n.Token); n.def != nil {
+			return n.infectCall(m, fs)
+		}
 		for _, x := range n.Children {
-			if _, e = x.phaseInfectUp(m); e != nil {
+			if _, e = x.phaseInfectUp(m, fs); e != nil {
 				return 0, e
 			}
 		}
 		fallthrough
 	case NodeIdent, NodeTryIdent:
+		if n.local != nil {
+			n.Target = n.local.t
+			return n.Target, nil
+		}
+		if n.attr != nil {
+			n.Target = exprFloat
+			return n.Target, nil
+		}
 		et, ok := m[n.Token]
 		if !ok {
-			return 0, fmt.Errorf(fmtVariableType, n.Token)
+			return 0, n.errorf(fmtVariableType, n.Token)
 		}
 		n.Target = et
 		return et, nil
+	case NodeMember:
+		return n.vecInfectUp(m, fs)
 	case NodeNumber:
 		n.Target = exprInt
 		if strings.Contains(n.Token, ".") {
@@ -257,22 +465,44 @@ func (n *Node) phaseInfectUp(m map[string]exprType) (up exprType, e error) {
 	case NodeBool:
 		n.Target = exprBool
 		return exprBool, nil
+	case NodeString:
+		n.Target = exprString
+		return exprString, nil
 	default:
 	}
 	panic(fmt.Sprintf("unknown node type: %d", n.Type))
 }
 
+// infectCall 按注册函数的签名检查参数个数与类型，返回值类型即签名声明的类型
+func (n *Node) infectCall(m map[string]exprType, fs *Funcs) (exprType, error) {
+	d := n.def
+	if len(n.Children) != len(d.args) {
+		return 0, n.errorf(fmtFuncArgCount, n.Token, len(d.args), len(n.Children))
+	}
+	for i, x := range n.Children {
+		up, e := x.phaseInfectUp(m, fs)
+		if e != nil {
+			return 0, e
+		}
+		if _, ok := _infect(up, d.args[i]); !ok {
+			return 0, n.errorf(fmtFuncArgType, n.Token, i)
+		}
+	}
+	n.Target = d.ret
+	return d.ret, nil
+}
+
 func _infect(now, down exprType) (exprType, bool) {
 	switch down {
 	case exprUnknown:
 		return now, true
 	case exprFloat:
-		if now == exprBool {
+		if now == exprBool || now == exprString || _isVec(now) {
 			return 0, false
 		}
 		return exprFloat, true
 	case exprBool:
-		if now == exprFloat {
+		if now == exprFloat || now == exprString || _isVec(now) {
 			return 0, false
 		}
 		return exprBool, true
@@ -281,6 +511,11 @@ func _infect(now, down exprType) (exprType, bool) {
 			return 0, false
 		}
 		return exprInt, true
+	case exprString, exprVec2, exprVec3:
+		if now != down {
+			return 0, false
+		}
+		return down, true
 	}
 	panic("unreachable")
 }
@@ -0,0 +1,161 @@
+package cc
+
+import (
+	"errors"
+	"math"
+	"reflect"
+
+	"github.com/legamerdc/game/lib"
+)
+
+var fmtNoRand = "%s needs a random source: context does not implement RandCtx"
+
+type (
+	// Rand 是内置随机函数 rand/randint/chance 使用的随机源，*math/rand/v2.Rand 满足该接口。
+	// 随机源由求值上下文显式提供而不是使用全局随机数，这样同一个种子下的求值结果可以重放。
+	// *math/rand/v2.Rand 不是并发安全的，并发求值时每个上下文应当持有自己的随机源。
+	Rand interface {
+		Float64() float64
+		Int64N(n int64) int64
+	}
+
+	// RandCtx 是提供随机源的求值上下文。只有 B 实现了 RandCtx 时，程序才能调用随机函数，
+	// 否则编译报错。
+	RandCtx interface {
+		Rand() Rand
+	}
+)
+
+var randCtxType = reflect.TypeFor[RandCtx]()
+
+// randBuiltins 是依赖随机源的内置运算符
+var randBuiltins = map[string]bool{"rand": true, "randint": true, "chance": true}
+
+// ctxOptions 在 newOptions 的基础上记录求值上下文 B 提供的能力
+func ctxOptions[B any](opts []Option) *options {
+	o := newOptions(opts)
+	o.rand = reflect.TypeFor[B]().Implements(randCtxType)
+	o.attr = reflect.TypeFor[B]().Implements(attrCtxType)
+	o.tag = reflect.TypeFor[B]().Implements(tagCtxType)
+	return o
+}
+
+// checkRand 在上下文没有随机源时拒绝随机函数调用
+func (n *Node) checkRand(o *options) error {
+	if o.rand {
+		return nil
+	}
+	if n.Type == NodeBuiltin && randBuiltins[n.Token] {
+		return n.errorf(fmtNoRand, n.Token)
+	}
+	for _, x := range n.Children {
+		if e := x.checkRand(o); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// randInfectUp 推断随机函数的类型：rand() 是 float，randint 的两个参数必须是 int，
+// chance 的概率可以是 int 或 float，结果是 bool
+func (n *Node) randInfectUp(m map[string]exprType, fs *Funcs) (exprType, error) {
+	up := map[string]exprType{"rand": exprFloat, "randint": exprInt, "chance": exprBool}[n.Token]
+	for _, x := range n.Children {
+		t, e := x.phaseInfectUp(m, fs)
+		if e != nil {
+			return 0, e
+		}
+		if t != exprInt && (n.Token == "randint" || t != exprFloat) {
+			return 0, n.errorf(fmtWrongVarType, n.Token)
+		}
+	}
+	n.Target = up
+	return up, nil
+}
+
+// randInfectDown 中 randint 的结果可以提升为 float，参数始终按 int 求值；chance 的概率按 float 求值
+func (n *Node) randInfectDown(m map[string]exprType, down exprType) (e error) {
+	var ok bool
+	if n.Target, ok = _infect(n.Target, down); !ok || (n.Token == "randint" && n.Target == exprBool) {
+		return n.errorf(fmtWrongVarType, n.Token)
+	}
+	arg := exprInt
+	if n.Token == "chance" {
+		arg = exprFloat
+	}
+	for _, x := range n.Children {
+		if e = x.phaseInfectDown(m, arg); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func _rand[B any](kv B) Rand {
+	return any(kv).(RandCtx).Rand()
+}
+
+// _randint 返回 [lo, hi] 上均匀分布的整数，hi < lo 时返回 lo
+func _randint(r Rand, lo, hi int64) int64 {
+	if hi <= lo {
+		return lo
+	}
+	// 区间宽度按 uint64 计算，为 0 时是整个 int64 范围。超过 MaxInt64 时 Int64N 放不下，
+	// 拼出 64 位后拒绝采样
+	w := uint64(hi) - uint64(lo) + 1
+	if w != 0 && w <= math.MaxInt64 {
+		return lo + r.Int64N(int64(w))
+	}
+	for {
+		u := uint64(r.Int64N(1<<32))<<32 | uint64(r.Int64N(1<<32))
+		if w == 0 || u < w {
+			return int64(uint64(lo) + u)
+		}
+	}
+}
+
+// _randField 按结果类型装箱 randint 的结果
+func _randField(x int64, t exprType) lib.Field {
+	switch t {
+	case exprFloat:
+		return lib.Float64(float64(x))
+	case exprFixed:
+		return lib.Fixed(lib.Q32FromInt(x))
+	}
+	return lib.Int64(x)
+}
+
+func compileRand[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (func(frame[B]) (lib.Field, error), error) {
+	fs, e := _compileNodes[K, B](n.Children, m, k)
+	if e != nil {
+		return nil, e
+	}
+	switch n.Token {
+	case "rand":
+		return _fixedLoad(n, func(b frame[B]) (lib.Field, error) {
+			return lib.Float64(_rand(b.kv).Float64()), nil
+		}), nil
+	case "randint":
+		f0, f1, t := fs[0], fs[1], n.Target
+		return func(b frame[B]) (v lib.Field, e error) {
+			v0, e0 := f0(b)
+			v1, e1 := f1(b)
+			if e = errors.Join(e0, e1); e != nil {
+				return
+			}
+			lo, _ := v0.Int64()
+			hi, _ := v1.Int64()
+			return _randField(_randint(_rand(b.kv), lo, hi), t), nil
+		}, nil
+	case "chance":
+		f0 := fs[0]
+		return func(b frame[B]) (v lib.Field, e error) {
+			if v, e = f0(b); e != nil {
+				return
+			}
+			p, _ := v.Float64()
+			return lib.Bool(_rand(b.kv).Float64() < p), nil
+		}, nil
+	}
+	panic("unreachable")
+}
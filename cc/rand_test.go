@@ -0,0 +1,158 @@
+package cc
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/legamerdc/game/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type randKv struct {
+	*MockKv
+	r *rand.Rand
+}
+
+func (kv *randKv) Rand() Rand {
+	return kv.r
+}
+
+func newRandKv(seed uint64) *randKv {
+	return &randKv{MockKv: NewMockKv(), r: rand.New(rand.NewPCG(seed, 1))}
+}
+
+func evalRand(t *testing.T, code string, seed uint64, n int, opts ...Option) []lib.Field {
+	f, err := Compile[string, *randKv](code, s2s, opts...)
+	require.Nil(t, err)
+	kv := newRandKv(seed)
+	kv.SetInt64("lo", 1)
+	kv.SetInt64("hi", 6)
+	kv.SetFloat64("p", 0.3)
+	vs := make([]lib.Field, n)
+	for i := range vs {
+		vs[i], err = f(kv)
+		require.Nil(t, err)
+	}
+	return vs
+}
+
+func TestRand(t *testing.T) {
+	t.Run("上下文没有随机源时编译报错", func(t *testing.T) {
+		for _, code := range []string{"rand()", "randint(1, 6)", "float p; chance(p)", "int x; x > 0 && chance(0.5)"} {
+			_, err := Compile[string, *MockKv](code, s2s)
+			assert.NotNil(t, err, code)
+			_, err = CompileBool[string, *MockKv](code, s2s)
+			assert.NotNil(t, err, code)
+			_, err = Analyze(code)
+			assert.Nil(t, err, code)
+		}
+	})
+
+	t.Run("类型检查", func(t *testing.T) {
+		for _, code := range []string{
+			"randint(1.5, 6)",
+			"float x; randint(x, 6)",
+			"chance(true)",
+			"int x; x = rand()",
+			"bool b; b = randint(1, 2)",
+			"rand(1)",
+			"int rand(int); 1",
+		} {
+			_, err := Compile[string, *randKv](code, s2s)
+			assert.NotNil(t, err, code)
+		}
+		info, err := Analyze("float x; x = randint(1, 6) * 1.5; chance(0.5)")
+		assert.Nil(t, err)
+		assert.Equal(t, TypeFloat, info.Writes["x"])
+	})
+
+	t.Run("相同种子结果可重放", func(t *testing.T) {
+		code := "int lo, hi; float p; let x = randint(lo, hi); if (chance(p)) { x + rand() } else { x - rand() }"
+		v0 := evalRand(t, code, 7, 200)
+		assert.Equal(t, v0, evalRand(t, code, 7, 200))
+		assert.NotEqual(t, v0, evalRand(t, code, 8, 200))
+		assert.Equal(t, v0, evalRand(t, code, 7, 200, WithBackend(BackendVM)))
+	})
+
+	t.Run("取值范围", func(t *testing.T) {
+		seen := map[int64]bool{}
+		for _, v := range evalRand(t, "int lo, hi; randint(lo, hi)", 1, 500) {
+			x, ok := v.Int64()
+			require.True(t, ok)
+			assert.True(t, x >= 1 && x <= 6, x)
+			seen[x] = true
+		}
+		assert.Len(t, seen, 6)
+
+		for _, v := range evalRand(t, "randint(3, 3) + randint(5, 2) * 10", 1, 10) {
+			x, _ := v.Int64()
+			assert.Equal(t, int64(53), x)
+		}
+
+		hit := 0
+		for _, v := range evalRand(t, "float p; chance(p)", 1, 1000) {
+			if b, _ := v.Bool(); b {
+				hit++
+			}
+		}
+		assert.InDelta(t, 300, hit, 60)
+
+		for _, v := range evalRand(t, "chance(0) || !chance(1)", 1, 100) {
+			b, _ := v.Bool()
+			assert.False(t, b)
+		}
+	})
+
+	t.Run("区间宽度超过int64", func(t *testing.T) {
+		f, err := Compile[string, *randKv]("int lo, hi; randint(lo, hi)", s2s)
+		require.Nil(t, err)
+		kv := newRandKv(1)
+		for _, c := range [][2]int64{{math.MinInt64, math.MaxInt64}, {math.MinInt64, 0}, {-1, math.MaxInt64}} {
+			kv.SetInt64("lo", c[0])
+			kv.SetInt64("hi", c[1])
+			neg := 0
+			for range 200 {
+				v, err := f(kv)
+				require.Nil(t, err)
+				x, _ := v.Int64()
+				assert.True(t, x >= c[0] && x <= c[1], x)
+				if x < 0 {
+					neg++
+				}
+			}
+			if c[0] == math.MinInt64 && c[1] == math.MaxInt64 {
+				assert.InDelta(t, 100, neg, 40)
+			}
+		}
+	})
+
+	t.Run("randint提升为float", func(t *testing.T) {
+		for _, opt := range []Option{WithBackend(BackendClosure), WithBackend(BackendVM)} {
+			for _, v := range evalRand(t, "randint(1, 6) / 2.0", 3, 50, opt) {
+				x, ok := v.Float64()
+				require.True(t, ok)
+				assert.True(t, x >= 0.5 && x <= 3, x)
+			}
+		}
+	})
+
+	t.Run("类型化入口", func(t *testing.T) {
+		code := "float p; chance(p) && randint(1, 100) > 50"
+		fb, err := CompileBool[string, *randKv](code, s2s)
+		require.Nil(t, err)
+		f, err := Compile[string, *randKv](code, s2s)
+		require.Nil(t, err)
+		kv0, kv1 := newRandKv(5), newRandKv(5)
+		kv0.SetFloat64("p", 0.6)
+		kv1.SetFloat64("p", 0.6)
+		for i := 0; i < 100; i++ {
+			v0, _ := f(kv0)
+			v1, err := fb(kv1)
+			assert.Nil(t, err)
+			b, _ := v0.Bool()
+			assert.Equal(t, b, v1)
+		}
+	})
+}
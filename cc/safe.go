@@ -0,0 +1,222 @@
+package cc
+
+import (
+	"errors"
+	"math"
+
+	"github.com/legamerdc/game/lib"
+)
+
+var (
+	fmtDivZero  = "division by zero in %s"
+	fmtOverflow = "integer overflow in %s"
+	fmtExpLimit = "exponent %v exceeds the limit %d"
+	fmtPanic    = "panic in %s: %v"
+)
+
+// MaxExponent 是安全模式下 ^ 的指数绝对值上限
+const MaxExponent = 1024
+
+// WithSafe 开启安全求值，用于执行策划配置的表达式：一行错误的配置只让这次求值返回错误，
+// 不会让服务器崩溃。安全模式下
+//
+//   - int 的 / 与 % 除以零返回错误（% 只用于 int）
+//   - float 与定点数的 / 除以零返回错误，而不是得到 ±Inf、NaN 或饱和值
+//   - int 的 + - * / ^、取反与 abs 溢出时返回错误
+//   - ^ 的指数绝对值超过 MaxExponent 时返回错误
+//   - 注册函数、Ctx.Exec、随机源与标签容器中的 panic 被恢复为错误
+//
+// 这些错误都是指向出错片段的 *Error。安全模式总是使用闭包后端。
+func WithSafe() Option {
+	return func(o *options) {
+		o.safe = true
+	}
+}
+
+// phaseSafe 标记需要在求值时做检查的节点
+func (n *Node) phaseSafe() {
+	switch n.Type {
+	case NodeBinOp, NodeUnaryOp, NodeBuiltin, NodeFunc:
+		n.safe = true
+	}
+	for _, x := range n.Children {
+		x.phaseSafe()
+	}
+}
+
+// safeInt 返回带检查的 int 二元运算，不需要检查的运算返回 nil
+func safeInt(n *Node) func(a, b int64) (lib.Field, error) {
+	switch n.Token {
+	case "+":
+		return func(a, b int64) (lib.Field, error) {
+			c := a + b
+			if (c < a) != (b < 0) {
+				return lib.Field{}, n.errorf(fmtOverflow, n.Token)
+			}
+			return lib.Int64(c), nil
+		}
+	case "-":
+		return func(a, b int64) (lib.Field, error) {
+			c := a - b
+			if (c < a) != (b > 0) {
+				return lib.Field{}, n.errorf(fmtOverflow, n.Token)
+			}
+			return lib.Int64(c), nil
+		}
+	case "*":
+		return func(a, b int64) (lib.Field, error) {
+			c, ok := _imul(a, b)
+			if !ok {
+				return lib.Field{}, n.errorf(fmtOverflow, n.Token)
+			}
+			return lib.Int64(c), nil
+		}
+	case "/", "%":
+		div := n.Token == "/"
+		return func(a, b int64) (lib.Field, error) {
+			if b == 0 {
+				return lib.Field{}, n.errorf(fmtDivZero, n.Token)
+			}
+			if !div {
+				return lib.Int64(a % b), nil
+			}
+			if a == math.MinInt64 && b == -1 {
+				return lib.Field{}, n.errorf(fmtOverflow, n.Token)
+			}
+			return lib.Int64(a / b), nil
+		}
+	case "^":
+		return func(a, b int64) (lib.Field, error) {
+			if b > MaxExponent || b < -MaxExponent {
+				return lib.Field{}, n.errorf(fmtExpLimit, b, MaxExponent)
+			}
+			c, ok := _ipowerSafe(a, b)
+			if !ok {
+				return lib.Field{}, n.errorf(fmtOverflow, n.Token)
+			}
+			return lib.Int64(c), nil
+		}
+	}
+	return nil
+}
+
+// safeFloat 给 float 的 / 与 ^ 加上检查，op 是不带检查的运算
+func safeFloat(n *Node, op func(a, b float64) lib.Field) func(a, b float64) (lib.Field, error) {
+	switch n.Token {
+	case "/":
+		return func(a, b float64) (lib.Field, error) {
+			if b == 0 {
+				return lib.Field{}, n.errorf(fmtDivZero, n.Token)
+			}
+			return op(a, b), nil
+		}
+	case "^":
+		return func(a, b float64) (lib.Field, error) {
+			if math.Abs(b) > MaxExponent || math.IsNaN(b) {
+				return lib.Field{}, n.errorf(fmtExpLimit, b, MaxExponent)
+			}
+			return op(a, b), nil
+		}
+	}
+	return nil
+}
+
+// safeFixed 给定点数的 / 与 ^ 加上检查，op 是不带检查的运算
+func safeFixed(n *Node, op func(a, b lib.Q32) lib.Field) func(a, b lib.Q32) (lib.Field, error) {
+	switch n.Token {
+	case "/":
+		return func(a, b lib.Q32) (lib.Field, error) {
+			if b == 0 {
+				return lib.Field{}, n.errorf(fmtDivZero, n.Token)
+			}
+			return op(a, b), nil
+		}
+	case "^":
+		return func(a, b lib.Q32) (lib.Field, error) {
+			if b.Abs() > lib.Q32FromInt(MaxExponent) {
+				return lib.Field{}, n.errorf(fmtExpLimit, b, MaxExponent)
+			}
+			return op(a, b), nil
+		}
+	}
+	return nil
+}
+
+func _safeBinary[B, T any](f0, f1 func(frame[B]) (lib.Field, error), get func(lib.Field) (T, bool), op func(a, b T) (lib.Field, error)) func(frame[B]) (lib.Field, error) {
+	return func(b frame[B]) (v lib.Field, e error) {
+		v0, e0 := f0(b)
+		v1, e1 := f1(b)
+		if e = errors.Join(e0, e1); e != nil {
+			return
+		}
+		vv0, _ := get(v0)
+		vv1, _ := get(v1)
+		return op(vv0, vv1)
+	}
+}
+
+// safeNeg 检查 int 取反与 abs 的溢出，-MinInt64 无法表示
+func safeNeg[B any](n *Node, f func(frame[B]) (lib.Field, error), abs bool) func(frame[B]) (lib.Field, error) {
+	return func(b frame[B]) (v lib.Field, e error) {
+		if v, e = f(b); e != nil {
+			return
+		}
+		vv, _ := v.Int64()
+		if vv == math.MinInt64 {
+			return v, n.errorf(fmtOverflow, n.Token)
+		}
+		if abs {
+			return lib.Int64(_iabs(vv)), nil
+		}
+		return lib.Int64(-vv), nil
+	}
+}
+
+// safeCall 在安全模式下把函数调用、随机函数与标签查询中的 panic 恢复为指向调用处的错误，
+// 否则原样返回 f
+func safeCall[B any](n *Node, f func(frame[B]) (lib.Field, error)) func(frame[B]) (lib.Field, error) {
+	if !n.safe {
+		return f
+	}
+	return func(b frame[B]) (v lib.Field, e error) {
+		defer func() {
+			if r := recover(); r != nil {
+				v, e = lib.Field{}, n.errorf(fmtPanic, n.Token, r)
+			}
+		}()
+		return f(b)
+	}
+}
+
+// _imul 返回 a*b 以及结果是否没有溢出
+func _imul(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	c := a * b
+	if c/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return c, false
+	}
+	return c, true
+}
+
+// _ipowerSafe 与 _ipower 相同，但在溢出时返回 false
+func _ipowerSafe(a, b int64) (int64, bool) {
+	var (
+		c  int64 = 1
+		ok bool
+	)
+	for b > 0 {
+		if b&1 != 0 {
+			if c, ok = _imul(c, a); !ok {
+				return c, false
+			}
+		}
+		if b >>= 1; b > 0 {
+			if a, ok = _imul(a, a); !ok {
+				return a, false
+			}
+		}
+	}
+	return c, true
+}
@@ -0,0 +1,188 @@
+package cc
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/legamerdc/game/attr"
+	"github.com/legamerdc/game/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// crashKv 的 Exec 对 crash 直接 panic，模拟有缺陷的黑板函数
+type crashKv struct {
+	*MockKv
+}
+
+func (c crashKv) Exec(key string, vs ...lib.Field) (lib.Field, bool) {
+	if key == "crash" {
+		var m map[string]int
+		m["x"] = 1
+	}
+	return c.MockKv.Exec(key, vs...)
+}
+
+// brokenRandKv 的随机源总是 panic
+type brokenRandKv struct {
+	*MockKv
+}
+
+type brokenRand struct{}
+
+func (brokenRand) Float64() float64   { panic("broken rand") }
+func (brokenRand) Int64N(int64) int64 { panic("broken rand") }
+
+func (brokenRandKv) Rand() Rand {
+	return brokenRand{}
+}
+
+func safeMockKv() *MockKv {
+	kv := NewMockKv()
+	kv.SetInt64("zero", 0)
+	kv.SetInt64("big", math.MaxInt64)
+	kv.SetInt64("small", math.MinInt64)
+	kv.SetFloat64("fz", 0)
+	return kv
+}
+
+func TestSafe(t *testing.T) {
+	t.Run("运行时错误", func(t *testing.T) {
+		cases := []struct {
+			code, msg, span string
+		}{
+			{"int zero; 10 / zero", "division by zero in /", "10 / zero"},
+			{"int zero; 1 + 10 % zero", "division by zero in %", "10 % zero"},
+			{"float fz; 1.5 / fz", "division by zero in /", "1.5 / fz"},
+			{"int big; big + 1", "integer overflow in +", "big + 1"},
+			{"int small; small - 1", "integer overflow in -", "small - 1"},
+			{"int big; big * 2", "integer overflow in *", "big * 2"},
+			{"int small; small / -1", "integer overflow in /", "small / -1"},
+			{"int small; -small", "integer overflow in -", "-small"},
+			{"int small; abs(small)", "integer overflow in abs", "abs(small)"},
+			{"3 ^ 40", "integer overflow in ^", "3 ^ 40"},
+			{"1 ^ 5000", "exponent 5000 exceeds the limit 1024", "1 ^ 5000"},
+			{"2.0 ^ 1000000000.0", "exponent 1e+09 exceeds the limit 1024", "2.0 ^ 1000000000.0"},
+		}
+		for _, c := range cases {
+			f, err := Compile[string, *MockKv](c.code, s2s, WithSafe())
+			require.Nil(t, err, c.code)
+			_, err = f(safeMockKv())
+			require.NotNil(t, err, c.code)
+			assert.ErrorContains(t, err, c.msg, c.code)
+			var ce *Error
+			require.True(t, errors.As(err, &ce), c.code)
+			assert.Equal(t, c.span, c.code[ce.Pos:ce.End], c.code)
+		}
+	})
+
+	t.Run("缺失的变量、函数与属性", func(t *testing.T) {
+		names := map[string]attr.Key{"Mana": attr.MakeKey(99, 0)}
+		cases := []struct {
+			code, msg, span string
+		}{
+			{"int zero; float x; zero + x!", "key not set: x", "x!"},
+			{"int zero, nope; zero + nope(zero)", "ill func: nope", "nope(zero)"},
+			{"Health + Mana!", "attribute not set: Mana", "Mana!"},
+			{"Mana = Health; Health", "attribute not set: Mana", "Mana = Health"},
+		}
+		opts := [][]Option{{WithSafe()}, {WithBackend(BackendVM)}, nil}
+		for _, c := range cases {
+			for _, opt := range opts {
+				opt = append(opt, WithAttrs(testAttrNames, names))
+				f, err := Compile[string, *attrKv](c.code, s2s, opt...)
+				require.Nil(t, err, c.code)
+				_, err = f(newAttrKv())
+				assert.ErrorContains(t, err, c.msg, c.code)
+				var ce *Error
+				require.True(t, errors.As(err, &ce), c.code)
+				assert.Equal(t, c.span, c.code[ce.Pos:ce.End], c.code)
+
+				g, err := CompileFloat[string, *attrKv](c.code, s2s, opt...)
+				require.Nil(t, err, c.code)
+				_, err = g(newAttrKv())
+				require.True(t, errors.As(err, &ce), c.code)
+				assert.Equal(t, c.span, c.code[ce.Pos:ce.End], c.code)
+			}
+		}
+	})
+
+	t.Run("正常求值不变", func(t *testing.T) {
+		cases := map[string]lib.Field{
+			"int big; big - 1 + 1":                lib.Int64(math.MaxInt64),
+			"int small; small + 1":                lib.Int64(math.MinInt64 + 1),
+			"int small; small % -1":               lib.Int64(0),
+			"-3 * 3 ^ 38":                         lib.Int64(-4052555153018976267),
+			"(-2) ^ 63":                           lib.Int64(math.MinInt64),
+			"int zero; zero ^ 1024":               lib.Int64(0),
+			"7 / 2 + 7 % 2":                       lib.Int64(4),
+			"2.0 ^ -1024 > 0":                     lib.Bool(true),
+			"int zero; zero != 0 ? 1 / zero : -1": lib.Int64(-1),
+		}
+		for code, want := range cases {
+			f, err := Compile[string, *MockKv](code, s2s, WithSafe())
+			require.Nil(t, err, code)
+			v, err := f(safeMockKv())
+			require.Nil(t, err, code)
+			assert.Equal(t, want, v, code)
+		}
+	})
+
+	t.Run("定点模式", func(t *testing.T) {
+		f, err := Compile[string, *MockKv]("float fz; 1 / fz", s2s, WithSafe(), WithFixed())
+		require.Nil(t, err)
+		_, err = f(safeMockKv())
+		assert.ErrorContains(t, err, "division by zero in /")
+
+		f, err = Compile[string, *MockKv]("float x; 1.5 ^ 2000", s2s, WithSafe(), WithFixed())
+		require.Nil(t, err)
+		_, err = f(safeMockKv())
+		assert.ErrorContains(t, err, "exceeds the limit 1024")
+	})
+
+	t.Run("恢复函数中的panic", func(t *testing.T) {
+		fs := DefaultFuncs().MustRegister("boom(int) int", func(x int64) int64 {
+			return 10 / x
+		})
+		f, err := Compile[string, *MockKv]("int zero; 1 + boom(zero)", s2s, WithSafe(), WithFuncs(fs))
+		require.Nil(t, err)
+		_, err = f(safeMockKv())
+		assert.ErrorContains(t, err, "panic in boom: runtime error: integer divide by zero")
+		var ce *Error
+		require.True(t, errors.As(err, &ce))
+		assert.Equal(t, "boom(zero)", "int zero; 1 + boom(zero)"[ce.Pos:ce.End])
+
+		g, err := Compile[string, crashKv]("int crash, f0; crash() + f0()", s2s, WithSafe())
+		require.Nil(t, err)
+		_, err = g(crashKv{safeMockKv()})
+		assert.ErrorContains(t, err, "panic in crash: assignment to entry in nil map")
+
+		// 随机源中的 panic 同样被恢复
+		for _, code := range []string{"randint(1, 6)", "1 + rand()", "chance(0.5)"} {
+			r, err := Compile[string, brokenRandKv](code, s2s, WithSafe())
+			require.Nil(t, err)
+			_, err = r(brokenRandKv{safeMockKv()})
+			assert.ErrorContains(t, err, "broken rand", code)
+		}
+
+		// 没有 panic 时结果与普通模式相同
+		g, err = Compile[string, crashKv]("int f0, f1; f1(3) + f0()", s2s, WithSafe())
+		require.Nil(t, err)
+		v, err := g(crashKv{safeMockKv()})
+		require.Nil(t, err)
+		assert.Equal(t, lib.Int64(17), v)
+	})
+
+	t.Run("类型化入口", func(t *testing.T) {
+		f, err := CompileFloat[string, *MockKv]("int zero; 1 + 10 / zero", s2s, WithSafe(), WithBackend(BackendVM))
+		require.Nil(t, err)
+		_, err = f(safeMockKv())
+		assert.ErrorContains(t, err, "division by zero in /")
+
+		g, err := CompileBool[string, *MockKv]("int big; big * big > 0", s2s, WithSafe())
+		require.Nil(t, err)
+		_, err = g(safeMockKv())
+		assert.ErrorContains(t, err, "integer overflow in *")
+	})
+}
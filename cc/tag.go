@@ -0,0 +1,97 @@
+package cc
+
+import (
+	"reflect"
+
+	"github.com/legamerdc/game/lib"
+	"github.com/legamerdc/game/tag"
+)
+
+var (
+	fmtNoTagDB  = "%s needs a tag.DB: compile with WithTags"
+	fmtNoTags   = "%s needs tags: context does not implement TagCtx"
+	fmtTagUnset = "unknown tag: %q"
+)
+
+type (
+	// TagCtx 是提供标签集合的求值上下文。只有 B 实现了 TagCtx 时，程序才能调用 has_tag，
+	// 否则编译报错。
+	TagCtx interface {
+		Tags() *tag.Tag
+	}
+
+	// tagRef 是 has_tag 的参数在编译期解析出的标签
+	tagRef struct {
+		key   tag.Key
+		exact bool
+	}
+)
+
+var tagCtxType = reflect.TypeFor[TagCtx]()
+
+// tagBuiltins 是查询标签的内置运算符
+var tagBuiltins = map[string]bool{"has_tag": true, "has_tag_exact": true}
+
+// WithTags 指定 has_tag/has_tag_exact 使用的标签字典。标签字符串在编译期解析为 tag.Key，
+// 字典中不存在的标签是编译错误，求值时直接调用 tag.Tag.HasTag/HasTagExact。
+func WithTags(db *tag.DB) Option {
+	return func(o *options) {
+		o.tags = db
+	}
+}
+
+// phaseTag 把 has_tag 的字符串参数解析为标签
+func (n *Node) phaseTag(o *options) error {
+	if n.Type == NodeBuiltin && tagBuiltins[n.Token] {
+		if o.tags == nil {
+			return n.errorf(fmtNoTagDB, n.Token)
+		}
+		if !o.tag {
+			return n.errorf(fmtNoTags, n.Token)
+		}
+		key, ok := o.tags.Lookup(n.Children[0].Token)
+		if !ok {
+			return n.Children[0].errorf(fmtTagUnset, n.Children[0].Token)
+		}
+		n.tag = &tagRef{key: key, exact: n.Token == "has_tag_exact"}
+		return nil
+	}
+	for _, x := range n.Children {
+		if e := x.phaseTag(o); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// tagInfect 推断 has_tag 的类型，参数只能是字符串字面量，结果是 bool
+func (n *Node) tagInfect(down exprType) error {
+	var ok bool
+	n.Children[0].Target = exprString
+	if n.Target, ok = _infect(exprBool, down); !ok {
+		return n.errorf(fmtWrongVarType, n.Token)
+	}
+	return nil
+}
+
+// _hasTag 返回标签查询，上下文的标签集合为 nil 时视为没有任何标签
+func _hasTag[B any](n *Node) func(B) bool {
+	key := n.tag.key
+	if n.tag.exact {
+		return func(kv B) bool {
+			t := any(kv).(TagCtx).Tags()
+			return t != nil && t.HasTagExact(key)
+		}
+	}
+	return func(kv B) bool {
+		t := any(kv).(TagCtx).Tags()
+		return t != nil && t.HasTag(key)
+	}
+}
+
+func compileTag[B any](n *Node) func(frame[B]) (lib.Field, error) {
+	has := _hasTag[B](n)
+	return func(b frame[B]) (lib.Field, error) {
+		return lib.Bool(has(b.kv)), nil
+	}
+}
@@ -0,0 +1,120 @@
+package cc
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/legamerdc/game/tag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tagKv struct {
+	*MockKv
+	t *tag.Tag
+}
+
+func (kv *tagKv) Tags() *tag.Tag {
+	return kv.t
+}
+
+func newTagDB(t testing.TB) *tag.DB {
+	db, err := tag.Build(slices.Values([]string{"state.stunned", "state.silenced", "buff.haste"}))
+	require.Nil(t, err)
+	return db
+}
+
+func TestTags(t *testing.T) {
+	db := newTagDB(t)
+	stunned, _ := db.Lookup("state.stunned")
+	haste, _ := db.Lookup("buff.haste")
+
+	newKv := func() *tagKv {
+		kv := &tagKv{MockKv: NewMockKv(), t: &tag.Tag{}}
+		kv.t.AddTag(db, stunned)
+		kv.SetInt64("hp", 20)
+		return kv
+	}
+
+	t.Run("求值", func(t *testing.T) {
+		cases := []struct {
+			code string
+			want bool
+		}{
+			{"int hp; hp < 30 && !has_tag('state.stunned')", false},
+			{"int hp; hp < 30 && has_tag('state.stunned')", true},
+			{"has_tag('state')", true},
+			{"has_tag_exact('state')", false},
+			{"has_tag_exact('State.Stunned')", true},
+			{`has_tag("buff") || has_tag_exact("buff.haste")`, false},
+			{"let s = has_tag('state'); if (s) { !has_tag('state.silenced') } else { false }", true},
+		}
+		for _, c := range cases {
+			for _, backend := range []Option{WithBackend(BackendClosure), WithBackend(BackendVM)} {
+				f, err := Compile[string, *tagKv](c.code, s2s, WithTags(db), backend)
+				require.Nil(t, err, c.code)
+				v, err := f(newKv())
+				assert.Nil(t, err)
+				b, _ := v.Bool()
+				assert.Equal(t, c.want, b, c.code)
+			}
+			fb, err := CompileBool[string, *tagKv](c.code, s2s, WithTags(db))
+			require.Nil(t, err, c.code)
+			b, err := fb(newKv())
+			assert.Nil(t, err)
+			assert.Equal(t, c.want, b, c.code)
+		}
+	})
+
+	t.Run("标签变化", func(t *testing.T) {
+		f, err := CompileBool[string, *tagKv]("has_tag('buff')", s2s, WithTags(db))
+		require.Nil(t, err)
+		kv := newKv()
+		b, _ := f(kv)
+		assert.False(t, b)
+		kv.t.AddTag(db, haste)
+		b, _ = f(kv)
+		assert.True(t, b)
+		kv.t = nil
+		b, _ = f(kv)
+		assert.False(t, b)
+	})
+
+	t.Run("编译错误", func(t *testing.T) {
+		for _, code := range []string{
+			"has_tag('state.rooted')",
+			"string s; has_tag(s)",
+			"has_tag('a', 'b')",
+			"int x; x = has_tag('state')",
+			"has_tag('state') + 1",
+		} {
+			_, err := Compile[string, *tagKv](code, s2s, WithTags(db))
+			assert.NotNil(t, err, code)
+		}
+		// 没有标签字典
+		_, err := Compile[string, *tagKv]("has_tag('state')", s2s)
+		assert.NotNil(t, err)
+		// 上下文没有标签集合
+		_, err = Compile[string, *MockKv]("has_tag('state')", s2s, WithTags(db))
+		assert.NotNil(t, err)
+		// 不能注册同名函数
+		err = NewFuncs().Register("has_tag(float) bool", func(float64) bool { return false })
+		assert.NotNil(t, err)
+	})
+}
+
+func BenchmarkTags(b *testing.B) {
+	db := newTagDB(b)
+	stunned, _ := db.Lookup("state.stunned")
+	kv := &tagKv{MockKv: NewMockKv(), t: &tag.Tag{}}
+	kv.t.AddTag(db, stunned)
+	kv.SetInt64("hp", 20)
+	f, err := CompileBool[string, *tagKv]("int hp; hp < 30 && !has_tag('state.stunned')", s2s, WithTags(db))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = f(kv)
+	}
+}
@@ -0,0 +1,219 @@
+package cc
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/legamerdc/game/lib"
+	"github.com/legamerdc/game/tag"
+)
+
+// nodeProbe 是追踪编译时替代子节点的内部节点，不会出现在语法分析的结果中
+const nodeProbe NodeType = -1
+
+// Trace 记录一次追踪求值中一个语法树节点的求值结果。没有被求值的节点（短路、未进入的分支）
+// 不会出现在 Children 中。
+type Trace struct {
+	Pos, End int    // 节点在源码中的字节区间 [Pos, End)
+	Source   string // 节点的源码片段
+	Type     Type
+	Value    lib.Field
+	Err      error
+	Children []*Trace // 被求值的子节点，按求值顺序
+
+	node NodeType
+}
+
+type (
+	// traceCtx 包装求值上下文，记录当前正在求值的节点
+	traceCtx[K any, B Ctx[K]] struct {
+		kv  B
+		cur *Trace
+	}
+)
+
+func (c *traceCtx[K, B]) Get(k K) (lib.Field, bool) { return c.kv.Get(k) }
+func (c *traceCtx[K, B]) Set(k K, v lib.Field)      { c.kv.Set(k, v) }
+func (c *traceCtx[K, B]) Exec(name string, args ...lib.Field) (lib.Field, bool) {
+	return c.kv.Exec(name, args...)
+}
+func (c *traceCtx[K, B]) Rand() Rand     { return _rand(c.kv) }
+func (c *traceCtx[K, B]) Attrs() Attrs   { return any(c.kv).(AttrCtx).Attrs() }
+func (c *traceCtx[K, B]) Tags() *tag.Tag { return any(c.kv).(TagCtx).Tags() }
+
+// CompileTraced 编译一个带追踪的求值函数，每次求值除了结果还返回语法树每个被求值节点的
+// 类型、值和错误。追踪求值总是使用闭包后端，并且每次求值都会分配，只用于调试和编辑器中
+// 解释条件的结果；Compile 生成的函数不受影响。
+func CompileTraced[K any, B Ctx[K]](code string, key Key[K], opts ...Option) (func(kv B) (lib.Field, *Trace, error), error) {
+	o := ctxOptions[B](opts)
+	t, e := check(code, o)
+	if e != nil {
+		return nil, e
+	}
+	f, e := compileTrace[K, B](t.root, t.vars, key, code)
+	if e != nil {
+		return nil, e
+	}
+	g := _frame(f, t.locals)
+	return func(kv B) (lib.Field, *Trace, error) {
+		top := &Trace{}
+		v, e := g(&traceCtx[K, B]{kv: kv, cur: top})
+		return v, top.Children[0], e
+	}, nil
+}
+
+// compileTrace 编译节点 n 的浅拷贝，子节点替换为已编译的追踪闭包，再在外层记录求值结果。
+// 节点本身的编译逻辑与 Compile 完全相同。
+func compileTrace[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K], code string) (func(frame[*traceCtx[K, B]]) (lib.Field, error), error) {
+	c := *n
+	c.Children = make([]*Node, len(n.Children))
+	for i, x := range n.Children {
+		// 声明不求值，has_tag 的参数在编译期已解析
+		if x.Type == NodeVarDecl || n.tag != nil {
+			c.Children[i] = x
+			continue
+		}
+		f, e := compileTrace[K, B](x, m, k, code)
+		if e != nil {
+			return nil, e
+		}
+		c.Children[i] = &Node{Type: nodeProbe, Target: x.Target, Pos: x.Pos, End: x.End, probe: f}
+	}
+	f, e := compile[K, *traceCtx[K, B]](&c, m, k)
+	if e != nil {
+		return nil, e
+	}
+	pos, end, src, typ, node := n.Pos, n.End, code[n.Pos:n.End], n.Target, n.Type
+	return func(b frame[*traceCtx[K, B]]) (lib.Field, error) {
+		t := &Trace{Pos: pos, End: end, Source: src, Type: typ, node: node}
+		parent := b.kv.cur
+		parent.Children = append(parent.Children, t)
+		b.kv.cur = t
+		t.Value, t.Err = f(b)
+		b.kv.cur = parent
+		return t.Value, t.Err
+	}, nil
+}
+
+// String 把追踪结果渲染为一行：复合表达式的值以 " (=v)" 标注在其源码之后，出错的节点以
+// " (!err)" 标注，最后以 " → v" 给出整个程序的结果。变量声明不输出。
+//
+//	float hp, hp_max; hp/hp_max < 0.35  =>  hp/hp_max (=0.42) < 0.35 → false
+func (t *Trace) String() string {
+	var sb strings.Builder
+	t.render(&sb)
+	sb.WriteString(" → ")
+	if t.Err != nil {
+		sb.WriteString("error: " + t.Err.Error())
+	} else {
+		sb.WriteString(t.value())
+	}
+	return sb.String()
+}
+
+// render 输出节点的源码，被求值的子节点替换为其渲染结果
+func (t *Trace) render(sb *strings.Builder) {
+	cs := slices.SortedFunc(slices.Values(t.Children), func(a, b *Trace) int { return a.Pos - b.Pos })
+	if t.node == NodeProgram {
+		for i, c := range cs {
+			if i > 0 {
+				sb.WriteString("; ")
+			}
+			c.render(sb)
+		}
+		return
+	}
+	cur := t.Pos
+	for _, c := range cs {
+		sb.WriteString(t.Source[cur-t.Pos : c.Pos-t.Pos])
+		c.render(sb)
+		if t.node != NodeBlock {
+			c.annotate(sb)
+		}
+		cur = c.End
+	}
+	sb.WriteString(t.Source[cur-t.Pos:])
+}
+
+// annotate 标注复合表达式的值或错误的来源，错误只在最先出错的节点上标注
+func (t *Trace) annotate(sb *strings.Builder) {
+	if t.Err != nil {
+		if !slices.ContainsFunc(t.Children, func(c *Trace) bool { return c.Err != nil }) {
+			sb.WriteString(" (!" + t.Err.Error() + ")")
+		}
+		return
+	}
+	switch t.node {
+	case NodeBinOp, NodeTernary, NodeFunc, NodeBuiltin:
+	case NodeUnaryOp:
+		// -1 这样的字面量不需要标注
+		if len(t.Children) == 1 && t.Children[0].node == NodeNumber {
+			return
+		}
+	default:
+		return
+	}
+	sb.WriteString(" (=" + t.value() + ")")
+}
+
+// value 按节点的类型格式化值，浮点数保留至多 4 位小数
+func (t *Trace) value() string {
+	v := t.Value
+	switch t.Type {
+	case exprInt:
+		if i, ok := v.Int64(); ok {
+			return strconv.FormatInt(i, 10)
+		}
+	case exprFloat:
+		if f, ok := v.Float64(); ok {
+			return _formatFloat(f)
+		}
+	case exprBool:
+		if b, ok := v.Bool(); ok {
+			return strconv.FormatBool(b)
+		}
+	case exprString:
+		if s, ok := v.Str(); ok {
+			return strconv.Quote(s)
+		}
+	case exprFixed:
+		if q, ok := v.Fixed(); ok {
+			return _formatFloat(q.Float64())
+		}
+	case exprVec2:
+		if a, ok := v.Vec2(); ok {
+			return "(" + _formatFloat(a.X) + ", " + _formatFloat(a.Y) + ")"
+		}
+	case exprVec3:
+		if a, ok := v.Vec3(); ok {
+			return "(" + _formatFloat(a.X) + ", " + _formatFloat(a.Y) + ", " + _formatFloat(a.Z) + ")"
+		}
+	}
+	// 类型未知时按值本身的种类
+	if i, ok := v.Int64(); ok {
+		return strconv.FormatInt(i, 10)
+	}
+	if f, ok := v.Float64(); ok {
+		return _formatFloat(f)
+	}
+	if s, ok := v.Str(); ok {
+		return strconv.Quote(s)
+	}
+	if b, ok := v.Bool(); ok {
+		return strconv.FormatBool(b)
+	}
+	return "empty"
+}
+
+func _formatFloat(f float64) string {
+	if math.IsInf(f, 0) || math.IsNaN(f) || math.Abs(f) >= 1e15 {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	r := math.Round(f*1e4) / 1e4
+	if r == 0 {
+		r = 0 // -0
+	}
+	return strconv.FormatFloat(r, 'f', -1, 64)
+}
@@ -0,0 +1,119 @@
+package cc
+
+import (
+	"testing"
+
+	"github.com/legamerdc/game/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrace(t *testing.T) {
+	trace := func(code string, kv *MockKv) (lib.Field, *Trace, error) {
+		f, err := CompileTraced[string, *MockKv](code, s2s)
+		require.Nil(t, err, code)
+		return f(kv)
+	}
+
+	t.Run("渲染", func(t *testing.T) {
+		kv := NewMockKv()
+		kv.SetFloat64("hp", 42)
+		kv.SetFloat64("hp_max", 100)
+		kv.SetInt64("x", 3)
+		kv.Set("s", lib.String("orc"))
+		cases := []struct {
+			code, want string
+		}{
+			{"float hp, hp_max; hp/hp_max < 0.35", "hp/hp_max (=0.42) < 0.35 → false"},
+			{"float hp, hp_max; hp / (hp_max * 3) < 0.35", "hp / (hp_max * 3) (=300) (=0.14) < 0.35 → true"},
+			{"int x; x > 5 && x < 10", "x > 5 (=false) && x < 10 → false"},
+			{"int x; x > 0 ? -1 : abs(x - 5)", "x > 0 (=true) ? -1 : abs(x - 5) → -1"},
+			{"int x; let r = x * 2; if (r > 5) { r = 5 }; r", "let r = x * 2 (=6); if (r > 5 (=true)) { r = 5 }; r → 5"},
+			{"string s; s + '!'", `s + '!' → "orc!"`},
+			{"float hp; sqrt(hp) > 6", "sqrt(hp) (=6.4807) > 6 → true"},
+		}
+		for _, c := range cases {
+			_, tr, err := trace(c.code, kv)
+			require.Nil(t, err, c.code)
+			assert.Equal(t, c.want, tr.String(), c.code)
+		}
+	})
+
+	t.Run("节点记录", func(t *testing.T) {
+		kv := NewMockKv()
+		kv.SetInt64("x", 3)
+		code := "int x; x * 2 > 5"
+		v, tr, err := trace(code, kv)
+		require.Nil(t, err)
+		assert.Equal(t, lib.Bool(true), v)
+		assert.Equal(t, lib.Bool(true), tr.Value)
+		require.Len(t, tr.Children, 1)
+		gt := tr.Children[0]
+		assert.Equal(t, "x * 2 > 5", gt.Source)
+		assert.Equal(t, TypeBool, gt.Type)
+		require.Len(t, gt.Children, 2)
+		mul := gt.Children[0]
+		assert.Equal(t, "x * 2", code[mul.Pos:mul.End])
+		assert.Equal(t, TypeInt, mul.Type)
+		assert.Equal(t, lib.Int64(6), mul.Value)
+		assert.Equal(t, "x", mul.Children[0].Source)
+		assert.Equal(t, lib.Int64(3), mul.Children[0].Value)
+	})
+
+	t.Run("错误标注在出错的节点上", func(t *testing.T) {
+		kv := NewMockKv()
+		kv.SetInt64("x", 3)
+		_, tr, err := trace("int x, y; x + y! > 1", kv)
+		require.NotNil(t, err)
+		assert.Equal(t, "x + y! (!key not set: y) > 1 → error: key not set: y", tr.String())
+		assert.Equal(t, err, tr.Err)
+	})
+
+	t.Run("结果与 Compile 一致", func(t *testing.T) {
+		for _, c := range corpus {
+			f0, e0 := Compile[string, *MockKv](c.code, s2s)
+			f1, e1 := CompileTraced[string, *MockKv](c.code, s2s)
+			require.Equal(t, e0 == nil, e1 == nil, c.code)
+			if e0 != nil {
+				continue
+			}
+			kv0, kv1 := corpusMockKv(c), corpusMockKv(c)
+			v0, e0 := f0(kv0)
+			v1, tr, e1 := f1(kv1)
+			assert.Equal(t, e0 == nil, e1 == nil, c.code)
+			assert.Equal(t, v0, v1, c.code)
+			assert.Equal(t, kv0.data, kv1.data, c.code)
+			assert.NotEmpty(t, tr.String(), c.code)
+		}
+	})
+
+	t.Run("能力接口透传", func(t *testing.T) {
+		f, err := CompileTraced[string, *randKv]("randint(1, 6) + 0", s2s)
+		require.Nil(t, err)
+		g := MustCompile[string, *randKv]("randint(1, 6) + 0", s2s)
+		v0, _, _ := f(newRandKv(7))
+		v1, _ := g(newRandKv(7))
+		assert.Equal(t, v1, v0)
+	})
+}
+
+func BenchmarkTrace(b *testing.B) {
+	code := "float hp, hp_max; hp/hp_max < 0.35"
+	kv := NewMockKv()
+	kv.SetFloat64("hp", 42)
+	kv.SetFloat64("hp_max", 100)
+	b.Run("untraced", func(b *testing.B) {
+		f := MustCompile[string, *MockKv](code, s2s)
+		b.ReportAllocs()
+		for b.Loop() {
+			_, _ = f(kv)
+		}
+	})
+	b.Run("traced", func(b *testing.B) {
+		f, _ := CompileTraced[string, *MockKv](code, s2s)
+		b.ReportAllocs()
+		for b.Loop() {
+			_, _, _ = f(kv)
+		}
+	})
+}
@@ -0,0 +1,773 @@
+package cc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/legamerdc/game/lib"
+)
+
+var fmtResultType = "result type mismatch: want %s, got %s"
+
+// CompileBool 编译一个结果为 bool 的程序，返回值不再经过 lib.Field。
+// 程序最后一条语句的类型在编译期检查，不是 bool 时返回错误。
+//
+// 类型化入口只在默认后端的普通模式下特化：WithFixed、WithSafe 或使用了向量的程序退回到
+// Compile 生成的闭包，WithBackend(BackendVM) 时使用字节码后端，都只在结果上取值，性能与
+// Compile 相同。CompileFloat、CompileInt 同理。
+func CompileBool[K any, B Ctx[K]](code string, key Key[K], opts ...Option) (func(kv B) (bool, error), error) {
+	return compileTyped(code, key, opts, exprBool, typedBool[K, B], lib.Field.Bool)
+}
+
+// CompileFloat 编译一个结果为 float 的程序，int 结果会转换为 float。
+// WithFixed、WithSafe 与向量不做特化，见 CompileBool。
+func CompileFloat[K any, B Ctx[K]](code string, key Key[K], opts ...Option) (func(kv B) (float64, error), error) {
+	return compileTyped(code, key, opts, exprFloat, typedFloat[K, B], lib.Field.Float64)
+}
+
+// CompileInt 编译一个结果为 int 的程序。WithFixed、WithSafe 与向量不做特化，见 CompileBool。
+func CompileInt[K any, B Ctx[K]](code string, key Key[K], opts ...Option) (func(kv B) (int64, error), error) {
+	return compileTyped(code, key, opts, exprInt, typedInt[K, B], lib.Field.Int64)
+}
+
+// compileTyped 为每个节点按推断出的类型生成特化的闭包，中间值直接以 int64/float64/bool
+// 传递，不再装箱为 lib.Field。没有特化的节点（字符串、Exec 调用等）退回到 compile
+// 生成的闭包再取值，因此结果与 Compile 后对返回值取值完全一致。
+func compileTyped[K any, B Ctx[K], X any](code string, key Key[K], opts []Option, want exprType,
+	typed func(*Node, map[string]exprType, Key[K]) (func(frame[B]) (X, error), error),
+	extract func(lib.Field) (X, bool)) (func(kv B) (X, error), error) {
+	o := ctxOptions[B](opts)
+	t, e := check(code, o)
+	if e != nil {
+		return nil, e
+	}
+	return typedTree(t, o, key, want, typed, extract)
+}
+
+// typedTree 在检查过的语法树上生成 compileTyped 的结果
+func typedTree[K any, B Ctx[K], X any](t *tree, o *options, key Key[K], want exprType,
+	typed func(*Node, map[string]exprType, Key[K]) (func(frame[B]) (X, error), error),
+	extract func(lib.Field) (X, bool)) (func(kv B) (X, error), error) {
+	ret := t.ret
+	if ret == exprFixed {
+		ret = exprFloat
+	}
+	if ret != want && !(want == exprFloat && ret == exprInt) {
+		return nil, fmt.Errorf(fmtResultType, want, ret)
+	}
+	// 定点模式的中间值是 lib.Q32，含向量的表达式与安全模式也不做特化，在闭包后端的结果上取值
+	if o.backend == BackendVM || o.fixed || o.safe || t.vec {
+		gen := compileVM[K, B]
+		if o.fixed || o.safe || t.vec {
+			gen = compileTree[K, B]
+		}
+		f, e := gen(t, key)
+		if e != nil {
+			return nil, e
+		}
+		return func(kv B) (x X, e error) {
+			v, e := f(kv)
+			if e != nil {
+				return x, e
+			}
+			x, _ = extract(v)
+			return x, nil
+		}, nil
+	}
+	f, e := typed(t.root, t.vars, key)
+	if e != nil {
+		return nil, e
+	}
+	return _frame(f, t.locals), nil
+}
+
+func typedFloat[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (func(frame[B]) (float64, error), error) {
+	switch n.Type {
+	case NodeProgram, NodeBlock:
+		return _typedBlock(n, m, k, typedFloat[K, B])
+	case NodeNumber:
+		v, e := _number(n)
+		if e != nil {
+			return nil, e
+		}
+		x, _ := v.Float64()
+		return func(frame[B]) (float64, error) {
+			return x, nil
+		}, nil
+	case NodeIdent, NodeTryIdent:
+		return _typedIdent[K, B](n, m, k, lib.Field.Float64), nil
+	case NodeTernary, NodeIf:
+		return _typedCond(n, m, k, typedFloat[K, B])
+	case NodeBinOp:
+		if n.Children[0].Target != exprFloat {
+			break
+		}
+		f0, e0 := typedFloat[K, B](n.Children[0], m, k)
+		f1, e1 := typedFloat[K, B](n.Children[1], m, k)
+		if e := errors.Join(e0, e1); e != nil {
+			return nil, e
+		}
+		if n.Token == "^" {
+			return _typedBin(f0, f1, math.Pow), nil
+		}
+		if f := _typedArith(n.Token, f0, f1); f != nil {
+			return f, nil
+		}
+	case NodeUnaryOp:
+		if n.Token == "+" {
+			return typedFloat[K, B](n.Children[0], m, k)
+		}
+		if n.Token == "-" && n.Target == exprFloat {
+			f, e := typedFloat[K, B](n.Children[0], m, k)
+			if e != nil {
+				return nil, e
+			}
+			return func(b frame[B]) (x float64, e error) {
+				if x, e = f(b); e != nil {
+					return
+				}
+				return -x, nil
+			}, nil
+		}
+	case NodeBuiltin:
+		if n.Target != exprFloat || randBuiltins[n.Token] {
+			break
+		}
+		fs, e := _typedNodes(n.Children, m, k, typedFloat[K, B])
+		if e != nil {
+			return nil, e
+		}
+		switch n.Token {
+		case "abs":
+			return _typedUnary(fs[0], math.Abs), nil
+		case "min":
+			return _typedBin(fs[0], fs[1], math.Min), nil
+		case "max":
+			return _typedBin(fs[0], fs[1], math.Max), nil
+		case "clamp":
+			return _typedClamp(fs[0], fs[1], fs[2], func(x, lo, hi float64) float64 {
+				return math.Min(math.Max(x, lo), hi)
+			}), nil
+		}
+	case NodeFunc:
+		if n.def == nil {
+			break
+		}
+		var (
+			fs []func(frame[B]) (float64, error)
+			e  error
+		)
+		switch fn := n.def.raw.(type) {
+		case func() float64:
+			return func(frame[B]) (float64, error) {
+				return fn(), nil
+			}, nil
+		case func(float64) float64:
+			if fs, e = _typedNodes(n.Children, m, k, typedFloat[K, B]); e != nil {
+				return nil, e
+			}
+			return _typedUnary(fs[0], fn), nil
+		case func(float64, float64) float64:
+			if fs, e = _typedNodes(n.Children, m, k, typedFloat[K, B]); e != nil {
+				return nil, e
+			}
+			return _typedBin(fs[0], fs[1], fn), nil
+		case func(float64, float64, float64) float64:
+			if fs, e = _typedNodes(n.Children, m, k, typedFloat[K, B]); e != nil {
+				return nil, e
+			}
+			return _typedClamp(fs[0], fs[1], fs[2], fn), nil
+		}
+	case NodeAssign, NodeLet:
+		if n.Target == exprFloat {
+			return _typedStore(n, m, k, typedFloat[K, B], lib.Float64)
+		}
+	}
+	if _natural(n) == exprInt {
+		f, e := typedInt[K, B](n, m, k)
+		if e != nil {
+			return nil, e
+		}
+		return _typedUnary(f, func(x int64) float64 { return float64(x) }), nil
+	}
+	return _typedFallback[K, B](n, m, k, lib.Field.Float64)
+}
+
+func typedInt[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (func(frame[B]) (int64, error), error) {
+	switch n.Type {
+	case NodeProgram, NodeBlock:
+		return _typedBlock(n, m, k, typedInt[K, B])
+	case NodeNumber:
+		v, e := _number(n)
+		if e != nil {
+			return nil, e
+		}
+		x, _ := v.Int64()
+		return func(frame[B]) (int64, error) {
+			return x, nil
+		}, nil
+	case NodeIdent, NodeTryIdent:
+		return _typedIdent[K, B](n, m, k, lib.Field.Int64), nil
+	case NodeTernary, NodeIf:
+		return _typedCond(n, m, k, typedInt[K, B])
+	case NodeBinOp:
+		if n.Children[0].Target != exprInt {
+			break
+		}
+		f0, e0 := typedInt[K, B](n.Children[0], m, k)
+		f1, e1 := typedInt[K, B](n.Children[1], m, k)
+		if e := errors.Join(e0, e1); e != nil {
+			return nil, e
+		}
+		switch n.Token {
+		case "^":
+			return _typedBin(f0, f1, _ipower), nil
+		case "%":
+			return _typedBin(f0, f1, func(x, y int64) int64 { return x % y }), nil
+		}
+		if f := _typedArith(n.Token, f0, f1); f != nil {
+			return f, nil
+		}
+	case NodeUnaryOp:
+		if n.Token == "+" {
+			return typedInt[K, B](n.Children[0], m, k)
+		}
+		if n.Token == "-" && n.Target != exprFloat {
+			f, e := typedInt[K, B](n.Children[0], m, k)
+			if e != nil {
+				return nil, e
+			}
+			return func(b frame[B]) (x int64, e error) {
+				if x, e = f(b); e != nil {
+					return
+				}
+				return -x, nil
+			}, nil
+		}
+	case NodeBuiltin:
+		if n.Target != exprInt || randBuiltins[n.Token] {
+			break
+		}
+		fs, e := _typedNodes(n.Children, m, k, typedInt[K, B])
+		if e != nil {
+			return nil, e
+		}
+		switch n.Token {
+		case "abs":
+			return _typedUnary(fs[0], _iabs), nil
+		case "min":
+			return _typedBin(fs[0], fs[1], func(x, y int64) int64 { return min(x, y) }), nil
+		case "max":
+			return _typedBin(fs[0], fs[1], func(x, y int64) int64 { return max(x, y) }), nil
+		case "clamp":
+			return _typedClamp(fs[0], fs[1], fs[2], func(x, lo, hi int64) int64 {
+				return min(max(x, lo), hi)
+			}), nil
+		}
+	case NodeFunc:
+		if n.def == nil {
+			break
+		}
+		switch fn := n.def.raw.(type) {
+		case func(int64) int64:
+			fs, e := _typedNodes(n.Children, m, k, typedInt[K, B])
+			if e != nil {
+				return nil, e
+			}
+			return _typedUnary(fs[0], fn), nil
+		case func(int64, int64) int64:
+			fs, e := _typedNodes(n.Children, m, k, typedInt[K, B])
+			if e != nil {
+				return nil, e
+			}
+			return _typedBin(fs[0], fs[1], fn), nil
+		}
+	case NodeAssign, NodeLet:
+		if n.Target == exprInt {
+			return _typedStore(n, m, k, typedInt[K, B], lib.Int64)
+		}
+	}
+	return _typedFallback[K, B](n, m, k, lib.Field.Int64)
+}
+
+func typedBool[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (func(frame[B]) (bool, error), error) {
+	switch n.Type {
+	case NodeProgram, NodeBlock:
+		return _typedBlock(n, m, k, typedBool[K, B])
+	case NodeNumber, NodeBool:
+		var (
+			v lib.Field
+			e error
+		)
+		if n.Type == NodeNumber {
+			v, e = _number(n)
+		} else {
+			v, e = _bool(n)
+		}
+		if e != nil {
+			return nil, e
+		}
+		x, _ := v.Bool()
+		return func(frame[B]) (bool, error) {
+			return x, nil
+		}, nil
+	case NodeIdent, NodeTryIdent:
+		return _typedIdent[K, B](n, m, k, lib.Field.Bool), nil
+	case NodeTernary, NodeIf:
+		return _typedCond(n, m, k, typedBool[K, B])
+	case NodeBuiltin:
+		if n.tag != nil {
+			has := _hasTag[B](n)
+			return func(b frame[B]) (bool, error) {
+				return has(b.kv), nil
+			}, nil
+		}
+	case NodeBinOp:
+		switch n.Token {
+		case "&&", "||":
+			return _typedLogic[K, B](n, m, k)
+		case "==", "!=", "<", "<=", ">", ">=":
+			switch n.Children[0].Target {
+			case exprInt:
+				f0, e0 := typedInt[K, B](n.Children[0], m, k)
+				f1, e1 := typedInt[K, B](n.Children[1], m, k)
+				if e := errors.Join(e0, e1); e != nil {
+					return nil, e
+				}
+				return _typedCompare(n.Token, f0, f1), nil
+			case exprFloat:
+				f0, e0 := typedFloat[K, B](n.Children[0], m, k)
+				f1, e1 := typedFloat[K, B](n.Children[1], m, k)
+				if e := errors.Join(e0, e1); e != nil {
+					return nil, e
+				}
+				return _typedCompare(n.Token, f0, f1), nil
+			case exprBool:
+				f0, e0 := typedBool[K, B](n.Children[0], m, k)
+				f1, e1 := typedBool[K, B](n.Children[1], m, k)
+				if e := errors.Join(e0, e1); e != nil {
+					return nil, e
+				}
+				if n.Token == "==" {
+					return _typedBin(f0, f1, func(x, y bool) bool { return x == y }), nil
+				}
+				return _typedBin(f0, f1, func(x, y bool) bool { return x != y }), nil
+			}
+		}
+	case NodeUnaryOp:
+		switch n.Token {
+		case "+":
+			return typedBool[K, B](n.Children[0], m, k)
+		case "!":
+			f, e := typedBool[K, B](n.Children[0], m, k)
+			if e != nil {
+				return nil, e
+			}
+			return func(b frame[B]) (x bool, e error) {
+				if x, e = f(b); e != nil {
+					return
+				}
+				return !x, nil
+			}, nil
+		}
+	case NodeAssign, NodeLet:
+		if n.Target == exprBool {
+			return _typedStore(n, m, k, typedBool[K, B], lib.Bool)
+		}
+	}
+	if _natural(n) == exprInt {
+		f, e := typedInt[K, B](n, m, k)
+		if e != nil {
+			return nil, e
+		}
+		return _typedUnary(f, func(x int64) bool { return x != 0 }), nil
+	}
+	return _typedFallback[K, B](n, m, k, lib.Field.Bool)
+}
+
+// _natural 返回节点在 Compile 中产生的 lib.Field 的类型，运行期才能确定时返回 exprUnknown
+func _natural(n *Node) exprType {
+	switch n.Type {
+	case NodeNumber, NodeBuiltin:
+		return n.Target
+	case NodeBinOp:
+		switch n.Token {
+		case "^", "+", "-", "*", "/", "%":
+			return n.Children[0].Target
+		case "&&", "||":
+			return exprUnknown
+		}
+		return exprBool
+	case NodeUnaryOp:
+		switch n.Token {
+		case "+":
+			return _natural(n.Children[0])
+		case "-":
+			if n.Target == exprFloat {
+				return exprFloat
+			}
+			return exprInt
+		}
+		return exprBool
+	case NodeAssign, NodeLet:
+		return _natural(n.Children[0])
+	case NodeFunc:
+		if n.def != nil {
+			return n.def.ret
+		}
+	}
+	return exprUnknown
+}
+
+// _typedBlock 只有最后一条语句需要特化，前面语句的值会被丢弃，直接使用 compile 的闭包。
+// 错误处理与 _inline 保持一致。
+func _typedBlock[K any, B Ctx[K], X any](n *Node, m map[string]exprType, k Key[K],
+	typed func(*Node, map[string]exprType, Key[K]) (func(frame[B]) (X, error), error)) (func(frame[B]) (X, error), error) {
+	var stmts []*Node
+	for _, x := range n.Children {
+		if x.Type != NodeVarDecl {
+			stmts = append(stmts, x)
+		}
+	}
+	if len(stmts) == 0 {
+		return func(frame[B]) (x X, e error) {
+			return
+		}, nil
+	}
+	last, e := typed(stmts[len(stmts)-1], m, k)
+	if e != nil {
+		return nil, e
+	}
+	if len(stmts) == 1 {
+		return last, nil
+	}
+	fs, e := _compileNodes[K, B](stmts[:len(stmts)-1], m, k)
+	if e != nil {
+		return nil, e
+	}
+	if len(stmts) <= 5 {
+		return func(b frame[B]) (x X, e error) {
+			for _, f := range fs {
+				if _, e0 := f(b); e0 != nil {
+					e = errors.Join(e, e0)
+				}
+			}
+			x, e0 := last(b)
+			if e = errors.Join(e, e0); e != nil {
+				return
+			}
+			return x, nil
+		}, nil
+	}
+	return func(b frame[B]) (x X, e error) {
+		for _, f := range fs {
+			if _, e = f(b); e != nil {
+				return
+			}
+		}
+		return last(b)
+	}, nil
+}
+
+func _typedIdent[K any, B Ctx[K], X any](n *Node, m map[string]exprType, k Key[K], extract func(lib.Field) (X, bool)) func(frame[B]) (X, error) {
+	if n.local != nil {
+		slot := n.local.slot
+		return func(b frame[B]) (X, error) {
+			x, _ := extract(b.l[slot])
+			return x, nil
+		}
+	}
+	if n.attr != nil {
+		get := _attrGet[B](n)
+		return func(b frame[B]) (x X, e error) {
+			v, e := get(b.kv)
+			x, _ = extract(lib.Float64(v))
+			return x, e
+		}
+	}
+	key := k(n.Token)
+	if n.Type == NodeIdent {
+		token := n.Token
+		return func(b frame[B]) (x X, e error) {
+			v, ok := b.kv.Get(key)
+			if !ok {
+				return x, n.errorf(fmtKeyMiss, token)
+			}
+			x, _ = extract(v)
+			return x, nil
+		}
+	}
+	zero, _ := extract(_zero(m[n.Token]))
+	return func(b frame[B]) (X, error) {
+		v, ok := b.kv.Get(key)
+		if !ok {
+			return zero, nil
+		}
+		x, _ := extract(v)
+		return x, nil
+	}
+}
+
+// _typedCond 处理三目运算与 if 语句：条件为 bool，结果取执行到的分支，没有 else 时为零值
+func _typedCond[K any, B Ctx[K], X any](n *Node, m map[string]exprType, k Key[K],
+	typed func(*Node, map[string]exprType, Key[K]) (func(frame[B]) (X, error), error)) (func(frame[B]) (X, error), error) {
+	f0, e := typedBool[K, B](n.Children[0], m, k)
+	if e != nil {
+		return nil, e
+	}
+	fs, e := _typedNodes(n.Children[1:], m, k, typed)
+	if e != nil {
+		return nil, e
+	}
+	f1 := fs[0]
+	if len(fs) == 1 {
+		return func(b frame[B]) (x X, e error) {
+			c, e := f0(b)
+			if e != nil || !c {
+				return x, e
+			}
+			return f1(b)
+		}, nil
+	}
+	f2 := fs[1]
+	return func(b frame[B]) (x X, e error) {
+		c, e := f0(b)
+		if e != nil {
+			return x, e
+		}
+		if c {
+			return f1(b)
+		}
+		return f2(b)
+	}, nil
+}
+
+func _typedLogic[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (func(frame[B]) (bool, error), error) {
+	f0, e0 := typedBool[K, B](n.Children[0], m, k)
+	f1, e1 := typedBool[K, B](n.Children[1], m, k)
+	if e := errors.Join(e0, e1); e != nil {
+		return nil, e
+	}
+	if n.Token == "&&" {
+		return func(b frame[B]) (bool, error) {
+			x, e := f0(b)
+			if e != nil || !x {
+				return false, e
+			}
+			return f1(b)
+		}, nil
+	}
+	return func(b frame[B]) (bool, error) {
+		x, e := f0(b)
+		if e != nil {
+			return false, e
+		}
+		if x {
+			return true, nil
+		}
+		return f1(b)
+	}, nil
+}
+
+// _typedStore 处理赋值与 let：写入的值按目标类型装箱一次，表达式的结果仍以原类型返回
+func _typedStore[K any, B Ctx[K], X any](n *Node, m map[string]exprType, k Key[K],
+	typed func(*Node, map[string]exprType, Key[K]) (func(frame[B]) (X, error), error),
+	box func(X) lib.Field) (func(frame[B]) (X, error), error) {
+	f, e := typed(n.Children[0], m, k)
+	if e != nil {
+		return nil, e
+	}
+	if n.local != nil {
+		slot := n.local.slot
+		return func(b frame[B]) (x X, e error) {
+			if x, e = f(b); e != nil {
+				return
+			}
+			b.l[slot] = box(x)
+			return x, nil
+		}, nil
+	}
+	if n.attr != nil {
+		set := _attrSet[B](n)
+		return func(b frame[B]) (x X, e error) {
+			if x, e = f(b); e != nil {
+				return
+			}
+			v, _ := box(x).Float64()
+			return x, set(b.kv, v)
+		}, nil
+	}
+	key := k(n.Token)
+	return func(b frame[B]) (x X, e error) {
+		if x, e = f(b); e != nil {
+			return
+		}
+		b.kv.Set(key, box(x))
+		return x, nil
+	}, nil
+}
+
+func _typedFallback[K any, B Ctx[K], X any](n *Node, m map[string]exprType, k Key[K], extract func(lib.Field) (X, bool)) (func(frame[B]) (X, error), error) {
+	f, e := compile[K, B](n, m, k)
+	if e != nil {
+		return nil, e
+	}
+	return func(b frame[B]) (x X, e error) {
+		v, e := f(b)
+		if e != nil {
+			return x, e
+		}
+		x, _ = extract(v)
+		return x, nil
+	}, nil
+}
+
+func _typedNodes[K any, B Ctx[K], X any](ns []*Node, m map[string]exprType, k Key[K],
+	typed func(*Node, map[string]exprType, Key[K]) (func(frame[B]) (X, error), error)) (fs []func(frame[B]) (X, error), e error) {
+	fs = make([]func(frame[B]) (X, error), 0, len(ns))
+	for _, n := range ns {
+		var f func(frame[B]) (X, error)
+		if f, e = typed(n, m, k); e != nil {
+			return
+		}
+		fs = append(fs, f)
+	}
+	return
+}
+
+// _typedArith 对四则运算直接内联运算符，避免再经过一次函数调用
+func _typedArith[B any, X int64 | float64](op string, f0, f1 func(frame[B]) (X, error)) func(frame[B]) (X, error) {
+	switch op {
+	case "+":
+		return func(b frame[B]) (X, error) {
+			x, e0 := f0(b)
+			y, e1 := f1(b)
+			if e0 != nil || e1 != nil {
+				return 0, errors.Join(e0, e1)
+			}
+			return x + y, nil
+		}
+	case "-":
+		return func(b frame[B]) (X, error) {
+			x, e0 := f0(b)
+			y, e1 := f1(b)
+			if e0 != nil || e1 != nil {
+				return 0, errors.Join(e0, e1)
+			}
+			return x - y, nil
+		}
+	case "*":
+		return func(b frame[B]) (X, error) {
+			x, e0 := f0(b)
+			y, e1 := f1(b)
+			if e0 != nil || e1 != nil {
+				return 0, errors.Join(e0, e1)
+			}
+			return x * y, nil
+		}
+	case "/":
+		return func(b frame[B]) (X, error) {
+			x, e0 := f0(b)
+			y, e1 := f1(b)
+			if e0 != nil || e1 != nil {
+				return 0, errors.Join(e0, e1)
+			}
+			return x / y, nil
+		}
+	}
+	return nil
+}
+
+func _typedCompare[B any, X int64 | float64](op string, f0, f1 func(frame[B]) (X, error)) func(frame[B]) (bool, error) {
+	switch op {
+	case "==":
+		return func(b frame[B]) (bool, error) {
+			x, e0 := f0(b)
+			y, e1 := f1(b)
+			if e0 != nil || e1 != nil {
+				return false, errors.Join(e0, e1)
+			}
+			return x == y, nil
+		}
+	case "!=":
+		return func(b frame[B]) (bool, error) {
+			x, e0 := f0(b)
+			y, e1 := f1(b)
+			if e0 != nil || e1 != nil {
+				return false, errors.Join(e0, e1)
+			}
+			return x != y, nil
+		}
+	case "<":
+		return func(b frame[B]) (bool, error) {
+			x, e0 := f0(b)
+			y, e1 := f1(b)
+			if e0 != nil || e1 != nil {
+				return false, errors.Join(e0, e1)
+			}
+			return x < y, nil
+		}
+	case "<=":
+		return func(b frame[B]) (bool, error) {
+			x, e0 := f0(b)
+			y, e1 := f1(b)
+			if e0 != nil || e1 != nil {
+				return false, errors.Join(e0, e1)
+			}
+			return x <= y, nil
+		}
+	case ">":
+		return func(b frame[B]) (bool, error) {
+			x, e0 := f0(b)
+			y, e1 := f1(b)
+			if e0 != nil || e1 != nil {
+				return false, errors.Join(e0, e1)
+			}
+			return x > y, nil
+		}
+	case ">=":
+		return func(b frame[B]) (bool, error) {
+			x, e0 := f0(b)
+			y, e1 := f1(b)
+			if e0 != nil || e1 != nil {
+				return false, errors.Join(e0, e1)
+			}
+			return x >= y, nil
+		}
+	}
+	panic("unreachable")
+}
+
+func _typedUnary[B, X, R any](f func(frame[B]) (X, error), op func(X) R) func(frame[B]) (R, error) {
+	return func(b frame[B]) (r R, e error) {
+		x, e := f(b)
+		if e != nil {
+			return r, e
+		}
+		return op(x), nil
+	}
+}
+
+func _typedBin[B, X, R any](f0, f1 func(frame[B]) (X, error), op func(X, X) R) func(frame[B]) (R, error) {
+	return func(b frame[B]) (r R, e error) {
+		x, e0 := f0(b)
+		y, e1 := f1(b)
+		if e0 != nil || e1 != nil {
+			return r, errors.Join(e0, e1)
+		}
+		return op(x, y), nil
+	}
+}
+
+func _typedClamp[B, X any](f0, f1, f2 func(frame[B]) (X, error), op func(X, X, X) X) func(frame[B]) (X, error) {
+	return func(b frame[B]) (r X, e error) {
+		x, e0 := f0(b)
+		y, e1 := f1(b)
+		z, e2 := f2(b)
+		if e0 != nil || e1 != nil || e2 != nil {
+			return r, errors.Join(e0, e1, e2)
+		}
+		return op(x, y, z), nil
+	}
+}
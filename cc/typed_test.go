@@ -0,0 +1,193 @@
+package cc
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTypedCorpus 类型化入口的结果必须与 Compile 后对返回值取值一致
+func TestTypedCorpus(t *testing.T) {
+	for _, c := range corpus {
+		t.Run(c.code, func(t *testing.T) {
+			want, e0 := Compile[string, *MockKv](c.code, s2s)
+			if e0 != nil {
+				_, e1 := CompileBool[string, *MockKv](c.code, s2s)
+				assert.NotNil(t, e1)
+				return
+			}
+			kv0 := corpusMockKv(c)
+			v0, e0 := want(kv0)
+
+			fb, eb := CompileBool[string, *MockKv](c.code, s2s)
+			fi, ei := CompileInt[string, *MockKv](c.code, s2s)
+			ff, ef := CompileFloat[string, *MockKv](c.code, s2s)
+			if eb == nil {
+				kv1 := corpusMockKv(c)
+				x, e1 := fb(kv1)
+				assertTyped(t, e0, e1, kv0, kv1)
+				if e0 == nil {
+					bv, _ := v0.Bool()
+					assert.Equal(t, bv, x)
+				}
+			}
+			if ei == nil {
+				kv1 := corpusMockKv(c)
+				x, e1 := fi(kv1)
+				assertTyped(t, e0, e1, kv0, kv1)
+				if e0 == nil {
+					iv, _ := v0.Int64()
+					assert.Equal(t, iv, x)
+				}
+			}
+			if ef == nil {
+				kv1 := corpusMockKv(c)
+				x, e1 := ff(kv1)
+				assertTyped(t, e0, e1, kv0, kv1)
+				if e0 == nil {
+					fv, _ := v0.Float64()
+					assert.Equal(t, fv, x)
+				}
+			}
+		})
+	}
+}
+
+func assertTyped(t *testing.T, e0, e1 error, kv0, kv1 *MockKv) {
+	assert.Equal(t, e0 == nil, e1 == nil, "eval error: %v %v", e0, e1)
+	if e0 == nil {
+		assert.Equal(t, kv0.data, kv1.data)
+	}
+}
+
+func TestTyped(t *testing.T) {
+	t.Run("结果类型检查", func(t *testing.T) {
+		_, err := CompileBool[string, *MockKv]("float hp, hp_max; hp / hp_max < 0.35", s2s)
+		assert.Nil(t, err)
+		_, err = CompileBool[string, *MockKv]("float hp, hp_max; hp / hp_max", s2s)
+		assert.NotNil(t, err)
+		_, err = CompileInt[string, *MockKv]("float x; x * 2", s2s)
+		assert.NotNil(t, err)
+		_, err = CompileFloat[string, *MockKv]("string s; s", s2s)
+		assert.NotNil(t, err)
+		_, err = CompileFloat[string, *MockKv]("int x, y", s2s)
+		assert.NotNil(t, err)
+		// 分支类型不一致的 if 语句没有确定的类型
+		_, err = CompileInt[string, *MockKv]("int a; if (a > 0) { 1 } else { 'x' }", s2s)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("int结果可以作为float", func(t *testing.T) {
+		f, err := CompileFloat[string, *MockKv]("int a, b; a * b", s2s)
+		assert.Nil(t, err)
+		kv := NewMockKv()
+		kv.SetInt64("a", 6)
+		kv.SetInt64("b", 7)
+		v, err := f(kv)
+		assert.Nil(t, err)
+		assert.Equal(t, 42.0, v)
+	})
+
+	t.Run("求值", func(t *testing.T) {
+		f, err := CompileBool[string, *MockKv]("float hp, hp_max, dist; let r = hp / hp_max; r < 0.35 && dist! < 190", s2s)
+		assert.Nil(t, err)
+		kv := NewMockKv()
+		kv.SetFloat64("hp", 30)
+		kv.SetFloat64("hp_max", 100)
+		_, err = f(kv)
+		assert.NotNil(t, err)
+
+		kv.SetFloat64("dist", 100)
+		v, err := f(kv)
+		assert.Nil(t, err)
+		assert.True(t, v)
+	})
+
+	t.Run("字节码后端", func(t *testing.T) {
+		f, err := CompileInt[string, *MockKv]("int a, b; clamp(a * b, 0, 10)", s2s, WithBackend(BackendVM))
+		assert.Nil(t, err)
+		kv := NewMockKv()
+		kv.SetInt64("a", 6)
+		kv.SetInt64("b", 7)
+		v, err := f(kv)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(10), v)
+	})
+
+	t.Run("if没有else", func(t *testing.T) {
+		opts := []Option{WithBackend(BackendClosure), WithBackend(BackendVM), WithSafe(), WithFixed()}
+		for _, opt := range opts {
+			ff, err := CompileFloat[string, *MockKv]("float hp; if (hp > 0) { hp * 2 }", s2s, opt)
+			require.Nil(t, err)
+			fi, err := CompileInt[string, *MockKv]("int n; if (n > 0) { n + 1 }", s2s, opt)
+			require.Nil(t, err)
+			fb, err := CompileBool[string, *MockKv]("bool a, b; if (a) { b }", s2s, opt)
+			require.Nil(t, err)
+			f, err := Compile[string, *MockKv]("int n; if (n > 0) { n + 1 }", s2s, opt)
+			require.Nil(t, err)
+
+			// 条件不成立时是分支类型的零值
+			kv := NewMockKv()
+			x, err := ff(kv)
+			assert.Nil(t, err)
+			assert.Equal(t, 0.0, x)
+			n, err := fi(kv)
+			assert.Nil(t, err)
+			assert.Equal(t, int64(0), n)
+			kv.SetBool("b", true)
+			c, err := fb(kv)
+			assert.Nil(t, err)
+			assert.False(t, c)
+			v, err := f(kv)
+			assert.Nil(t, err)
+			assert.Equal(t, _zero(exprInt), v)
+
+			kv.SetFloat64("hp", 3)
+			kv.SetInt64("n", 4)
+			kv.SetBool("a", true)
+			x, _ = ff(kv)
+			assert.Equal(t, 6.0, x)
+			n, _ = fi(kv)
+			assert.Equal(t, int64(5), n)
+			c, _ = fb(kv)
+			assert.True(t, c)
+		}
+	})
+}
+
+func BenchmarkTyped(b *testing.B) {
+	for _, c := range benchBackends {
+		kv := NewMockKv()
+		for k, v := range c.kv {
+			kv.Set(k, v)
+		}
+		f, err := Compile[string, *MockKv](c.code, s2s)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(c.name+"/Compile", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				v, _ := f(kv)
+				_, _ = v.Bool()
+			}
+		})
+		if fb, err := CompileBool[string, *MockKv](c.code, s2s); err == nil {
+			b.Run(c.name+"/CompileBool", func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					_, _ = fb(kv)
+				}
+			})
+		}
+		if fi, err := CompileInt[string, *MockKv](c.code, s2s); err == nil {
+			b.Run(c.name+"/CompileInt", func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					_, _ = fi(kv)
+				}
+			})
+		}
+	}
+}
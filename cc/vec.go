@@ -0,0 +1,415 @@
+package cc
+
+import (
+	"errors"
+
+	"github.com/legamerdc/game/lib"
+)
+
+var (
+	fmtVecMember = "no component %s in %s"
+	fmtVecFixed  = "%s is not supported in fixed-point mode"
+)
+
+// vecComponents 是向量的分量名，v.z 只能用于 vec3
+var vecComponents = map[string]bool{"x": true, "y": true, "z": true}
+
+// vecBuiltins 是向量的构造函数与内置运算
+var vecBuiltins = map[string]bool{"vec2": true, "vec3": true, "dist": true, "len": true, "dot": true, "normalize": true, "angle": true}
+
+func _isVec(t exprType) bool {
+	return t == exprVec2 || t == exprVec3
+}
+
+func _isScalar(t exprType) bool {
+	return t == exprInt || t == exprFloat
+}
+
+// findVec 返回第一个向量类型的节点，没有时返回 nil
+func (n *Node) findVec() *Node {
+	if _isVec(n.Target) {
+		return n
+	}
+	for _, x := range n.Children {
+		if v := x.findVec(); v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// vecInfectUp 推断分量访问与向量内置运算的类型：vec2/vec3 的参数是数值，
+// len/normalize 的参数是向量，dist/dot/angle 的两个参数是同类向量
+func (n *Node) vecInfectUp(m map[string]exprType, fs *Funcs) (exprType, error) {
+	ups := make([]exprType, len(n.Children))
+	for i, x := range n.Children {
+		up, e := x.phaseInfectUp(m, fs)
+		if e != nil {
+			return 0, e
+		}
+		ups[i] = up
+	}
+	if n.Type == NodeMember {
+		if t := ups[0]; !_isVec(t) || (n.Token == "z" && t == exprVec2) {
+			return 0, n.errorf(fmtVecMember, n.Token, t)
+		}
+		n.Target = exprFloat
+		return n.Target, nil
+	}
+	switch n.Token {
+	case "vec2", "vec3":
+		for _, t := range ups {
+			if !_isScalar(t) {
+				return 0, n.errorf(fmtWrongVarType, n.Token)
+			}
+		}
+		n.Target = exprVec2
+		if n.Token == "vec3" {
+			n.Target = exprVec3
+		}
+	case "len", "normalize":
+		if !_isVec(ups[0]) {
+			return 0, n.errorf(fmtWrongVarType, n.Token)
+		}
+		n.Target = exprFloat
+		if n.Token == "normalize" {
+			n.Target = ups[0]
+		}
+	default:
+		if !_isVec(ups[0]) || ups[1] != ups[0] {
+			return 0, n.errorf(fmtWrongVarType, n.Token)
+		}
+		n.Target = exprFloat
+	}
+	return n.Target, nil
+}
+
+func (n *Node) vecInfectDown(m map[string]exprType, down exprType) (e error) {
+	var ok bool
+	if n.Target, ok = _infect(n.Target, down); !ok {
+		return n.errorf(fmtWrongVarType, n.Token)
+	}
+	for _, x := range n.Children {
+		t := x.Target
+		if n.Token == "vec2" || n.Token == "vec3" {
+			t = exprFloat
+		}
+		if e = x.phaseInfectDown(m, t); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// vecArithUp 推断含向量的算术：同类向量相加减，向量与标量相乘，向量除以标量
+func (n *Node) vecArithUp(l, r exprType) (exprType, error) {
+	switch {
+	case (n.Token == "+" || n.Token == "-") && l == r:
+		n.Target = l
+	case (n.Token == "*" || n.Token == "/") && _isVec(l) && _isScalar(r):
+		n.Target = l
+	case n.Token == "*" && _isScalar(l) && _isVec(r):
+		n.Target = r
+	default:
+		return 0, n.errorf(fmtWrongVarType, n.Token)
+	}
+	return n.Target, nil
+}
+
+// vecArithDown 向量参与的运算中标量按 float 计算
+func (n *Node) vecArithDown(m map[string]exprType) error {
+	var e error
+	for _, x := range n.Children {
+		t := exprFloat
+		if _isVec(x.Target) {
+			t = x.Target
+		}
+		e = errors.Join(e, x.phaseInfectDown(m, t))
+	}
+	return e
+}
+
+// vecOps 是 lib.Vec2 与 lib.Vec3 共有的运算
+type vecOps[V any] interface {
+	comparable
+	Add(V) V
+	Sub(V) V
+	Scale(float64) V
+	Div(float64) V
+	Dot(V) float64
+	Len() float64
+	Dist(V) float64
+	Normalize() V
+	Angle(V) float64
+}
+
+// vecKind 是一种向量在 lib.Field 中的存取方式
+type vecKind[V vecOps[V]] struct {
+	get  func(lib.Field) (V, bool)
+	box  func(V) lib.Field
+	make func(x, y, z float64) V
+}
+
+var (
+	vec2Kind = vecKind[lib.Vec2]{lib.Field.Vec2, lib.Vector2, func(x, y, _ float64) lib.Vec2 { return lib.Vec2{X: x, Y: y} }}
+	vec3Kind = vecKind[lib.Vec3]{lib.Field.Vec3, lib.Vector3, func(x, y, z float64) lib.Vec3 { return lib.Vec3{X: x, Y: y, Z: z} }}
+)
+
+// compileVecBoxed 编译结果为向量的运算。向量装箱为 lib.Field 时会分配，因此运算之间直接
+// 传递向量，只在结果离开向量运算（赋值、作为条件分支或程序的结果）时装箱一次。
+func compileVecBoxed[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (func(frame[B]) (lib.Field, error), error) {
+	if n.Target == exprVec2 {
+		return _vecBoxed[K, B](vec2Kind, n, m, k)
+	}
+	return _vecBoxed[K, B](vec3Kind, n, m, k)
+}
+
+func _vecBoxed[K any, B Ctx[K], V vecOps[V]](vk vecKind[V], n *Node, m map[string]exprType, k Key[K]) (func(frame[B]) (lib.Field, error), error) {
+	f, e := compileVecValue[K, B](vk, n, m, k)
+	if e != nil {
+		return nil, e
+	}
+	box := vk.box
+	return func(b frame[B]) (v lib.Field, e error) {
+		a, e := f(b)
+		if e != nil {
+			return v, e
+		}
+		return box(a), nil
+	}, nil
+}
+
+// compileVecValue 编译向量类型的节点，返回的闭包直接传递向量。变量、条件、赋值等节点
+// 按 lib.Field 求值后取出向量，读取不会分配。
+func compileVecValue[K any, B Ctx[K], V vecOps[V]](vk vecKind[V], n *Node, m map[string]exprType, k Key[K]) (func(frame[B]) (V, error), error) {
+	switch {
+	case n.Type == NodeBinOp:
+		return _vecArith[K, B](vk, n, m, k)
+	case n.Type == NodeUnaryOp && n.Token == "-":
+		f, e := compileVecValue[K, B](vk, n.Children[0], m, k)
+		if e != nil {
+			return nil, e
+		}
+		return func(b frame[B]) (a V, e error) {
+			if a, e = f(b); e != nil {
+				return
+			}
+			return a.Scale(-1), nil
+		}, nil
+	case n.Type == NodeBuiltin && n.Token == "normalize":
+		f, e := compileVecValue[K, B](vk, n.Children[0], m, k)
+		if e != nil {
+			return nil, e
+		}
+		return func(b frame[B]) (a V, e error) {
+			if a, e = f(b); e != nil {
+				return
+			}
+			return a.Normalize(), nil
+		}, nil
+	case n.Type == NodeBuiltin && (n.Token == "vec2" || n.Token == "vec3"):
+		fs, e := _compileNodes[K, B](n.Children, m, k)
+		if e != nil {
+			return nil, e
+		}
+		mk := vk.make
+		if len(fs) == 2 {
+			f0, f1 := fs[0], fs[1]
+			return func(b frame[B]) (a V, e error) {
+				v0, e0 := f0(b)
+				v1, e1 := f1(b)
+				if e = errors.Join(e0, e1); e != nil {
+					return
+				}
+				x, _ := v0.Float64()
+				y, _ := v1.Float64()
+				return mk(x, y, 0), nil
+			}, nil
+		}
+		f0, f1, f2 := fs[0], fs[1], fs[2]
+		return func(b frame[B]) (a V, e error) {
+			v0, e0 := f0(b)
+			v1, e1 := f1(b)
+			v2, e2 := f2(b)
+			if e = errors.Join(e0, e1, e2); e != nil {
+				return
+			}
+			x, _ := v0.Float64()
+			y, _ := v1.Float64()
+			z, _ := v2.Float64()
+			return mk(x, y, z), nil
+		}, nil
+	}
+	f, e := compile[K, B](n, m, k)
+	if e != nil {
+		return nil, e
+	}
+	get := vk.get
+	return func(b frame[B]) (a V, e error) {
+		v, e := f(b)
+		if e != nil {
+			return a, e
+		}
+		a, _ = get(v)
+		return a, nil
+	}, nil
+}
+
+// _vecArith 编译向量的 + - * /，标量一侧按 float 取值
+func _vecArith[K any, B Ctx[K], V vecOps[V]](vk vecKind[V], n *Node, m map[string]exprType, k Key[K]) (func(frame[B]) (V, error), error) {
+	l, r := n.Children[0], n.Children[1]
+	if _isVec(l.Target) && _isVec(r.Target) {
+		f0, e0 := compileVecValue[K, B](vk, l, m, k)
+		f1, e1 := compileVecValue[K, B](vk, r, m, k)
+		if e := errors.Join(e0, e1); e != nil {
+			return nil, e
+		}
+		op := func(a, b V) V { return a.Add(b) }
+		if n.Token == "-" {
+			op = func(a, b V) V { return a.Sub(b) }
+		}
+		return func(b frame[B]) (a V, e error) {
+			a0, e0 := f0(b)
+			a1, e1 := f1(b)
+			if e = errors.Join(e0, e1); e != nil {
+				return
+			}
+			return op(a0, a1), nil
+		}, nil
+	}
+	// 向量乘除标量，或标量乘向量
+	vec, scalar := l, r
+	if !_isVec(l.Target) {
+		vec, scalar = r, l
+	}
+	fv, e0 := compileVecValue[K, B](vk, vec, m, k)
+	fs, e1 := compile[K, B](scalar, m, k)
+	if e := errors.Join(e0, e1); e != nil {
+		return nil, e
+	}
+	op := func(a V, s float64) V { return a.Scale(s) }
+	if n.Token == "/" {
+		op = func(a V, s float64) V { return a.Div(s) }
+	}
+	left := vec == l
+	return func(b frame[B]) (a V, e error) {
+		var (
+			v  lib.Field
+			e0 error
+			e1 error
+		)
+		// 与其它二元运算一样先求值左侧
+		if left {
+			a, e0 = fv(b)
+			v, e1 = fs(b)
+		} else {
+			v, e0 = fs(b)
+			a, e1 = fv(b)
+		}
+		if e = errors.Join(e0, e1); e != nil {
+			return
+		}
+		s, _ := v.Float64()
+		return op(a, s), nil
+	}, nil
+}
+
+// compileVec 编译向量内置运算
+func compileVec[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (func(frame[B]) (lib.Field, error), error) {
+	if _isVec(n.Target) {
+		return compileVecBoxed[K, B](n, m, k)
+	}
+	if n.Children[0].Target == exprVec2 {
+		return _vecBuiltin[K, B](vec2Kind, n, m, k)
+	}
+	return _vecBuiltin[K, B](vec3Kind, n, m, k)
+}
+
+// _vecBuiltin 编译结果为 float 的 len/dist/dot/angle
+func _vecBuiltin[K any, B Ctx[K], V vecOps[V]](vk vecKind[V], n *Node, m map[string]exprType, k Key[K]) (func(frame[B]) (lib.Field, error), error) {
+	if n.Token == "len" {
+		f0, e := compileVecValue[K, B](vk, n.Children[0], m, k)
+		if e != nil {
+			return nil, e
+		}
+		return func(b frame[B]) (v lib.Field, e error) {
+			a, e := f0(b)
+			if e != nil {
+				return v, e
+			}
+			return lib.Float64(a.Len()), nil
+		}, nil
+	}
+	var op func(a, b V) float64
+	switch n.Token {
+	case "dist":
+		op = func(a, b V) float64 { return a.Dist(b) }
+	case "dot":
+		op = func(a, b V) float64 { return a.Dot(b) }
+	case "angle":
+		op = func(a, b V) float64 { return a.Angle(b) }
+	default:
+		panic("unreachable")
+	}
+	return _vecPair[K, B](vk, n, m, k, func(a, b V) lib.Field { return lib.Float64(op(a, b)) })
+}
+
+// compileVecEqual 编译向量的 == 与 !=
+func compileVecEqual[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (func(frame[B]) (lib.Field, error), error) {
+	eq := n.Token == "=="
+	if n.Children[0].Target == exprVec2 {
+		return _vecPair[K, B](vec2Kind, n, m, k, func(a, b lib.Vec2) lib.Field { return lib.Bool((a == b) == eq) })
+	}
+	return _vecPair[K, B](vec3Kind, n, m, k, func(a, b lib.Vec3) lib.Field { return lib.Bool((a == b) == eq) })
+}
+
+// _vecPair 编译两个同类向量参数、结果不是向量的运算
+func _vecPair[K any, B Ctx[K], V vecOps[V]](vk vecKind[V], n *Node, m map[string]exprType, k Key[K], op func(a, b V) lib.Field) (func(frame[B]) (lib.Field, error), error) {
+	f0, e0 := compileVecValue[K, B](vk, n.Children[0], m, k)
+	f1, e1 := compileVecValue[K, B](vk, n.Children[1], m, k)
+	if e := errors.Join(e0, e1); e != nil {
+		return nil, e
+	}
+	return func(b frame[B]) (v lib.Field, e error) {
+		a0, e0 := f0(b)
+		a1, e1 := f1(b)
+		if e = errors.Join(e0, e1); e != nil {
+			return
+		}
+		return op(a0, a1), nil
+	}, nil
+}
+
+func compileMember[K any, B Ctx[K]](n *Node, m map[string]exprType, k Key[K]) (func(frame[B]) (lib.Field, error), error) {
+	if n.Children[0].Target == exprVec2 {
+		return _vecMember[K, B](vec2Kind, n, m, k, func(a lib.Vec2) float64 {
+			if n.Token == "x" {
+				return a.X
+			}
+			return a.Y
+		})
+	}
+	return _vecMember[K, B](vec3Kind, n, m, k, func(a lib.Vec3) float64 {
+		switch n.Token {
+		case "x":
+			return a.X
+		case "y":
+			return a.Y
+		}
+		return a.Z
+	})
+}
+
+func _vecMember[K any, B Ctx[K], V vecOps[V]](vk vecKind[V], n *Node, m map[string]exprType, k Key[K], c func(V) float64) (func(frame[B]) (lib.Field, error), error) {
+	f, e := compileVecValue[K, B](vk, n.Children[0], m, k)
+	if e != nil {
+		return nil, e
+	}
+	return func(b frame[B]) (v lib.Field, e error) {
+		a, e := f(b)
+		if e != nil {
+			return v, e
+		}
+		return lib.Float64(c(a)), nil
+	}, nil
+}
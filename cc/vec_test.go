@@ -0,0 +1,166 @@
+package cc
+
+import (
+	"testing"
+
+	"github.com/legamerdc/game/lib"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func vecMockKv() *MockKv {
+	kv := NewMockKv()
+	kv.data["p"] = lib.Vector2(lib.Vec2{X: 0, Y: 0})
+	kv.data["q"] = lib.Vector2(lib.Vec2{X: 3, Y: 4})
+	kv.data["a"] = lib.Vector3(lib.Vec3{X: 1, Y: 2, Z: 2})
+	kv.data["r"] = lib.Float64(2)
+	return kv
+}
+
+func TestVec(t *testing.T) {
+	t.Run("求值", func(t *testing.T) {
+		cases := map[string]lib.Field{
+			"vec2 p, q; dist(p, q)":                        lib.Float64(5),
+			"vec3 a; len(a)":                               lib.Float64(3),
+			"vec2 q; q.x + q.y":                            lib.Float64(7),
+			"vec2 p, q; (q - p).y":                         lib.Float64(4),
+			"vec3 a; a!.z":                                 lib.Float64(2),
+			"vec2 q; float r; q * r":                       lib.Vector2(lib.Vec2{X: 6, Y: 8}),
+			"vec2 q; 2 * q":                                lib.Vector2(lib.Vec2{X: 6, Y: 8}),
+			"vec2 q; q / 2":                                lib.Vector2(lib.Vec2{X: 1.5, Y: 2}),
+			"vec2 q; -q":                                   lib.Vector2(lib.Vec2{X: -3, Y: -4}),
+			"normalize(vec2(0, -5))":                       lib.Vector2(lib.Vec2{X: 0, Y: -1}),
+			"normalize(vec2(0, 0))":                        lib.Vector2(lib.Vec2{}),
+			"dot(vec3(1, 2, 3), vec3(4, 5, 6))":            lib.Float64(32),
+			"angle(vec2(1, 0), vec2(0, 2))":                lib.Float64(90),
+			"angle(vec2(1, 0), vec2(0, 0))":                lib.Float64(0),
+			"vec2 q; q == vec2(3, 4)":                      lib.Bool(true),
+			"vec3 a; a != vec3(1, 2, 2)":                   lib.Bool(false),
+			"let v = vec3(1, 2, 3); v.x + v.y * v.z":       lib.Float64(7),
+			"vec2 p, q; dist(p, q) < 6 ? q.x : p.x":        lib.Float64(3),
+			"vec2 q; int n; vec2(n, 1).y + q.x":            lib.Float64(4),
+			"vec2 p, q; p = q * 2; p.x":                    lib.Float64(6),
+			"vec2 q; float dist, len; dist = len(q); dist": lib.Float64(5),
+		}
+		for code, want := range cases {
+			for _, b := range []Backend{BackendClosure, BackendVM} {
+				f, err := Compile[string, *MockKv](code, s2s, WithBackend(b))
+				require.Nil(t, err, code)
+				v, err := f(vecMockKv())
+				require.Nil(t, err, code)
+				assert.Equal(t, want, v, code)
+			}
+		}
+	})
+
+	t.Run("向量运算不分配", func(t *testing.T) {
+		kv := vecMockKv()
+		f, err := CompileFloat[string, *MockKv]("vec2 p, q; vec3 a; float r; dist(p + q * r, q) + dot(normalize(a), -a * 2) + (q / r - p).y", s2s)
+		require.Nil(t, err)
+		v, err := f(kv)
+		require.Nil(t, err)
+		assert.InDelta(t, 5.0-6.0+2.0, v, 1e-9)
+		assert.Zero(t, testing.AllocsPerRun(100, func() { _, _ = f(kv) }))
+	})
+
+	t.Run("赋值写回", func(t *testing.T) {
+		f, err := Compile[string, *MockKv]("vec2 p, q; vec3 a; p = p + vec2(1, 2) * 2; a = -a", s2s)
+		require.Nil(t, err)
+		kv := vecMockKv()
+		_, err = f(kv)
+		require.Nil(t, err)
+		assert.Equal(t, lib.Vector2(lib.Vec2{X: 2, Y: 4}), kv.data["p"])
+		assert.Equal(t, lib.Vector3(lib.Vec3{X: -1, Y: -2, Z: -2}), kv.data["a"])
+	})
+
+	t.Run("类型化入口", func(t *testing.T) {
+		f, err := CompileFloat[string, *MockKv]("vec2 p, q; dist(p, q) * 2", s2s)
+		require.Nil(t, err)
+		v, err := f(vecMockKv())
+		require.Nil(t, err)
+		assert.Equal(t, 10.0, v)
+
+		g, err := CompileBool[string, *MockKv]("vec2 q; q.x < q.y", s2s)
+		require.Nil(t, err)
+		b, err := g(vecMockKv())
+		require.Nil(t, err)
+		assert.True(t, b)
+	})
+
+	t.Run("注册函数", func(t *testing.T) {
+		fs := DefaultFuncs().MustRegister("perp(vec2) vec2", func(v lib.Vec2) lib.Vec2 {
+			return lib.Vec2{X: -v.Y, Y: v.X}
+		})
+		f, err := Compile[string, *MockKv]("vec2 q; perp(q).x", s2s, WithFuncs(fs))
+		require.Nil(t, err)
+		v, err := f(vecMockKv())
+		require.Nil(t, err)
+		assert.Equal(t, lib.Float64(-4), v)
+		assert.NotNil(t, NewFuncs().Register("len(vec2) float", func(v lib.Vec2) float64 { return 0 }))
+	})
+
+	t.Run("类型错误", func(t *testing.T) {
+		for _, code := range []string{
+			"vec2 p; p.z",
+			"float r; r.x",
+			"vec2 p; vec3 a; p + a",
+			"vec2 p; p * p",
+			"vec2 p; p + 1",
+			"vec2 p; 1 / p",
+			"vec2 p, q; p < q",
+			"vec2 p; !p",
+			"vec2 p; p && true",
+			"vec2 p; vec3 a; p == a",
+			"vec2 p; float r; r = p",
+			"vec2 p; len(1)",
+			"vec2 p; vec3 a; dist(p, a)",
+			"vec2('a', 1)",
+			"vec2 p; p = vec3(1, 2, 3)",
+		} {
+			_, err := Compile[string, *MockKv](code, s2s)
+			assert.NotNil(t, err, code)
+		}
+	})
+
+	t.Run("定点模式", func(t *testing.T) {
+		_, err := Compile[string, *MockKv]("vec2 p; p.x", s2s, WithFixed())
+		assert.ErrorContains(t, err, "vec2 is not supported in fixed-point mode")
+	})
+
+	t.Run("格式化", func(t *testing.T) {
+		cases := map[string]string{
+			"vec2 p,q;(p-q).x*2":       "vec2 p, q; (p - q).x * 2",
+			"vec3 a; a!.z+dist( a,a )": "vec3 a; a!.z + dist(a, a)",
+			"Health.base+vec2(1,2).y":  "Health.base + vec2(1, 2).y",
+			"vec2 p;normalize(p).x":    "vec2 p; normalize(p).x",
+		}
+		for code, want := range cases {
+			got, err := Format(code)
+			require.Nil(t, err, code)
+			assert.Equal(t, want, got, code)
+			again, err := Format(got)
+			require.Nil(t, err, got)
+			assert.Equal(t, got, again, got)
+		}
+	})
+
+	t.Run("追踪", func(t *testing.T) {
+		f, err := CompileTraced[string, *MockKv]("vec2 p, q; (q - p).x", s2s)
+		require.Nil(t, err)
+		_, tr, err := f(vecMockKv())
+		require.Nil(t, err)
+		assert.Equal(t, "(q - p) (=(3, 4)).x → 3", tr.String())
+	})
+}
+
+func BenchmarkVec(b *testing.B) {
+	kv := vecMockKv()
+	f, err := CompileBool[string, *MockKv]("vec2 p, q; vec3 a; float r; dist(p + q * r, q) + dot(normalize(a), -a * 2) < len(q - p) && (q - p).y > 0", s2s)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = f(kv)
+	}
+}
@@ -0,0 +1,756 @@
+package cc
+
+import (
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/legamerdc/game/lib"
+	"github.com/legamerdc/game/tag"
+)
+
+// Backend 选择编译后端
+type Backend int32
+
+const (
+	// BackendClosure 把语法树编译为嵌套闭包，是默认后端
+	BackendClosure Backend = iota
+	// BackendVM 把语法树编译为紧凑的栈式字节码，由一个小型解释器在 lib.Field 上执行。
+	// 字节码是扁平的指令数组，不含嵌套的 func 值，每个节点不再需要一次间接调用。
+	BackendVM
+)
+
+var errVMTooLarge = errors.New("vm: program too large")
+
+// WithBackend 选择编译后端，默认为 BackendClosure
+func WithBackend(b Backend) Option {
+	return func(o *options) {
+		o.backend = b
+	}
+}
+
+type opcode uint8
+
+const (
+	opConst    opcode = iota // push consts[a]
+	opGet                    // push Get(keys[a])，不存在时压入类型 b 的零值
+	opGetMust                // push Get(keys[a])，不存在时报错
+	opSet                    // 把栈顶按类型 b 转换后写入 keys[a]，栈顶保留原值
+	opPop                    // 丢弃栈顶
+	opJmp                    // pc = a
+	opJmpFalse               // 弹出栈顶，为 false 时 pc = a
+	opAnd                    // 栈顶为 false 时保留栈顶并 pc = a，否则弹出
+	opOr                     // 栈顶为 true 时保留栈顶并 pc = a，否则弹出
+	opCall                   // 以栈顶 b 个参数调用 funcs[a]
+	opExec                   // 以栈顶 b 个参数调用 Ctx.Exec(names[a])
+	opLoad                   // push 局部变量槽位 a
+	opStore                  // 把栈顶按类型 b 转换后写入局部变量槽位 a，栈顶保留原值
+	opGetAttr                // push 属性 attrs[a]，读不到时按 x / x! 的规则处理
+	opSetAttr                // 把栈顶写入属性 attrs[a] 的 Base，栈顶保留原值
+
+	opRand    // push Rand().Float64()
+	opRandInt // 以栈顶两个 int 为闭区间取随机整数，按类型 b 装箱
+	opChance  // 栈顶概率替换为本次是否命中
+	opHasTag  // push Tags().HasTag(a)，b 为 1 时使用 HasTagExact
+
+	opNegI
+	opNegF
+	opNot
+
+	opPowI
+	opAddI
+	opSubI
+	opMulI
+	opDivI
+	opModI
+	opEqI
+	opNeI
+	opLtI
+	opLeI
+	opGtI
+	opGeI
+	opMinI
+	opMaxI
+	opAbsI
+	opClampI
+
+	opPowF
+	opAddF
+	opSubF
+	opMulF
+	opDivF
+	opEqF
+	opNeF
+	opLtF
+	opLeF
+	opGtF
+	opGeF
+	opMinF
+	opMaxF
+	opAbsF
+	opClampF
+
+	opEqB
+	opNeB
+
+	opAddS
+	opEqS
+	opNeS
+)
+
+var (
+	intOps = map[string]opcode{
+		"^": opPowI, "+": opAddI, "-": opSubI, "*": opMulI, "/": opDivI, "%": opModI,
+		"==": opEqI, "!=": opNeI, "<": opLtI, "<=": opLeI, ">": opGtI, ">=": opGeI,
+		"min": opMinI, "max": opMaxI, "abs": opAbsI, "clamp": opClampI,
+	}
+	floatOps = map[string]opcode{
+		"^": opPowF, "+": opAddF, "-": opSubF, "*": opMulF, "/": opDivF,
+		"==": opEqF, "!=": opNeF, "<": opLtF, "<=": opLeF, ">": opGtF, ">=": opGeF,
+		"min": opMinF, "max": opMaxF, "abs": opAbsF, "clamp": opClampF,
+	}
+	boolOps   = map[string]opcode{"==": opEqB, "!=": opNeB}
+	stringOps = map[string]opcode{"+": opAddS, "==": opEqS, "!=": opNeS}
+)
+
+// instr 是一条 4 字节的指令：操作码、一个 8 位小操作数（参数个数或类型）和一个 16 位索引。
+type instr struct {
+	op opcode
+	b  uint8
+	a  uint16
+}
+
+type vmProgram[K any, B Ctx[K]] struct {
+	code   []instr
+	consts []lib.Field
+	keys   []K
+	names  []string
+	funcs  []*funcDef
+	attrs  []*Node // 绑定到属性的名字节点
+	at     []*Node // 与 code 一一对应，可能出错的指令所属的节点，用于错误位置
+	locals int     // 栈底的 let 局部变量槽位数
+	stack  int
+	pool   sync.Pool
+}
+
+// vmBuilder 把类型推断后的语法树翻译为字节码
+type vmBuilder struct {
+	code     []instr
+	consts   []lib.Field
+	names    []string
+	nameIdx  map[string]int
+	funcs    []*funcDef
+	attrs    []*Node
+	at       []*Node
+	depth    int
+	maxDepth int
+}
+
+func compileVM[K any, B Ctx[K]](t *tree, k Key[K]) (func(B) (lib.Field, error), error) {
+	vb := &vmBuilder{nameIdx: make(map[string]int)}
+	if e := vb.emitNode(t.root, t.vars); e != nil {
+		return nil, e
+	}
+	if len(vb.code) > 0xFFFF || t.locals > 0xFFFF || len(vb.consts) > 0xFFFF || len(vb.names) > 0xFFFF || len(vb.funcs) > 0xFFFF || len(vb.attrs) > 0xFFFF {
+		return nil, errVMTooLarge
+	}
+	p := &vmProgram[K, B]{
+		code:   vb.code,
+		consts: vb.consts,
+		names:  vb.names,
+		funcs:  vb.funcs,
+		attrs:  vb.attrs,
+		at:     vb.at,
+		locals: t.locals,
+		stack:  t.locals + vb.maxDepth,
+		keys:   make([]K, len(vb.names)),
+	}
+	for i, name := range vb.names {
+		p.keys[i] = k(name)
+	}
+	return p.eval, nil
+}
+
+func (vb *vmBuilder) emit(op opcode, a int, b uint8) int {
+	vb.code = append(vb.code, instr{op: op, a: uint16(a), b: b})
+	vb.at = append(vb.at, nil)
+	return len(vb.code) - 1
+}
+
+func (vb *vmBuilder) patch(at int) {
+	vb.code[at].a = uint16(len(vb.code))
+}
+
+func (vb *vmBuilder) push(x int) {
+	vb.depth += x
+	vb.maxDepth = max(vb.maxDepth, vb.depth)
+}
+
+func (vb *vmBuilder) name(s string) int {
+	if i, ok := vb.nameIdx[s]; ok {
+		return i
+	}
+	vb.names = append(vb.names, s)
+	vb.nameIdx[s] = len(vb.names) - 1
+	return len(vb.names) - 1
+}
+
+func (vb *vmBuilder) emitConst(v lib.Field) {
+	vb.consts = append(vb.consts, v)
+	vb.emit(opConst, len(vb.consts)-1, 0)
+	vb.push(1)
+}
+
+func (vb *vmBuilder) emitNode(n *Node, m map[string]exprType) (e error) {
+	switch n.Type {
+	case NodeProgram, NodeBlock:
+		first := true
+		for _, x := range n.Children {
+			if x.Type == NodeVarDecl {
+				continue
+			}
+			if !first {
+				vb.emit(opPop, 0, 0)
+				vb.push(-1)
+			}
+			first = false
+			if e = vb.emitNode(x, m); e != nil {
+				return e
+			}
+		}
+		// 块作为语句必须留下一个值
+		if first && n.Type == NodeBlock {
+			vb.emitConst(lib.Field{})
+		}
+		return nil
+	case NodeAssign, NodeLet:
+		if e = vb.emitNode(n.Children[0], m); e != nil {
+			return e
+		}
+		if n.local != nil {
+			vb.emit(opStore, n.local.slot, uint8(n.Target))
+		} else if n.attr != nil {
+			vb.attrs = append(vb.attrs, n)
+			vb.emit(opSetAttr, len(vb.attrs)-1, 0)
+		} else {
+			vb.emit(opSet, vb.name(n.Token), uint8(n.Target))
+		}
+		return nil
+	case NodeIf:
+		if e = vb.emitNode(n.Children[0], m); e != nil {
+			return e
+		}
+		jf := vb.emit(opJmpFalse, 0, 0)
+		vb.push(-1)
+		if e = vb.emitNode(n.Children[1], m); e != nil {
+			return e
+		}
+		j := vb.emit(opJmp, 0, 0)
+		vb.push(-1)
+		vb.patch(jf)
+		if len(n.Children) == 3 {
+			if e = vb.emitNode(n.Children[2], m); e != nil {
+				return e
+			}
+		} else if n.Target != exprUnknown {
+			vb.emitConst(_zero(n.Target))
+		} else {
+			vb.emitConst(lib.Field{})
+		}
+		vb.patch(j)
+		return nil
+	case NodeBuiltin:
+		for _, x := range n.Children {
+			if e = vb.emitNode(x, m); e != nil {
+				return e
+			}
+		}
+		if n.tag != nil {
+			var exact uint8
+			if n.tag.exact {
+				exact = 1
+			}
+			vb.emit(opHasTag, int(n.tag.key), exact)
+			vb.push(1)
+			return nil
+		}
+		switch n.Token {
+		case "rand":
+			vb.emit(opRand, 0, 0)
+			vb.push(1)
+			return nil
+		case "randint":
+			vb.emit(opRandInt, 0, uint8(n.Target))
+			vb.push(-1)
+			return nil
+		case "chance":
+			vb.emit(opChance, 0, 0)
+			return nil
+		}
+		ops := intOps
+		if n.Target == exprFloat {
+			ops = floatOps
+		}
+		vb.emit(ops[n.Token], 0, 0)
+		vb.push(1 - len(n.Children))
+		return nil
+	case NodeUnaryOp:
+		if e = vb.emitNode(n.Children[0], m); e != nil {
+			return e
+		}
+		switch n.Token {
+		case "+":
+		case "-":
+			if n.Target == exprFloat {
+				vb.emit(opNegF, 0, 0)
+			} else {
+				vb.emit(opNegI, 0, 0)
+			}
+		case "!":
+			vb.emit(opNot, 0, 0)
+		default:
+			panic("unreachable")
+		}
+		return nil
+	case NodeBinOp:
+		return vb.emitBinary(n, m)
+	case NodeTernary:
+		if e = vb.emitNode(n.Children[0], m); e != nil {
+			return e
+		}
+		jf := vb.emit(opJmpFalse, 0, 0)
+		vb.push(-1)
+		if e = vb.emitNode(n.Children[1], m); e != nil {
+			return e
+		}
+		j := vb.emit(opJmp, 0, 0)
+		vb.push(-1)
+		vb.patch(jf)
+		if e = vb.emitNode(n.Children[2], m); e != nil {
+			return e
+		}
+		vb.patch(j)
+		return nil
+	case NodeIdent, NodeTryIdent:
+		if n.local != nil {
+			vb.emit(opLoad, n.local.slot, 0)
+			vb.push(1)
+			return nil
+		}
+		if n.attr != nil {
+			vb.attrs = append(vb.attrs, n)
+			vb.emit(opGetAttr, len(vb.attrs)-1, 0)
+			vb.push(1)
+			return nil
+		}
+		if n.Type == NodeTryIdent {
+			vb.emit(opGet, vb.name(n.Token), uint8(m[n.Token]))
+			vb.push(1)
+			return nil
+		}
+		vb.at[vb.emit(opGetMust, vb.name(n.Token), 0)] = n
+		vb.push(1)
+		return nil
+	case NodeFunc:
+		if len(n.Children) > 0xFF {
+			return errVMTooLarge
+		}
+		for _, x := range n.Children {
+			if e = vb.emitNode(x, m); e != nil {
+				return e
+			}
+		}
+		if n.def != nil {
+			vb.funcs = append(vb.funcs, n.def)
+			vb.emit(opCall, len(vb.funcs)-1, uint8(len(n.Children)))
+		} else {
+			vb.at[vb.emit(opExec, vb.name(n.Token), uint8(len(n.Children)))] = n
+		}
+		vb.push(1 - len(n.Children))
+		return nil
+	case NodeNumber:
+		v, e := _number(n)
+		if e != nil {
+			return e
+		}
+		vb.emitConst(v)
+		return nil
+	case NodeBool:
+		v, e := _bool(n)
+		if e != nil {
+			return e
+		}
+		vb.emitConst(v)
+		return nil
+	case NodeString:
+		vb.emitConst(lib.String(n.Token))
+		return nil
+	default:
+	}
+	panic("unreachable")
+}
+
+func (vb *vmBuilder) emitBinary(n *Node, m map[string]exprType) error {
+	if e := vb.emitNode(n.Children[0], m); e != nil {
+		return e
+	}
+	switch n.Token {
+	case "&&", "||":
+		op := opAnd
+		if n.Token == "||" {
+			op = opOr
+		}
+		j := vb.emit(op, 0, 0)
+		vb.push(-1)
+		if e := vb.emitNode(n.Children[1], m); e != nil {
+			return e
+		}
+		vb.patch(j)
+		return nil
+	}
+	if e := vb.emitNode(n.Children[1], m); e != nil {
+		return e
+	}
+	var ops map[string]opcode
+	switch n.Children[0].Target {
+	case exprString:
+		ops = stringOps
+	case exprBool:
+		ops = boolOps
+	case exprInt:
+		ops = intOps
+	case exprFloat:
+		ops = floatOps
+	}
+	op, ok := ops[n.Token]
+	if !ok {
+		panic("unreachable")
+	}
+	vb.emit(op, 0, 0)
+	vb.push(-1)
+	return nil
+}
+
+// vmStackSize 以内的栈直接分配在 Go 栈上，更深的程序使用 sync.Pool 复用
+const vmStackSize = 16
+
+func (p *vmProgram[K, B]) eval(b B) (lib.Field, error) {
+	if p.stack <= vmStackSize {
+		var st [vmStackSize]lib.Field
+		return p.run(b, st[:])
+	}
+	st, _ := p.pool.Get().(*[]lib.Field)
+	if st == nil {
+		s := make([]lib.Field, p.stack)
+		st = &s
+	}
+	v, e := p.run(b, *st)
+	clear(*st) // 不让池中的栈引用上一次求值的字符串和函数结果
+	p.pool.Put(st)
+	return v, e
+}
+
+func (p *vmProgram[K, B]) getAttr(b B, n *Node) (x float64, e error) {
+	var ok bool
+	if n.attr.base {
+		x, ok = _attrs(b).GetBase(n.attr.key)
+	} else {
+		x, ok = _attrs(b).GetCurrent(n.attr.key)
+	}
+	if !ok && n.Type == NodeIdent {
+		return 0, n.errorf(fmtAttrMiss, n.Token)
+	}
+	return x, nil
+}
+
+func (p *vmProgram[K, B]) run(b B, st []lib.Field) (lib.Field, error) {
+	sp := p.locals
+	code := p.code
+	for pc := 0; pc < len(code); pc++ {
+		in := code[pc]
+		switch in.op {
+		case opConst:
+			st[sp] = p.consts[in.a]
+			sp++
+		case opGet:
+			v, ok := b.Get(p.keys[in.a])
+			if !ok {
+				v = _zero(exprType(in.b))
+			}
+			st[sp] = v
+			sp++
+		case opGetMust:
+			v, ok := b.Get(p.keys[in.a])
+			if !ok {
+				return lib.Field{}, p.at[pc].errorf(fmtKeyMiss, p.names[in.a])
+			}
+			st[sp] = v
+			sp++
+		case opSet:
+			b.Set(p.keys[in.a], _convert(st[sp-1], exprType(in.b)))
+		case opGetAttr:
+			x, e := p.getAttr(b, p.attrs[in.a])
+			if e != nil {
+				return lib.Field{}, e
+			}
+			st[sp] = lib.Float64(x)
+			sp++
+		case opSetAttr:
+			n := p.attrs[in.a]
+			x, _ := st[sp-1].Float64()
+			if !_attrs(b).SetBase(n.attr.key, x) {
+				return lib.Field{}, n.errorf(fmtAttrMiss, n.Token)
+			}
+		case opPop:
+			sp--
+		case opJmp:
+			pc = int(in.a) - 1
+		case opJmpFalse:
+			sp--
+			if c, _ := st[sp].Bool(); !c {
+				pc = int(in.a) - 1
+			}
+		case opAnd:
+			if c, _ := st[sp-1].Bool(); !c {
+				pc = int(in.a) - 1
+			} else {
+				sp--
+			}
+		case opOr:
+			if c, _ := st[sp-1].Bool(); c {
+				pc = int(in.a) - 1
+			} else {
+				sp--
+			}
+		case opCall:
+			argc := int(in.b)
+			v := p.funcs[in.a].invoke(st[sp-argc : sp])
+			sp -= argc
+			st[sp] = v
+			sp++
+		case opExec:
+			// Exec 可能持有参数切片，这里复制一份，使栈本身不逃逸
+			argc := int(in.b)
+			args := make([]lib.Field, argc)
+			copy(args, st[sp-argc:sp])
+			v, ok := b.Exec(p.names[in.a], args...)
+			if !ok {
+				return lib.Field{}, p.at[pc].errorf(fmtIllFunc, p.names[in.a])
+			}
+			sp -= argc
+			st[sp] = v
+			sp++
+		case opLoad:
+			st[sp] = st[in.a]
+			sp++
+		case opStore:
+			st[in.a] = _convert(st[sp-1], exprType(in.b))
+		case opRand:
+			st[sp] = lib.Float64(_rand(b).Float64())
+			sp++
+		case opRandInt:
+			sp--
+			lo, _ := st[sp-1].Int64()
+			hi, _ := st[sp].Int64()
+			st[sp-1] = _randField(_randint(_rand(b), lo, hi), exprType(in.b))
+		case opChance:
+			p, _ := st[sp-1].Float64()
+			st[sp-1] = lib.Bool(_rand(b).Float64() < p)
+		case opHasTag:
+			t := any(b).(TagCtx).Tags()
+			if in.b == 1 {
+				st[sp] = lib.Bool(t != nil && t.HasTagExact(tag.Key(in.a)))
+			} else {
+				st[sp] = lib.Bool(t != nil && t.HasTag(tag.Key(in.a)))
+			}
+			sp++
+		case opNegI:
+			x, _ := st[sp-1].Int64()
+			st[sp-1] = lib.Int64(-x)
+		case opNegF:
+			x, _ := st[sp-1].Float64()
+			st[sp-1] = lib.Float64(-x)
+		case opNot:
+			x, _ := st[sp-1].Bool()
+			st[sp-1] = lib.Bool(!x)
+		case opPowI:
+			sp--
+			x, y := _ints(st, sp)
+			st[sp-1] = lib.Int64(_ipower(x, y))
+		case opAddI:
+			sp--
+			x, y := _ints(st, sp)
+			st[sp-1] = lib.Int64(x + y)
+		case opSubI:
+			sp--
+			x, y := _ints(st, sp)
+			st[sp-1] = lib.Int64(x - y)
+		case opMulI:
+			sp--
+			x, y := _ints(st, sp)
+			st[sp-1] = lib.Int64(x * y)
+		case opDivI:
+			sp--
+			x, y := _ints(st, sp)
+			st[sp-1] = lib.Int64(x / y)
+		case opModI:
+			sp--
+			x, y := _ints(st, sp)
+			st[sp-1] = lib.Int64(x % y)
+		case opEqI:
+			sp--
+			x, y := _ints(st, sp)
+			st[sp-1] = lib.Bool(x == y)
+		case opNeI:
+			sp--
+			x, y := _ints(st, sp)
+			st[sp-1] = lib.Bool(x != y)
+		case opLtI:
+			sp--
+			x, y := _ints(st, sp)
+			st[sp-1] = lib.Bool(x < y)
+		case opLeI:
+			sp--
+			x, y := _ints(st, sp)
+			st[sp-1] = lib.Bool(x <= y)
+		case opGtI:
+			sp--
+			x, y := _ints(st, sp)
+			st[sp-1] = lib.Bool(x > y)
+		case opGeI:
+			sp--
+			x, y := _ints(st, sp)
+			st[sp-1] = lib.Bool(x >= y)
+		case opMinI:
+			sp--
+			x, y := _ints(st, sp)
+			st[sp-1] = lib.Int64(min(x, y))
+		case opMaxI:
+			sp--
+			x, y := _ints(st, sp)
+			st[sp-1] = lib.Int64(max(x, y))
+		case opAbsI:
+			x, _ := st[sp-1].Int64()
+			st[sp-1] = lib.Int64(_iabs(x))
+		case opClampI:
+			sp -= 2
+			x, lo := _ints(st, sp)
+			hi, _ := st[sp+1].Int64()
+			st[sp-1] = lib.Int64(min(max(x, lo), hi))
+		case opPowF:
+			sp--
+			x, y := _floats(st, sp)
+			st[sp-1] = lib.Float64(math.Pow(x, y))
+		case opAddF:
+			sp--
+			x, y := _floats(st, sp)
+			st[sp-1] = lib.Float64(x + y)
+		case opSubF:
+			sp--
+			x, y := _floats(st, sp)
+			st[sp-1] = lib.Float64(x - y)
+		case opMulF:
+			sp--
+			x, y := _floats(st, sp)
+			st[sp-1] = lib.Float64(x * y)
+		case opDivF:
+			sp--
+			x, y := _floats(st, sp)
+			st[sp-1] = lib.Float64(x / y)
+		case opEqF:
+			sp--
+			x, y := _floats(st, sp)
+			st[sp-1] = lib.Bool(x == y)
+		case opNeF:
+			sp--
+			x, y := _floats(st, sp)
+			st[sp-1] = lib.Bool(x != y)
+		case opLtF:
+			sp--
+			x, y := _floats(st, sp)
+			st[sp-1] = lib.Bool(x < y)
+		case opLeF:
+			sp--
+			x, y := _floats(st, sp)
+			st[sp-1] = lib.Bool(x <= y)
+		case opGtF:
+			sp--
+			x, y := _floats(st, sp)
+			st[sp-1] = lib.Bool(x > y)
+		case opGeF:
+			sp--
+			x, y := _floats(st, sp)
+			st[sp-1] = lib.Bool(x >= y)
+		case opMinF:
+			sp--
+			x, y := _floats(st, sp)
+			st[sp-1] = lib.Float64(math.Min(x, y))
+		case opMaxF:
+			sp--
+			x, y := _floats(st, sp)
+			st[sp-1] = lib.Float64(math.Max(x, y))
+		case opAbsF:
+			x, _ := st[sp-1].Float64()
+			st[sp-1] = lib.Float64(math.Abs(x))
+		case opClampF:
+			sp -= 2
+			x, lo := _floats(st, sp)
+			hi, _ := st[sp+1].Float64()
+			st[sp-1] = lib.Float64(math.Min(math.Max(x, lo), hi))
+		case opEqB, opNeB:
+			sp--
+			x, _ := st[sp-1].Bool()
+			y, _ := st[sp].Bool()
+			st[sp-1] = lib.Bool((x == y) == (in.op == opEqB))
+		case opAddS, opEqS, opNeS:
+			sp--
+			x, _ := st[sp-1].Str()
+			y, _ := st[sp].Str()
+			switch in.op {
+			case opAddS:
+				st[sp-1] = lib.String(x + y)
+			case opEqS:
+				st[sp-1] = lib.Bool(x == y)
+			default:
+				st[sp-1] = lib.Bool(x != y)
+			}
+		default:
+			panic("unreachable")
+		}
+	}
+	if sp == p.locals {
+		return lib.Field{}, nil
+	}
+	return st[sp-1], nil
+}
+
+// _ints 读取栈上 sp-1、sp 两个操作数
+func _ints(st []lib.Field, sp int) (int64, int64) {
+	x, _ := st[sp-1].Int64()
+	y, _ := st[sp].Int64()
+	return x, y
+}
+
+func _floats(st []lib.Field, sp int) (float64, float64) {
+	x, _ := st[sp-1].Float64()
+	y, _ := st[sp].Float64()
+	return x, y
+}
+
+// _convert 把 v 转换为类型 t 的 Field，语义与闭包后端赋值时的转换一致
+func _convert(v lib.Field, t exprType) lib.Field {
+	switch t {
+	case exprInt:
+		x, _ := v.Int64()
+		return lib.Int64(x)
+	case exprFloat:
+		x, _ := v.Float64()
+		return lib.Float64(x)
+	case exprBool:
+		x, _ := v.Bool()
+		return lib.Bool(x)
+	case exprString:
+		return v
+	}
+	panic("unreachable")
+}
@@ -0,0 +1,133 @@
+package cc
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/legamerdc/game/lib"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVMCorpus(t *testing.T) {
+	runCorpus(t, func(code string) (func(*MockKv) (lib.Field, error), error) {
+		return Compile[string, *MockKv](code, s2s, WithBackend(BackendVM))
+	})
+}
+
+func TestVM(t *testing.T) {
+	t.Run("只有声明的程序", func(t *testing.T) {
+		f, err := Compile[string, *MockKv]("int x, y", s2s, WithBackend(BackendVM))
+		assert.Nil(t, err)
+		v, err := f(NewMockKv())
+		assert.Nil(t, err)
+		assert.Equal(t, lib.Field{}, v)
+	})
+
+	t.Run("短路求值不执行右侧", func(t *testing.T) {
+		f, err := Compile[string, *MockKv]("int x; bool t; t || x! > 0", s2s, WithBackend(BackendVM))
+		assert.Nil(t, err)
+		kv := NewMockKv()
+		kv.SetBool("t", true)
+		v, err := f(kv)
+		assert.Nil(t, err)
+		bv, _ := v.Bool()
+		assert.True(t, bv)
+
+		kv.SetBool("t", false)
+		_, err = f(kv)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("错误在第一处停止", func(t *testing.T) {
+		f, err := Compile[string, *MockKv]("int x, y; y = x!; y = 3", s2s, WithBackend(BackendVM))
+		assert.Nil(t, err)
+		kv := NewMockKv()
+		_, err = f(kv)
+		assert.NotNil(t, err)
+		_, exists := kv.Get("y")
+		assert.False(t, exists)
+	})
+
+	t.Run("编译错误与闭包后端一致", func(t *testing.T) {
+		_, err := Compile[string, *MockKv]("bool a; int b; a + b", s2s, WithBackend(BackendVM))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("深层嵌套", func(t *testing.T) {
+		code := "int x; "
+		for i := 0; i < 50; i++ {
+			code += "(x + "
+		}
+		code += "1"
+		for i := 0; i < 50; i++ {
+			code += ")"
+		}
+		f, err := Compile[string, *MockKv](code, s2s, WithBackend(BackendVM))
+		assert.Nil(t, err)
+		kv := NewMockKv()
+		kv.SetInt64("x", 2)
+		v, err := f(kv)
+		assert.Nil(t, err)
+		iv, _ := v.Int64()
+		assert.Equal(t, int64(101), iv)
+	})
+}
+
+var benchBackends = []struct {
+	name string
+	code string
+	kv   map[string]lib.Field
+}{
+	{
+		name: "Power",
+		code: "float power, power_x, power_y; power = power_x * 0.95 + power_y * 1.25; power > 3000",
+		kv:   map[string]lib.Field{"power_x": lib.Int64(3000), "power_y": lib.Int64(3000)},
+	},
+	{
+		name: "Guard",
+		code: "float hp, hp_max, dist; (hp / hp_max > 0.35) && dist < 190",
+		kv:   map[string]lib.Field{"hp": lib.Float64(80), "hp_max": lib.Float64(100), "dist": lib.Float64(150)},
+	},
+	{
+		name: "DeepNesting",
+		code: "int x1, x2, x3, x4, x5, x6, x7, x8, x9, x10; ((x1 + x2) * (x3 - x4)) + ((x5 * x6) / (x7 + x8)) - ((x9 ^ x10) % (x1 + x5))",
+		kv: func() map[string]lib.Field {
+			m := make(map[string]lib.Field)
+			for i := 1; i <= 10; i++ {
+				m[fmt.Sprintf("x%d", i)] = lib.Int64(int64(i))
+			}
+			return m
+		}(),
+	},
+	{
+		name: "Func",
+		code: "float x, y; clamp(sqrt(x * x + y * y), 0, 10) > 4",
+		kv:   map[string]lib.Field{"x": lib.Float64(3), "y": lib.Float64(4)},
+	},
+}
+
+func BenchmarkBackend(b *testing.B) {
+	backends := []struct {
+		name    string
+		backend Backend
+	}{{"Closure", BackendClosure}, {"VM", BackendVM}}
+	for _, c := range benchBackends {
+		kv := NewMockKv()
+		for k, v := range c.kv {
+			kv.Set(k, v)
+		}
+		for _, be := range backends {
+			f, err := Compile[string, *MockKv](c.code, s2s, WithBackend(be.backend))
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Run(c.name+"/"+be.name, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					_, _ = f(kv)
+				}
+			})
+		}
+	}
+}
@@ -3,15 +3,17 @@
 //line g.y:2
 package cc
 
+import __yyfmt__ "fmt"
+
+//line g.y:2
+
 import (
 	"fmt"
-	__yyfmt__ "fmt"
 	"strconv"
+	"strings"
 )
 
 // 语法树节点类型
-//
-//line g.y:2
 type NodeType int
 
 const (
@@ -27,6 +29,12 @@ const (
 	NodeFunc
 	NodeNumber
 	NodeBool
+	NodeString
+	NodeBlock
+	NodeIf
+	NodeLet
+	NodeBuiltin
+	NodeMember // 向量分量 v.x，Token 为分量名
 )
 
 // 语法树节点
@@ -35,52 +43,87 @@ type Node struct {
 	Target   exprType
 	Token    string
 	Children []*Node
+	Pos, End int // 节点在源码中的字节区间 [Pos, End)
+
+	def   *funcDef // 类型推断阶段解析出的注册函数，nil 表示走 Ctx.Exec
+	local *local   // 名字解析到的 let 局部变量，nil 表示黑板变量
+	attr  *attrRef // 名字解析到的属性，见 WithAttrs
+	tag   *tagRef  // has_tag 解析到的标签，见 WithTags
+	probe any      // 追踪求值时替代子节点的已编译闭包，见 CompileTraced
+	safe  bool     // 求值时检查除以零、溢出等运行时错误，见 WithSafe
 }
 
 // 注意：不再使用全局变量，改为在 lexer 实例中存储结果
 
-//line g.y:37
+//line g.y:52
 type yySymType struct {
 	yys  int
 	node *Node
 	str  string
 	num  float64
 	bool bool
+	pos  int // 记号在源码中的起始字节偏移
+	end  int // 记号结束的字节偏移
 }
 
 const IDENT = 57346
 const NUMBER = 57347
 const BOOLEAN = 57348
-const INT = 57349
-const FLOAT = 57350
-const BOOL = 57351
-const TRUE = 57352
-const FALSE = 57353
-const ASSIGN = 57354
-const SEMICOLON = 57355
-const COMMA = 57356
-const LPAREN = 57357
-const RPAREN = 57358
-const QUESTION = 57359
-const COLON = 57360
-const PLUS = 57361
-const MINUS = 57362
-const MULTIPLY = 57363
-const DIVIDE = 57364
-const MOD = 57365
-const POWER = 57366
-const AND = 57367
-const OR = 57368
-const NOT = 57369
-const LT = 57370
-const LE = 57371
-const GT = 57372
-const GE = 57373
-const EQ = 57374
-const NE = 57375
-const DOLLAR = 57376
-const UMINUS = 57377
-const UPLUS = 57378
+const STRING_LIT = 57349
+const INT = 57350
+const FLOAT = 57351
+const BOOL = 57352
+const STRING = 57353
+const TRUE = 57354
+const FALSE = 57355
+const ASSIGN = 57356
+const SEMICOLON = 57357
+const COMMA = 57358
+const LPAREN = 57359
+const RPAREN = 57360
+const QUESTION = 57361
+const COLON = 57362
+const PLUS = 57363
+const MINUS = 57364
+const MULTIPLY = 57365
+const DIVIDE = 57366
+const MOD = 57367
+const POWER = 57368
+const AND = 57369
+const OR = 57370
+const NOT = 57371
+const LT = 57372
+const LE = 57373
+const GT = 57374
+const GE = 57375
+const EQ = 57376
+const NE = 57377
+const DOLLAR = 57378
+const LBRACE = 57379
+const RBRACE = 57380
+const IF = 57381
+const ELSE = 57382
+const LET = 57383
+const MIN = 57384
+const MAX = 57385
+const CLAMP = 57386
+const ABS = 57387
+const RAND = 57388
+const RANDINT = 57389
+const CHANCE = 57390
+const HAS_TAG = 57391
+const HAS_TAG_EXACT = 57392
+const VEC2 = 57393
+const VEC3 = 57394
+const DIST = 57395
+const LEN = 57396
+const DOT = 57397
+const NORMALIZE = 57398
+const ANGLE = 57399
+const PERIOD = 57400
+const LOWER_THAN_ELSE = 57401
+const UMINUS = 57402
+const UPLUS = 57403
 
 var yyToknames = [...]string{
 	"$end",
@@ -89,9 +132,11 @@ var yyToknames = [...]string{
 	"IDENT",
 	"NUMBER",
 	"BOOLEAN",
+	"STRING_LIT",
 	"INT",
 	"FLOAT",
 	"BOOL",
+	"STRING",
 	"TRUE",
 	"FALSE",
 	"ASSIGN",
@@ -117,6 +162,29 @@ var yyToknames = [...]string{
 	"EQ",
 	"NE",
 	"DOLLAR",
+	"LBRACE",
+	"RBRACE",
+	"IF",
+	"ELSE",
+	"LET",
+	"MIN",
+	"MAX",
+	"CLAMP",
+	"ABS",
+	"RAND",
+	"RANDINT",
+	"CHANCE",
+	"HAS_TAG",
+	"HAS_TAG_EXACT",
+	"VEC2",
+	"VEC3",
+	"DIST",
+	"LEN",
+	"DOT",
+	"NORMALIZE",
+	"ANGLE",
+	"PERIOD",
+	"LOWER_THAN_ELSE",
 	"UMINUS",
 	"UPLUS",
 }
@@ -127,7 +195,7 @@ const yyEofCode = 1
 const yyErrCode = 2
 const yyInitialStackSize = 16
 
-//line g.y:447
+//line g.y:739
 
 // 词法分析器接口
 type Lexer interface {
@@ -139,6 +207,7 @@ type Lexer interface {
 type SimpleLexer struct {
 	input  string
 	pos    int
+	start  int // 当前记号的起始位置
 	line   int
 	result *Node // 存储解析结果，替代全局变量
 	e      error // 存储编译过程中遇到的错误
@@ -148,11 +217,23 @@ func NewLexer(input string) *SimpleLexer {
 	return &SimpleLexer{input: input, pos: 0, line: 1}
 }
 
+// Error 记录第一个错误，位置是出错的记号
 func (l *SimpleLexer) Error(s string) {
-	l.e = fmt.Errorf("parse fail line:%d pos:%d error:%s", l.line, l.pos, s)
+	if l.e != nil {
+		return
+	}
+	end := min(max(l.pos, l.start+1), len(l.input))
+	l.e = &Error{Pos: min(l.start, end), End: end, Err: fmt.Errorf("parse fail line:%d pos:%d error:%s", l.line, l.pos, s)}
 }
 
+// Lex 返回下一个记号，并在 lval 中记录记号的字节区间
 func (l *SimpleLexer) Lex(lval *yySymType) int {
+	t := l.lex(lval)
+	lval.pos, lval.end = l.start, l.pos
+	return t
+}
+
+func (l *SimpleLexer) lex(lval *yySymType) int {
 	for l.pos < len(l.input) {
 		ch := l.input[l.pos]
 
@@ -167,6 +248,7 @@ func (l *SimpleLexer) Lex(lval *yySymType) int {
 			l.pos++
 			continue
 		}
+		l.start = l.pos
 
 		// 识别各种token
 		switch ch {
@@ -186,6 +268,12 @@ func (l *SimpleLexer) Lex(lval *yySymType) int {
 		case ')':
 			l.pos++
 			return RPAREN
+		case '{':
+			l.pos++
+			return LBRACE
+		case '}':
+			l.pos++
+			return RBRACE
 		case '+':
 			l.pos++
 			return PLUS
@@ -216,6 +304,8 @@ func (l *SimpleLexer) Lex(lval *yySymType) int {
 		case '$':
 			l.pos++
 			return DOLLAR
+		case '"', '\'':
+			return l.lexString(lval)
 		case '!':
 			if l.pos+1 < len(l.input) && l.input[l.pos+1] == '=' {
 				l.pos += 2
@@ -257,6 +347,12 @@ func (l *SimpleLexer) Lex(lval *yySymType) int {
 			continue
 		}
 
+		// . 后紧跟名字是分量访问，如 (a - b).x
+		if ch == '.' && l.pos+1 < len(l.input) && isIdentStart(l.input[l.pos+1]) {
+			l.pos++
+			return PERIOD
+		}
+
 		// 识别数字（包括以点开头的小数）
 		if (ch >= '0' && ch <= '9') ||
 			(ch == '.' && l.pos+1 < len(l.input) && l.input[l.pos+1] >= '0' && l.input[l.pos+1] <= '9') {
@@ -272,6 +368,7 @@ func (l *SimpleLexer) Lex(lval *yySymType) int {
 		l.Error(fmt.Sprintf("unexpected character '%c' at position %d", ch, l.pos))
 		l.pos++
 	}
+	l.start = l.pos
 	return 0 // EOF
 }
 
@@ -301,7 +398,7 @@ func (l *SimpleLexer) lexNumber(lval *yySymType) int {
 		l.pos = start + 1
 		l.Error(fmt.Sprintf("invalid number format '%s' at position %d",
 			l.input[start:l.pos], start))
-		return l.Lex(lval) // 递归调用继续处理
+		return l.lex(lval) // 递归调用继续处理
 	}
 
 	if _, err := strconv.ParseFloat(numStr, 64); err == nil {
@@ -312,7 +409,42 @@ func (l *SimpleLexer) lexNumber(lval *yySymType) int {
 	// 如果数字格式无效，回退并报错
 	l.pos = start + 1
 	l.Error(fmt.Sprintf("invalid number format '%s' at position %d", numStr, start))
-	return l.Lex(lval) // 递归调用继续处理
+	return l.lex(lval) // 递归调用继续处理
+}
+
+// lexString 识别单引号或双引号包围的字符串字面量，支持 \\ \" \' \n \t 转义
+func (l *SimpleLexer) lexString(lval *yySymType) int {
+	start := l.pos
+	quote := l.input[l.pos]
+	l.pos++
+	var sb strings.Builder
+	for l.pos < len(l.input) {
+		ch := l.input[l.pos]
+		switch {
+		case ch == quote:
+			l.pos++
+			lval.str = sb.String()
+			return STRING_LIT
+		case ch == '\\' && l.pos+1 < len(l.input):
+			switch esc := l.input[l.pos+1]; esc {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case '\\', '"', '\'':
+				sb.WriteByte(esc)
+			default:
+				l.Error(fmt.Sprintf("invalid escape '\\%c' at position %d", esc, l.pos))
+			}
+			l.pos += 2
+		default:
+			sb.WriteByte(ch)
+			l.pos++
+		}
+	}
+	// 未闭合的字符串，报告错误后把剩余输入视为结束
+	l.Error(fmt.Sprintf("unterminated string at position %d", start))
+	return 0
 }
 
 func (l *SimpleLexer) lexIdent(lval *yySymType) int {
@@ -328,9 +460,22 @@ func (l *SimpleLexer) lexIdent(lval *yySymType) int {
 		}
 	}
 
+	// 标识符后紧跟的 .name 是标识符的一部分，如 Health.base
+	for l.pos+1 < len(l.input) && l.input[l.pos] == '.' && isIdentStart(l.input[l.pos+1]) {
+		l.pos += 2
+		for l.pos < len(l.input) && (isIdentStart(l.input[l.pos]) || (l.input[l.pos] >= '0' && l.input[l.pos] <= '9')) {
+			l.pos++
+		}
+	}
+
 	ident := l.input[start:l.pos]
 	lval.str = ident
 
+	// 函数形式的内置运算只在调用时是关键字，min、rand、has_tag、dist 等仍可以作为变量名
+	if builtinOps[ident] && ident != "vec2" && ident != "vec3" && !l.callFollows() {
+		return IDENT
+	}
+
 	// 检查关键字
 	switch ident {
 	case "int":
@@ -339,6 +484,46 @@ func (l *SimpleLexer) lexIdent(lval *yySymType) int {
 		return FLOAT
 	case "bool":
 		return BOOL
+	case "string":
+		return STRING
+	case "if":
+		return IF
+	case "else":
+		return ELSE
+	case "let":
+		return LET
+	case "min":
+		return MIN
+	case "max":
+		return MAX
+	case "clamp":
+		return CLAMP
+	case "abs":
+		return ABS
+	case "rand":
+		return RAND
+	case "randint":
+		return RANDINT
+	case "chance":
+		return CHANCE
+	case "has_tag":
+		return HAS_TAG
+	case "has_tag_exact":
+		return HAS_TAG_EXACT
+	case "vec2":
+		return VEC2
+	case "vec3":
+		return VEC3
+	case "dist":
+		return DIST
+	case "len":
+		return LEN
+	case "dot":
+		return DOT
+	case "normalize":
+		return NORMALIZE
+	case "angle":
+		return ANGLE
 	case "true":
 		lval.bool = true
 		return TRUE
@@ -350,11 +535,43 @@ func (l *SimpleLexer) lexIdent(lval *yySymType) int {
 	}
 }
 
+// _member 把 v.x 形式的标识符拆为对变量 v 的分量访问，v! 的强制读取作用于 v。
+// 属性名中的 .base 等后缀不是分量名，保持不变。
+func _member(n *Node) *Node {
+	i := strings.LastIndexByte(n.Token, '.')
+	if i < 0 || !vecComponents[n.Token[i+1:]] {
+		return n
+	}
+	v := &Node{Type: n.Type, Pos: n.Pos, End: n.Pos + i, Token: n.Token[:i]}
+	return &Node{Type: NodeMember, Pos: n.Pos, End: n.End, Token: n.Token[i+1:], Children: []*Node{_member(v)}}
+}
+
+// callFollows 判断跳过空白后的下一个字符是否为 (
+func (l *SimpleLexer) callFollows() bool {
+	for i := l.pos; i < len(l.input); i++ {
+		switch l.input[i] {
+		case ' ', '\t', '\n', '\r':
+			continue
+		case '(':
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+func isIdentStart(ch byte) bool {
+	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || ch == '_'
+}
+
 // 解析函数
 func parse(input string) (*Node, error) {
 	lexer := NewLexer(input)
 	if yyParse(lexer) != 0 {
-		return nil, fmt.Errorf("fail: %v", lexer.e)
+		return nil, fmt.Errorf("fail: %w", lexer.e)
+	}
+	if lexer.e != nil {
+		return nil, fmt.Errorf("fail: %w", lexer.e)
 	}
 	return lexer.result, nil
 }
@@ -368,79 +585,136 @@ var yyExca = [...]int8{
 
 const yyPrivate = 57344
 
-const yyLast = 102
-
-var yyAct = [...]int8{
-	6, 9, 19, 17, 15, 35, 14, 34, 18, 38,
-	39, 51, 25, 49, 36, 37, 16, 26, 27, 33,
-	44, 45, 28, 58, 80, 56, 22, 23, 76, 54,
-	3, 29, 77, 57, 24, 60, 61, 40, 41, 42,
-	43, 31, 63, 62, 66, 67, 68, 69, 7, 72,
-	73, 74, 75, 70, 71, 64, 65, 59, 8, 25,
-	55, 10, 11, 12, 26, 27, 20, 21, 13, 28,
-	5, 30, 32, 22, 23, 34, 4, 51, 25, 2,
-	81, 24, 82, 26, 27, 1, 0, 33, 28, 50,
-	52, 53, 22, 23, 0, 46, 47, 48, 0, 79,
-	24, 78,
+const yyLast = 280
+
+var yyAct = [...]uint8{
+	13, 7, 162, 2, 79, 163, 17, 9, 188, 175,
+	163, 69, 70, 71, 72, 58, 60, 31, 60, 26,
+	29, 67, 68, 66, 78, 30, 73, 74, 59, 148,
+	59, 192, 15, 50, 191, 51, 18, 19, 20, 21,
+	52, 53, 28, 6, 25, 54, 181, 185, 27, 33,
+	34, 80, 84, 85, 184, 100, 101, 35, 144, 103,
+	143, 106, 183, 108, 109, 110, 182, 9, 180, 16,
+	37, 38, 39, 36, 40, 41, 42, 43, 44, 22,
+	23, 45, 48, 46, 49, 47, 112, 126, 127, 128,
+	129, 179, 131, 132, 119, 120, 135, 136, 137, 138,
+	139, 121, 122, 123, 124, 75, 76, 77, 145, 64,
+	111, 177, 115, 116, 117, 118, 113, 114, 65, 161,
+	160, 156, 155, 154, 149, 141, 140, 130, 63, 62,
+	99, 98, 97, 96, 95, 94, 93, 92, 91, 90,
+	89, 88, 87, 86, 55, 164, 178, 165, 166, 159,
+	158, 168, 169, 170, 171, 167, 157, 153, 172, 173,
+	174, 152, 151, 150, 147, 146, 102, 176, 5, 107,
+	134, 133, 81, 50, 142, 51, 125, 187, 186, 189,
+	52, 53, 190, 61, 57, 54, 104, 14, 105, 33,
+	34, 32, 24, 11, 56, 10, 12, 35, 8, 4,
+	3, 1, 0, 0, 0, 0, 0, 0, 0, 0,
+	37, 38, 39, 36, 40, 41, 42, 43, 44, 82,
+	83, 45, 48, 46, 49, 47, 81, 50, 0, 51,
+	0, 0, 0, 0, 52, 53, 0, 0, 0, 54,
+	0, 0, 0, 33, 34, 0, 0, 0, 0, 0,
+	0, 35, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 37, 38, 39, 36, 40, 41,
+	42, 43, 44, 82, 83, 45, 48, 46, 49, 47,
 }
 
 var yyPact = [...]int16{
-	54, -1000, 18, -1000, -1000, -1000, -1000, 37, 60, -1000,
-	-1000, -1000, -1000, -12, -10, -23, 9, 1, 74, -1000,
-	-11, -1000, 73, 73, 73, -1000, -1000, -1000, 73, 54,
-	11, -1000, 73, -1000, 7, 73, 73, 73, 73, 73,
-	73, 73, 73, 73, 73, 73, 73, 73, 73, 73,
-	-1000, -8, -1000, -1000, 12, -1000, 28, -1000, -1000, 85,
-	-1000, 6, -10, -23, 9, 9, 1, 1, 1, 1,
-	74, 74, -1000, -1000, -1000, -1000, -1000, -1000, -1000, 73,
-	73, -1000, -1000,
+	-32768, -32768, -32768, 153, 28, -32768, -32768, -32768, -32768, 127,
+	-32768, -32768, -32768, -32768, 180, 1, 179, -32768, -32768, -32768,
+	-32768, -32768, 112, 111, 90, -4, -13, -19, 5, 82,
+	-32768, -2, -54, 222, 222, 222, 126, 125, 124, 123,
+	122, 121, 120, 119, 118, 117, 116, 115, 114, 113,
+	-32768, -32768, -32768, -32768, 222, 222, 150, -32768, 222, -32768,
+	168, 155, 222, 222, 222, 222, 222, 222, 222, 222,
+	222, 222, 222, 222, 222, 222, 222, 222, 222, 172,
+	-32768, -1, 112, 111, -32768, -32768, 222, 222, 222, 222,
+	109, 222, 222, 164, 163, 222, 222, 222, 222, 222,
+	108, 107, 170, -32768, -32768, 42, -32768, 222, 149, 148,
+	9, -4, -13, -19, -19, 5, 5, 5, 5, 82,
+	82, -32768, -32768, -32768, -32768, -32768, 106, 147, 146, 145,
+	-32768, 141, 105, 104, 103, 140, 134, 133, 102, 101,
+	-32768, -27, -32768, -32768, 222, -32768, 222, 222, 222, -32768,
+	222, 222, 222, 222, -32768, -32768, -32768, 222, 222, 222,
+	-32768, -32768, -31, -32768, -32768, 93, 130, -32768, 73, 50,
+	30, 48, 44, 36, 29, -32, -30, -32768, 222, -32768,
+	-32768, 222, -32768, -32768, -32768, -32768, -32768, -32768, -32768, 16,
+	13, -32768, -32768,
 }
 
-var yyPgo = [...]int8{
-	0, 85, 79, 30, 76, 71, 70, 0, 1, 68,
-	6, 4, 16, 3, 8, 2, 66, 67, 57, 48,
+var yyPgo = [...]uint8{
+	0, 201, 3, 200, 199, 198, 2, 1, 196, 195,
+	194, 193, 0, 6, 192, 44, 19, 48, 42, 20,
+	25, 17, 191, 188, 187,
 }
 
 var yyR1 = [...]int8{
-	0, 1, 2, 2, 3, 3, 3, 4, 5, 5,
-	19, 19, 19, 6, 7, 8, 8, 9, 9, 10,
-	10, 11, 11, 11, 12, 12, 12, 12, 12, 13,
-	13, 13, 14, 14, 14, 14, 15, 15, 16, 16,
-	16, 16, 17, 17, 17, 17, 17, 17, 17, 17,
-	18, 18,
+	0, 1, 2, 2, 4, 4, 4, 4, 3, 5,
+	5, 5, 5, 6, 7, 7, 7, 8, 9, 10,
+	10, 24, 24, 24, 24, 24, 24, 11, 12, 13,
+	13, 14, 14, 15, 15, 16, 16, 16, 17, 17,
+	17, 17, 17, 18, 18, 18, 19, 19, 19, 19,
+	20, 20, 21, 21, 21, 21, 22, 22, 22, 22,
+	22, 22, 22, 22, 22, 22, 22, 22, 22, 22,
+	22, 22, 22, 22, 22, 22, 22, 22, 22, 22,
+	22, 22, 23, 23,
 }
 
 var yyR2 = [...]int8{
-	0, 1, 1, 3, 1, 1, 1, 2, 1, 3,
-	1, 1, 1, 3, 1, 1, 5, 1, 3, 1,
-	3, 1, 3, 3, 1, 3, 3, 3, 3, 1,
-	3, 3, 1, 3, 3, 3, 1, 3, 1, 2,
-	2, 2, 2, 1, 3, 4, 1, 1, 1, 3,
-	1, 3,
+	0, 1, 1, 1, 0, 2, 2, 2, 2, 1,
+	1, 1, 1, 3, 5, 7, 7, 4, 2, 1,
+	3, 1, 1, 1, 1, 1, 1, 3, 1, 1,
+	5, 1, 3, 1, 3, 1, 3, 3, 1, 3,
+	3, 3, 3, 1, 3, 3, 1, 3, 3, 3,
+	1, 3, 1, 2, 2, 2, 2, 1, 3, 3,
+	4, 4, 6, 6, 8, 3, 6, 4, 4, 4,
+	6, 8, 6, 6, 6, 4, 4, 1, 1, 1,
+	1, 3, 1, 3,
 }
 
 var yyChk = [...]int16{
-	-1000, -1, -2, -3, -4, -6, -7, -19, 4, -8,
-	7, 8, 9, -9, -10, -11, -12, -13, -14, -15,
-	-16, -17, 19, 20, 27, 5, 10, 11, 15, 13,
-	-5, 4, 12, 27, 15, 17, 26, 25, 32, 33,
-	28, 29, 30, 31, 19, 20, 21, 22, 23, 24,
-	-16, 4, -16, -16, -7, -3, 14, -7, 16, -18,
-	-7, -7, -10, -11, -12, -12, -13, -13, -13, -13,
-	-14, -14, -15, -15, -15, -15, 16, 4, 16, 14,
-	18, -7, -8,
+	-32768, -1, -2, -3, -4, 15, 15, -7, -5, 39,
+	-9, -11, -8, -12, -24, 4, 41, -13, 8, 9,
+	10, 11, 51, 52, -14, -15, -16, -17, -18, -19,
+	-20, -21, -22, 21, 22, 29, 45, 42, 43, 44,
+	46, 47, 48, 49, 50, 53, 55, 57, 54, 56,
+	5, 7, 12, 13, 17, 17, -10, 4, 14, 29,
+	17, 4, 17, 17, 19, 28, 27, 34, 35, 30,
+	31, 32, 33, 21, 22, 23, 24, 25, 26, 58,
+	-21, 4, 51, 52, -21, -21, 17, 17, 17, 17,
+	17, 17, 17, 17, 17, 17, 17, 17, 17, 17,
+	-12, -12, 16, -12, 18, -23, -12, 14, -12, -12,
+	-12, -15, -16, -17, -17, -18, -18, -18, -18, -19,
+	-19, -20, -20, -20, -20, 4, -12, -12, -12, -12,
+	18, -12, -12, 7, 7, -12, -12, -12, -12, -12,
+	18, 18, 4, 18, 16, -12, 16, 16, 20, 18,
+	16, 16, 16, 16, 18, 18, 18, 16, 16, 16,
+	18, 18, -6, 37, -12, -12, -12, -13, -12, -12,
+	-12, -12, -12, -12, -12, 40, -2, 18, 16, 18,
+	18, 16, 18, 18, 18, 18, -6, -7, 38, -12,
+	-12, 18, 18,
 }
 
 var yyDef = [...]int8{
-	0, -2, 1, 2, 4, 5, 6, 0, 43, 14,
-	10, 11, 12, 15, 17, 19, 21, 24, 29, 32,
-	36, 38, 0, 0, 0, 46, 47, 48, 0, 0,
-	7, 8, 0, 42, 0, 0, 0, 0, 0, 0,
+	4, -2, 1, 2, 3, 5, 6, 7, 8, 0,
+	9, 10, 11, 12, 0, 57, 0, 28, 21, 22,
+	23, 24, 25, 26, 29, 31, 33, 35, 38, 43,
+	46, 50, 52, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	77, 78, 79, 80, 0, 0, 18, 19, 0, 56,
 	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
-	39, 43, 40, 41, 0, 3, 0, 13, 44, 0,
-	50, 0, 18, 20, 22, 23, 25, 26, 27, 28,
-	30, 31, 33, 34, 35, 37, 49, 9, 45, 0,
-	0, 51, 16,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	53, 57, 0, 0, 54, 55, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 27, 59, 0, 82, 0, 0, 0,
+	0, 32, 34, 36, 37, 39, 40, 41, 42, 44,
+	45, 47, 48, 49, 51, 58, 0, 0, 0, 0,
+	65, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	81, 0, 20, 60, 0, 17, 0, 0, 0, 61,
+	0, 0, 0, 0, 67, 68, 69, 0, 0, 0,
+	75, 76, 14, 4, 83, 0, 0, 30, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 70, 0, 62,
+	63, 0, 66, 72, 73, 74, 15, 16, 13, 0,
+	0, 71, 64,
 }
 
 var yyTok1 = [...]int8{
@@ -451,7 +725,9 @@ var yyTok2 = [...]int8{
 	2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
 	12, 13, 14, 15, 16, 17, 18, 19, 20, 21,
 	22, 23, 24, 25, 26, 27, 28, 29, 30, 31,
-	32, 33, 34, 35, 36,
+	32, 33, 34, 35, 36, 37, 38, 39, 40, 41,
+	42, 43, 44, 45, 46, 47, 48, 49, 50, 51,
+	52, 53, 54, 55, 56, 57, 58, 59, 60, 61,
 }
 
 var yyTok3 = [...]int8{
@@ -497,7 +773,7 @@ func yyNewParser() yyParser {
 	return &yyParserImpl{}
 }
 
-const yyFlag = -1000
+const yyFlag = -32768
 
 func yyTokname(c int) string {
 	if c >= 1 && c-1 < len(yyToknames) {
@@ -797,422 +1073,747 @@ yydefault:
 
 	case 1:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:93
+//line g.y:125
 		{
-			if yyDollar[1].node.Type == NodeProgram {
-				yyVAL.node = yyDollar[1].node
+			if len(yyDollar[1].node.Children) == 0 {
+				yylex.Error("empty program")
 			} else {
-				yyVAL.node = &Node{Type: NodeProgram, Children: []*Node{yyDollar[1].node}}
+				yyDollar[1].node.Pos, yyDollar[1].node.End = yyDollar[1].node.Children[0].Pos, yyDollar[1].node.Children[len(yyDollar[1].node.Children)-1].End
 			}
+			yyVAL.node = yyDollar[1].node
 			yylex.(*SimpleLexer).result = yyVAL.node
 		}
 	case 2:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:105
+//line g.y:138
 		{
 			yyVAL.node = yyDollar[1].node
 		}
 	case 3:
-		yyDollar = yyS[yypt-3 : yypt+1]
-//line g.y:109
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line g.y:139
 		{
-			// 如果第一个节点不是NodeProgram类型，创建一个包装节点
-			if yyDollar[1].node.Type != NodeProgram {
-				yyVAL.node = &Node{Type: NodeProgram, Children: []*Node{yyDollar[1].node, yyDollar[3].node}}
-			} else {
-				yyDollar[1].node.Children = append(yyDollar[1].node.Children, yyDollar[3].node)
-				yyVAL.node = yyDollar[1].node
-			}
+			yyVAL.node = yyDollar[1].node
 		}
 	case 4:
+		yyDollar = yyS[yypt-0 : yypt+1]
+//line g.y:145
+		{
+			yyVAL.node = &Node{Type: NodeProgram}
+		}
+	case 5:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line g.y:149
+		{
+			yyVAL.node = yyDollar[1].node
+		}
+	case 6:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line g.y:153
+		{
+			yyVAL.node = yyDollar[1].node
+		}
+	case 7:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line g.y:157
+		{
+			yyDollar[1].node.Children = append(yyDollar[1].node.Children, yyDollar[2].node)
+			yyVAL.node = yyDollar[1].node
+		}
+	case 8:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line g.y:165
+		{
+			yyDollar[1].node.Children = append(yyDollar[1].node.Children, yyDollar[2].node)
+			yyVAL.node = yyDollar[1].node
+		}
+	case 9:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:121
+//line g.y:172
 		{
 			yyVAL.node = yyDollar[1].node
 		}
-	case 5:
+	case 10:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:122
+//line g.y:173
 		{
 			yyVAL.node = yyDollar[1].node
 		}
-	case 6:
+	case 11:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:123
+//line g.y:174
 		{
 			yyVAL.node = yyDollar[1].node
 		}
-	case 7:
+	case 12:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line g.y:175
+		{
+			yyVAL.node = yyDollar[1].node
+		}
+	case 13:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line g.y:180
+		{
+			yyDollar[2].node.Type = NodeBlock
+			yyDollar[2].node.Pos, yyDollar[2].node.End = yyDollar[1].pos, yyDollar[3].end
+			yyVAL.node = yyDollar[2].node
+		}
+	case 14:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line g.y:189
+		{
+			yyVAL.node = &Node{
+				Type: NodeIf,
+				Pos:  yyDollar[1].pos, End: yyDollar[5].node.End,
+				Children: []*Node{yyDollar[3].node, yyDollar[5].node},
+			}
+		}
+	case 15:
+		yyDollar = yyS[yypt-7 : yypt+1]
+//line g.y:197
+		{
+			yyVAL.node = &Node{
+				Type: NodeIf,
+				Pos:  yyDollar[1].pos, End: yyDollar[7].node.End,
+				Children: []*Node{yyDollar[3].node, yyDollar[5].node, yyDollar[7].node},
+			}
+		}
+	case 16:
+		yyDollar = yyS[yypt-7 : yypt+1]
+//line g.y:205
+		{
+			yyVAL.node = &Node{
+				Type: NodeIf,
+				Pos:  yyDollar[1].pos, End: yyDollar[7].node.End,
+				Children: []*Node{yyDollar[3].node, yyDollar[5].node, {Type: NodeBlock, Pos: yyDollar[7].node.Pos, End: yyDollar[7].node.End, Children: []*Node{yyDollar[7].node}}},
+			}
+		}
+	case 17:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line g.y:216
+		{
+			yyVAL.node = &Node{
+				Type: NodeLet,
+				Pos:  yyDollar[1].pos, End: yyDollar[4].node.End,
+				Token:    yyDollar[2].str,
+				Children: []*Node{yyDollar[4].node},
+			}
+		}
+	case 18:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line g.y:128
+//line g.y:228
 		{
 			yyVAL.node = &Node{
-				Type:  NodeVarDecl,
+				Type: NodeVarDecl,
+				Pos:  yyDollar[1].pos, End: yyDollar[2].end,
 				Token: yyDollar[1].str + ":" + yyDollar[2].str,
 			}
 		}
-	case 8:
+	case 19:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:138
+//line g.y:239
 		{
 			yyVAL.str = yyDollar[1].str
 		}
-	case 9:
+	case 20:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line g.y:142
+//line g.y:243
 		{
 			yyVAL.str = yyDollar[1].str + "," + yyDollar[3].str
+			yyVAL.end = yyDollar[3].end
 		}
-	case 10:
+	case 21:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:148
+//line g.y:250
 		{
 			yyVAL.str = "int"
 		}
-	case 11:
+	case 22:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:149
+//line g.y:251
 		{
 			yyVAL.str = "float"
 		}
-	case 12:
+	case 23:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:150
+//line g.y:252
 		{
 			yyVAL.str = "bool"
 		}
-	case 13:
+	case 24:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line g.y:253
+		{
+			yyVAL.str = "string"
+		}
+	case 25:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line g.y:254
+		{
+			yyVAL.str = "vec2"
+		}
+	case 26:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line g.y:255
+		{
+			yyVAL.str = "vec3"
+		}
+	case 27:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line g.y:155
+//line g.y:260
 		{
 			yyVAL.node = &Node{
-				Type:     NodeAssign,
+				Type: NodeAssign,
+				Pos:  yyDollar[1].pos, End: yyDollar[3].node.End,
 				Token:    yyDollar[1].str,
 				Children: []*Node{yyDollar[3].node},
 			}
 		}
-	case 14:
+	case 28:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:165
+//line g.y:271
 		{
 			yyVAL.node = yyDollar[1].node
 		}
-	case 15:
+	case 29:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:170
+//line g.y:276
 		{
 			yyVAL.node = yyDollar[1].node
 		}
-	case 16:
+	case 30:
 		yyDollar = yyS[yypt-5 : yypt+1]
-//line g.y:174
+//line g.y:280
 		{
 			yyVAL.node = &Node{
-				Type:     NodeTernary,
+				Type: NodeTernary,
+				Pos:  yyDollar[1].node.Pos, End: yyDollar[5].node.End,
 				Token:    "?:",
 				Children: []*Node{yyDollar[1].node, yyDollar[3].node, yyDollar[5].node},
 			}
 		}
-	case 17:
+	case 31:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:185
+//line g.y:292
 		{
 			yyVAL.node = yyDollar[1].node
 		}
-	case 18:
+	case 32:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line g.y:189
+//line g.y:296
 		{
 			yyVAL.node = &Node{
-				Type:     NodeBinOp,
+				Type: NodeBinOp,
+				Pos:  yyDollar[1].node.Pos, End: yyDollar[3].node.End,
 				Token:    "||",
 				Children: []*Node{yyDollar[1].node, yyDollar[3].node},
 			}
 		}
-	case 19:
+	case 33:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:200
+//line g.y:308
 		{
 			yyVAL.node = yyDollar[1].node
 		}
-	case 20:
+	case 34:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line g.y:204
+//line g.y:312
 		{
 			yyVAL.node = &Node{
-				Type:     NodeBinOp,
+				Type: NodeBinOp,
+				Pos:  yyDollar[1].node.Pos, End: yyDollar[3].node.End,
 				Token:    "&&",
 				Children: []*Node{yyDollar[1].node, yyDollar[3].node},
 			}
 		}
-	case 21:
+	case 35:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:215
+//line g.y:324
 		{
 			yyVAL.node = yyDollar[1].node
 		}
-	case 22:
+	case 36:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line g.y:219
+//line g.y:328
 		{
 			yyVAL.node = &Node{
-				Type:     NodeBinOp,
+				Type: NodeBinOp,
+				Pos:  yyDollar[1].node.Pos, End: yyDollar[3].node.End,
 				Token:    "==",
 				Children: []*Node{yyDollar[1].node, yyDollar[3].node},
 			}
 		}
-	case 23:
+	case 37:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line g.y:227
+//line g.y:337
 		{
 			yyVAL.node = &Node{
-				Type:     NodeBinOp,
+				Type: NodeBinOp,
+				Pos:  yyDollar[1].node.Pos, End: yyDollar[3].node.End,
 				Token:    "!=",
 				Children: []*Node{yyDollar[1].node, yyDollar[3].node},
 			}
 		}
-	case 24:
+	case 38:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:238
+//line g.y:349
 		{
 			yyVAL.node = yyDollar[1].node
 		}
-	case 25:
+	case 39:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line g.y:242
+//line g.y:353
 		{
 			yyVAL.node = &Node{
-				Type:     NodeBinOp,
+				Type: NodeBinOp,
+				Pos:  yyDollar[1].node.Pos, End: yyDollar[3].node.End,
 				Token:    "<",
 				Children: []*Node{yyDollar[1].node, yyDollar[3].node},
 			}
 		}
-	case 26:
+	case 40:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line g.y:250
+//line g.y:362
 		{
 			yyVAL.node = &Node{
-				Type:     NodeBinOp,
+				Type: NodeBinOp,
+				Pos:  yyDollar[1].node.Pos, End: yyDollar[3].node.End,
 				Token:    "<=",
 				Children: []*Node{yyDollar[1].node, yyDollar[3].node},
 			}
 		}
-	case 27:
+	case 41:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line g.y:258
+//line g.y:371
 		{
 			yyVAL.node = &Node{
-				Type:     NodeBinOp,
+				Type: NodeBinOp,
+				Pos:  yyDollar[1].node.Pos, End: yyDollar[3].node.End,
 				Token:    ">",
 				Children: []*Node{yyDollar[1].node, yyDollar[3].node},
 			}
 		}
-	case 28:
+	case 42:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line g.y:266
+//line g.y:380
 		{
 			yyVAL.node = &Node{
-				Type:     NodeBinOp,
+				Type: NodeBinOp,
+				Pos:  yyDollar[1].node.Pos, End: yyDollar[3].node.End,
 				Token:    ">=",
 				Children: []*Node{yyDollar[1].node, yyDollar[3].node},
 			}
 		}
-	case 29:
+	case 43:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:277
+//line g.y:392
 		{
 			yyVAL.node = yyDollar[1].node
 		}
-	case 30:
+	case 44:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line g.y:281
+//line g.y:396
 		{
 			yyVAL.node = &Node{
-				Type:     NodeBinOp,
+				Type: NodeBinOp,
+				Pos:  yyDollar[1].node.Pos, End: yyDollar[3].node.End,
 				Token:    "+",
 				Children: []*Node{yyDollar[1].node, yyDollar[3].node},
 			}
 		}
-	case 31:
+	case 45:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line g.y:289
+//line g.y:405
 		{
 			yyVAL.node = &Node{
-				Type:     NodeBinOp,
+				Type: NodeBinOp,
+				Pos:  yyDollar[1].node.Pos, End: yyDollar[3].node.End,
 				Token:    "-",
 				Children: []*Node{yyDollar[1].node, yyDollar[3].node},
 			}
 		}
-	case 32:
+	case 46:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:300
+//line g.y:417
 		{
 			yyVAL.node = yyDollar[1].node
 		}
-	case 33:
+	case 47:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line g.y:304
+//line g.y:421
 		{
 			yyVAL.node = &Node{
-				Type:     NodeBinOp,
+				Type: NodeBinOp,
+				Pos:  yyDollar[1].node.Pos, End: yyDollar[3].node.End,
 				Token:    "*",
 				Children: []*Node{yyDollar[1].node, yyDollar[3].node},
 			}
 		}
-	case 34:
+	case 48:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line g.y:312
+//line g.y:430
 		{
 			yyVAL.node = &Node{
-				Type:     NodeBinOp,
+				Type: NodeBinOp,
+				Pos:  yyDollar[1].node.Pos, End: yyDollar[3].node.End,
 				Token:    "/",
 				Children: []*Node{yyDollar[1].node, yyDollar[3].node},
 			}
 		}
-	case 35:
+	case 49:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line g.y:320
+//line g.y:439
 		{
 			yyVAL.node = &Node{
-				Type:     NodeBinOp,
+				Type: NodeBinOp,
+				Pos:  yyDollar[1].node.Pos, End: yyDollar[3].node.End,
 				Token:    "%",
 				Children: []*Node{yyDollar[1].node, yyDollar[3].node},
 			}
 		}
-	case 36:
+	case 50:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:331
+//line g.y:451
 		{
 			yyVAL.node = yyDollar[1].node
 		}
-	case 37:
+	case 51:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line g.y:335
+//line g.y:455
 		{
 			yyVAL.node = &Node{
-				Type:     NodeBinOp,
+				Type: NodeBinOp,
+				Pos:  yyDollar[1].node.Pos, End: yyDollar[3].node.End,
 				Token:    "^",
 				Children: []*Node{yyDollar[1].node, yyDollar[3].node},
 			}
 		}
-	case 38:
+	case 52:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:346
+//line g.y:467
 		{
 			yyVAL.node = yyDollar[1].node
 		}
-	case 39:
+	case 53:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line g.y:350
+//line g.y:471
 		{
 			yyVAL.node = &Node{
-				Type:     NodeUnaryOp,
+				Type: NodeUnaryOp,
+				Pos:  yyDollar[1].pos, End: yyDollar[2].node.End,
 				Token:    "+",
 				Children: []*Node{yyDollar[2].node},
 			}
 		}
-	case 40:
+	case 54:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line g.y:358
+//line g.y:480
 		{
 			yyVAL.node = &Node{
-				Type:     NodeUnaryOp,
+				Type: NodeUnaryOp,
+				Pos:  yyDollar[1].pos, End: yyDollar[2].node.End,
 				Token:    "-",
 				Children: []*Node{yyDollar[2].node},
 			}
 		}
-	case 41:
+	case 55:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line g.y:366
+//line g.y:489
 		{
 			yyVAL.node = &Node{
-				Type:     NodeUnaryOp,
+				Type: NodeUnaryOp,
+				Pos:  yyDollar[1].pos, End: yyDollar[2].node.End,
 				Token:    "!",
 				Children: []*Node{yyDollar[2].node},
 			}
 		}
-	case 42:
+	case 56:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line g.y:377
+//line g.y:501
 		{
-			yyVAL.node = &Node{
-				Type:  NodeIdent,
+			yyVAL.node = _member(&Node{
+				Type: NodeIdent,
+				Pos:  yyDollar[1].pos, End: yyDollar[2].end,
 				Token: yyDollar[1].str,
-			}
+			})
 		}
-	case 43:
+	case 57:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:384
+//line g.y:509
 		{
-			yyVAL.node = &Node{
-				Type:  NodeTryIdent,
+			yyVAL.node = _member(&Node{
+				Type: NodeTryIdent,
+				Pos:  yyDollar[1].pos, End: yyDollar[1].end,
 				Token: yyDollar[1].str,
+			})
+		}
+	case 58:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line g.y:517
+		{
+			yyVAL.node = &Node{
+				Type: NodeMember,
+				Pos:  yyDollar[1].node.Pos, End: yyDollar[3].end,
+				Token:    yyDollar[3].str,
+				Children: []*Node{yyDollar[1].node},
 			}
 		}
-	case 44:
+	case 59:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line g.y:391
+//line g.y:526
 		{
 			yyVAL.node = &Node{
-				Type:  NodeFunc,
+				Type: NodeFunc,
+				Pos:  yyDollar[1].pos, End: yyDollar[3].end,
 				Token: yyDollar[1].str,
 			}
 		}
-	case 45:
+	case 60:
 		yyDollar = yyS[yypt-4 : yypt+1]
-//line g.y:398
+//line g.y:534
 		{
 			yyVAL.node = &Node{
-				Type:     NodeFunc,
+				Type: NodeFunc,
+				Pos:  yyDollar[1].pos, End: yyDollar[4].end,
 				Token:    yyDollar[1].str,
 				Children: yyDollar[3].node.Children,
 			}
 		}
-	case 46:
+	case 61:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line g.y:543
+		{
+			yyVAL.node = &Node{
+				Type: NodeBuiltin,
+				Pos:  yyDollar[1].pos, End: yyDollar[4].end,
+				Token:    "abs",
+				Children: []*Node{yyDollar[3].node},
+			}
+		}
+	case 62:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line g.y:552
+		{
+			yyVAL.node = &Node{
+				Type: NodeBuiltin,
+				Pos:  yyDollar[1].pos, End: yyDollar[6].end,
+				Token:    "min",
+				Children: []*Node{yyDollar[3].node, yyDollar[5].node},
+			}
+		}
+	case 63:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line g.y:561
+		{
+			yyVAL.node = &Node{
+				Type: NodeBuiltin,
+				Pos:  yyDollar[1].pos, End: yyDollar[6].end,
+				Token:    "max",
+				Children: []*Node{yyDollar[3].node, yyDollar[5].node},
+			}
+		}
+	case 64:
+		yyDollar = yyS[yypt-8 : yypt+1]
+//line g.y:570
+		{
+			yyVAL.node = &Node{
+				Type: NodeBuiltin,
+				Pos:  yyDollar[1].pos, End: yyDollar[8].end,
+				Token:    "clamp",
+				Children: []*Node{yyDollar[3].node, yyDollar[5].node, yyDollar[7].node},
+			}
+		}
+	case 65:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line g.y:579
+		{
+			yyVAL.node = &Node{
+				Type: NodeBuiltin,
+				Pos:  yyDollar[1].pos, End: yyDollar[3].end,
+				Token: "rand",
+			}
+		}
+	case 66:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line g.y:587
+		{
+			yyVAL.node = &Node{
+				Type: NodeBuiltin,
+				Pos:  yyDollar[1].pos, End: yyDollar[6].end,
+				Token:    "randint",
+				Children: []*Node{yyDollar[3].node, yyDollar[5].node},
+			}
+		}
+	case 67:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line g.y:596
+		{
+			yyVAL.node = &Node{
+				Type: NodeBuiltin,
+				Pos:  yyDollar[1].pos, End: yyDollar[4].end,
+				Token:    "chance",
+				Children: []*Node{yyDollar[3].node},
+			}
+		}
+	case 68:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line g.y:605
+		{
+			yyVAL.node = &Node{
+				Type: NodeBuiltin,
+				Pos:  yyDollar[1].pos, End: yyDollar[4].end,
+				Token:    "has_tag",
+				Children: []*Node{{Type: NodeString, Token: yyDollar[3].str, Pos: yyDollar[3].pos, End: yyDollar[3].end}},
+			}
+		}
+	case 69:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line g.y:614
+		{
+			yyVAL.node = &Node{
+				Type: NodeBuiltin,
+				Pos:  yyDollar[1].pos, End: yyDollar[4].end,
+				Token:    "has_tag_exact",
+				Children: []*Node{{Type: NodeString, Token: yyDollar[3].str, Pos: yyDollar[3].pos, End: yyDollar[3].end}},
+			}
+		}
+	case 70:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line g.y:623
+		{
+			yyVAL.node = &Node{
+				Type: NodeBuiltin,
+				Pos:  yyDollar[1].pos, End: yyDollar[6].end,
+				Token:    "vec2",
+				Children: []*Node{yyDollar[3].node, yyDollar[5].node},
+			}
+		}
+	case 71:
+		yyDollar = yyS[yypt-8 : yypt+1]
+//line g.y:632
+		{
+			yyVAL.node = &Node{
+				Type: NodeBuiltin,
+				Pos:  yyDollar[1].pos, End: yyDollar[8].end,
+				Token:    "vec3",
+				Children: []*Node{yyDollar[3].node, yyDollar[5].node, yyDollar[7].node},
+			}
+		}
+	case 72:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line g.y:641
+		{
+			yyVAL.node = &Node{
+				Type: NodeBuiltin,
+				Pos:  yyDollar[1].pos, End: yyDollar[6].end,
+				Token:    "dist",
+				Children: []*Node{yyDollar[3].node, yyDollar[5].node},
+			}
+		}
+	case 73:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line g.y:650
+		{
+			yyVAL.node = &Node{
+				Type: NodeBuiltin,
+				Pos:  yyDollar[1].pos, End: yyDollar[6].end,
+				Token:    "dot",
+				Children: []*Node{yyDollar[3].node, yyDollar[5].node},
+			}
+		}
+	case 74:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line g.y:659
+		{
+			yyVAL.node = &Node{
+				Type: NodeBuiltin,
+				Pos:  yyDollar[1].pos, End: yyDollar[6].end,
+				Token:    "angle",
+				Children: []*Node{yyDollar[3].node, yyDollar[5].node},
+			}
+		}
+	case 75:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line g.y:668
+		{
+			yyVAL.node = &Node{
+				Type: NodeBuiltin,
+				Pos:  yyDollar[1].pos, End: yyDollar[4].end,
+				Token:    "len",
+				Children: []*Node{yyDollar[3].node},
+			}
+		}
+	case 76:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line g.y:677
+		{
+			yyVAL.node = &Node{
+				Type: NodeBuiltin,
+				Pos:  yyDollar[1].pos, End: yyDollar[4].end,
+				Token:    "normalize",
+				Children: []*Node{yyDollar[3].node},
+			}
+		}
+	case 77:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:406
+//line g.y:686
 		{
 			yyVAL.node = &Node{
-				Type:  NodeNumber,
+				Type: NodeNumber,
+				Pos:  yyDollar[1].pos, End: yyDollar[1].end,
 				Token: yyDollar[1].str,
 			}
 		}
-	case 47:
+	case 78:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line g.y:694
+		{
+			yyVAL.node = &Node{
+				Type: NodeString,
+				Pos:  yyDollar[1].pos, End: yyDollar[1].end,
+				Token: yyDollar[1].str,
+			}
+		}
+	case 79:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:413
+//line g.y:702
 		{
 			yyVAL.node = &Node{
-				Type:  NodeBool,
+				Type: NodeBool,
+				Pos:  yyDollar[1].pos, End: yyDollar[1].end,
 				Token: "true",
 			}
 		}
-	case 48:
+	case 80:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:420
+//line g.y:710
 		{
 			yyVAL.node = &Node{
-				Type:  NodeBool,
+				Type: NodeBool,
+				Pos:  yyDollar[1].pos, End: yyDollar[1].end,
 				Token: "false",
 			}
 		}
-	case 49:
+	case 81:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line g.y:427
+//line g.y:718
 		{
+			yyDollar[2].node.Pos, yyDollar[2].node.End = yyDollar[1].pos, yyDollar[3].end
 			yyVAL.node = yyDollar[2].node
 		}
-	case 50:
+	case 82:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line g.y:434
+//line g.y:726
 		{
 			yyVAL.node = &Node{
 				Type:     NodeProgram, // 临时使用NodeProgram类型作为列表容器
 				Children: []*Node{yyDollar[1].node},
 			}
 		}
-	case 51:
+	case 83:
 		yyDollar = yyS[yypt-3 : yypt+1]
-//line g.y:441
+//line g.y:733
 		{
 			yyDollar[1].node.Children = append(yyDollar[1].node.Children, yyDollar[3].node)
 			yyVAL.node = yyDollar[1].node
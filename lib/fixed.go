@@ -0,0 +1,285 @@
+package lib
+
+import (
+	"math"
+	"math/big"
+	"math/bits"
+	"strconv"
+)
+
+// Q32 是 Q32.32 定点数，值为 int64(q) / 2^32，范围约为 ±2.1e9，精度约 2.3e-10。
+// 所有运算只使用整数指令，在任何平台、编译器上结果逐位一致，用于帧同步中的确定性计算。
+//
+// 运算规则：
+//   - 溢出饱和到 MaxQ32/MinQ32，不回绕
+//   - 乘除的舍入为就近舍入，恰好一半时远离零
+//   - 除以零：0/0 为 0，正数/0 为 MaxQ32，负数/0 为 MinQ32
+//   - 幂：整数指数用平方求幂，负指数取倒数；非整数指数按 exp2(b*log2(a)) 计算，
+//     底数为负时结果为 0；0 的负数次幂为 MaxQ32
+type Q32 int64
+
+const (
+	q32Frac = 32
+
+	OneQ32 Q32 = 1 << q32Frac
+	MaxQ32 Q32 = math.MaxInt64
+	MinQ32 Q32 = math.MinInt64
+)
+
+// Q32FromInt 把整数转换为定点数，超出范围时饱和
+func Q32FromInt(i int64) Q32 {
+	if i >= 1<<(63-q32Frac) {
+		return MaxQ32
+	}
+	if i < -1<<(63-q32Frac) {
+		return MinQ32
+	}
+	return Q32(i << q32Frac)
+}
+
+// Q32FromFloat64 把浮点数就近舍入为定点数，超出范围时饱和，NaN 为 0
+func Q32FromFloat64(f float64) Q32 {
+	if f != f {
+		return 0
+	}
+	// 乘以 2 的幂是精确的，math.Round 恰好一半时远离零
+	r := math.Round(math.Ldexp(f, q32Frac))
+	if r >= math.MaxInt64 {
+		return MaxQ32
+	}
+	if r <= math.MinInt64 {
+		return MinQ32
+	}
+	return Q32(r)
+}
+
+// ParseQ32 把十进制数字串精确舍入为定点数，不经过 float64
+func ParseQ32(s string) (Q32, bool) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, false
+	}
+	r.Mul(r, new(big.Rat).SetInt64(int64(OneQ32)))
+	// 就近舍入，恰好一半时远离零
+	num, den := r.Num(), r.Denom()
+	q, m := new(big.Int).QuoRem(num, den, new(big.Int))
+	if m2 := new(big.Int).Abs(m); m2.Lsh(m2, 1).Cmp(den) >= 0 {
+		q.Add(q, big.NewInt(int64(num.Sign())))
+	}
+	if !q.IsInt64() {
+		if q.Sign() > 0 {
+			return MaxQ32, true
+		}
+		return MinQ32, true
+	}
+	return Q32(q.Int64()), true
+}
+
+// Float64 把定点数转换为最接近的浮点数
+func (q Q32) Float64() float64 {
+	return math.Ldexp(float64(q), -q32Frac)
+}
+
+// Int64 返回向零取整的整数部分
+func (q Q32) Int64() int64 {
+	if q < 0 {
+		return -int64(_absU64(q) >> q32Frac)
+	}
+	return int64(q) >> q32Frac
+}
+
+func (q Q32) String() string {
+	return strconv.FormatFloat(q.Float64(), 'f', -1, 64)
+}
+
+func (q Q32) Neg() Q32 {
+	if q == MinQ32 {
+		return MaxQ32
+	}
+	return -q
+}
+
+func (q Q32) Abs() Q32 {
+	if q < 0 {
+		return q.Neg()
+	}
+	return q
+}
+
+func (q Q32) Add(o Q32) Q32 {
+	r := q + o
+	// 同号相加结果变号即溢出
+	if (q >= 0) == (o >= 0) && (r >= 0) != (q >= 0) {
+		if q >= 0 {
+			return MaxQ32
+		}
+		return MinQ32
+	}
+	return r
+}
+
+func (q Q32) Sub(o Q32) Q32 {
+	r := q - o
+	if (q >= 0) != (o >= 0) && (r >= 0) != (q >= 0) {
+		if q >= 0 {
+			return MaxQ32
+		}
+		return MinQ32
+	}
+	return r
+}
+
+func (q Q32) Mul(o Q32) Q32 {
+	neg := (q < 0) != (o < 0)
+	hi, lo := bits.Mul64(_absU64(q), _absU64(o))
+	// 右移 32 位并就近舍入
+	lo, c := bits.Add64(lo, 1<<(q32Frac-1), 0)
+	hi += c
+	if hi >= 1<<q32Frac {
+		return _saturate(neg)
+	}
+	return _signed(hi<<q32Frac|lo>>q32Frac, neg)
+}
+
+func (q Q32) Div(o Q32) Q32 {
+	if o == 0 {
+		switch {
+		case q > 0:
+			return MaxQ32
+		case q < 0:
+			return MinQ32
+		}
+		return 0
+	}
+	neg := (q < 0) != (o < 0)
+	a, b := _absU64(q), _absU64(o)
+	// (a << 32) / b，商超过 64 位时饱和
+	hi, lo := a>>(64-q32Frac), a<<q32Frac
+	if hi >= b {
+		return _saturate(neg)
+	}
+	r, m := bits.Div64(hi, lo, b)
+	// 余数的两倍不小于除数时进位，m < b 不会溢出 128 位比较
+	if m >= b-m {
+		if r++; r == 0 {
+			return _saturate(neg)
+		}
+	}
+	return _signed(r, neg)
+}
+
+// Pow 返回 q 的 o 次幂，规则见 Q32
+func (q Q32) Pow(o Q32) Q32 {
+	if o&(OneQ32-1) == 0 {
+		n := int64(o) >> q32Frac
+		if n >= 0 {
+			return q.powInt(uint64(n))
+		}
+		return OneQ32.Div(q.powInt(uint64(-n)))
+	}
+	switch {
+	case q < 0:
+		return 0
+	case q == 0:
+		if o > 0 {
+			return 0
+		}
+		return MaxQ32
+	}
+	return _exp2(o.Mul(_log2(q)))
+}
+
+func (q Q32) powInt(n uint64) Q32 {
+	r := OneQ32
+	for n > 0 {
+		if n&1 != 0 {
+			r = r.Mul(q)
+		}
+		n >>= 1
+		if n > 0 {
+			q = q.Mul(q)
+		}
+	}
+	return r
+}
+
+// _log2 计算正数的以 2 为底的对数，小数部分逐位平方求得
+func _log2(q Q32) Q32 {
+	p := 63 - bits.LeadingZeros64(uint64(q))
+	r := Q32(int64(p-q32Frac) << q32Frac)
+	// y 是 [1, 2) 上的 Q1.63
+	y := uint64(q) << (63 - p)
+	for i := q32Frac - 1; i >= 0; i-- {
+		hi, lo := bits.Mul64(y, y)
+		if hi >= 1<<63 {
+			y = hi
+			r |= 1 << i
+		} else {
+			y = hi<<1 | lo>>63
+		}
+	}
+	return r
+}
+
+// exp2Table[i] 是 2^(2^-(i+1)) 的 Q2.62 表示，由 big.Float 开平方得到，与平台无关
+var exp2Table = func() (t [q32Frac]uint64) {
+	c := new(big.Float).SetPrec(128).SetInt64(2)
+	for i := range t {
+		c.Sqrt(c)
+		x, _ := new(big.Float).SetPrec(128).SetMantExp(c, 62).Int(nil)
+		t[i] = x.Uint64()
+	}
+	return
+}()
+
+// _exp2 计算 2 的 q 次幂，小数部分按位累乘查表的常数
+func _exp2(q Q32) Q32 {
+	if q >= Q32(int64(63-q32Frac)<<q32Frac) {
+		return MaxQ32
+	}
+	ip := int64(q) >> q32Frac
+	if ip < -q32Frac-1 {
+		return 0
+	}
+	r := uint64(1) << 62
+	for i, c := range exp2Table {
+		if uint64(q)&(1<<(q32Frac-1-i)) != 0 {
+			hi, lo := bits.Mul64(r, c)
+			r = hi<<2 | lo>>62
+		}
+	}
+	// r 是 [1, 2) 上的 Q2.62，转换为 Q32.32 并乘以 2^ip
+	shift := uint(62 - q32Frac - ip)
+	if shift == 0 {
+		return Q32(r)
+	}
+	return Q32((r + 1<<(shift-1)) >> shift)
+}
+
+func _absU64(q Q32) uint64 {
+	if q < 0 {
+		return -uint64(q)
+	}
+	return uint64(q)
+}
+
+func _saturate(neg bool) Q32 {
+	if neg {
+		return MinQ32
+	}
+	return MaxQ32
+}
+
+// _signed 把绝对值 u 加上符号，超出范围时饱和
+func _signed(u uint64, neg bool) Q32 {
+	if neg {
+		if u > 1<<63 {
+			return MinQ32
+		}
+		return Q32(-u)
+	}
+	if u > math.MaxInt64 {
+		return MaxQ32
+	}
+	return Q32(u)
+}
@@ -0,0 +1,101 @@
+package lib
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func q(f float64) Q32 { return Q32FromFloat64(f) }
+
+func TestQ32Convert(t *testing.T) {
+	assert.Equal(t, OneQ32, Q32FromInt(1))
+	assert.Equal(t, MaxQ32, Q32FromInt(1<<31))
+	assert.Equal(t, MinQ32, Q32FromInt(-1<<31-1))
+	assert.Equal(t, Q32(-1<<63), Q32FromInt(-1<<31))
+	assert.Equal(t, Q32(0), Q32FromFloat64(math.NaN()))
+	assert.Equal(t, MaxQ32, Q32FromFloat64(math.Inf(1)))
+	assert.Equal(t, MinQ32, Q32FromFloat64(-1e300))
+	assert.Equal(t, 1.5, q(1.5).Float64())
+	assert.Equal(t, int64(-2), q(-2.75).Int64())
+	assert.Equal(t, int64(2), q(2.75).Int64())
+	assert.Equal(t, "-2.75", q(-2.75).String())
+
+	// 十进制字面量直接舍入，不经过 float64
+	x, ok := ParseQ32("0.35")
+	assert.True(t, ok)
+	assert.Equal(t, Q32(1503238554), x) // 0.35 * 2^32 = 1503238553.6
+	x, _ = ParseQ32("-0.35")
+	assert.Equal(t, Q32(-1503238554), x)
+	x, _ = ParseQ32("99999999999")
+	assert.Equal(t, MaxQ32, x)
+	_, ok = ParseQ32("abc")
+	assert.False(t, ok)
+
+	f := Fixed(q(0.5))
+	v, ok := f.Fixed()
+	assert.True(t, ok)
+	assert.Equal(t, q(0.5), v)
+	fv, ok := f.Float64()
+	assert.True(t, ok)
+	assert.Equal(t, 0.5, fv)
+	v, _ = Int64(3).Fixed()
+	assert.Equal(t, Q32FromInt(3), v)
+	v, _ = Float64(0.25).Fixed()
+	assert.Equal(t, q(0.25), v)
+	_, ok = String("x").Fixed()
+	assert.False(t, ok)
+}
+
+func TestQ32Arith(t *testing.T) {
+	assert.Equal(t, q(3.75), q(1.5).Add(q(2.25)))
+	assert.Equal(t, MaxQ32, q(2e9).Add(q(2e9)))
+	assert.Equal(t, MinQ32, q(-2e9).Sub(q(2e9)))
+	assert.Equal(t, q(-0.75), q(1.5).Sub(q(2.25)))
+	assert.Equal(t, q(3.375), q(1.5).Mul(q(2.25)))
+	assert.Equal(t, q(-3.375), q(-1.5).Mul(q(2.25)))
+	assert.Equal(t, MaxQ32, q(-1e6).Mul(q(-1e6)))
+	assert.Equal(t, MinQ32, q(1e6).Mul(q(-1e6)))
+	assert.Equal(t, MaxQ32, MinQ32.Neg())
+	assert.Equal(t, MaxQ32, MinQ32.Abs())
+
+	// 最低位的舍入：一半远离零
+	half := Q32(1)
+	assert.Equal(t, Q32(1), half.Mul(q(0.5)))
+	assert.Equal(t, Q32(-1), half.Neg().Mul(q(0.5)))
+	assert.Equal(t, Q32(0), half.Mul(q(0.25)))
+
+	assert.Equal(t, q(0.42), Q32FromInt(42).Div(Q32FromInt(100)))
+	assert.Equal(t, q(-2.5), q(5).Div(q(-2)))
+	third := OneQ32.Div(Q32FromInt(3))
+	assert.Equal(t, Q32(1431655765), third)
+	assert.Equal(t, Q32(-1431655765), OneQ32.Neg().Div(Q32FromInt(3)))
+	assert.Equal(t, Q32(2863311531), Q32FromInt(2).Div(Q32FromInt(3)))
+	assert.Equal(t, MaxQ32, q(1).Div(0))
+	assert.Equal(t, MinQ32, q(-1).Div(0))
+	assert.Equal(t, Q32(0), Q32(0).Div(0))
+	assert.Equal(t, MaxQ32, q(1e9).Div(q(0.001)))
+}
+
+func TestQ32Pow(t *testing.T) {
+	assert.Equal(t, q(1024), q(2).Pow(q(10)))
+	assert.Equal(t, q(-8), q(-2).Pow(q(3)))
+	assert.Equal(t, q(0.125), q(2).Pow(q(-3)))
+	assert.Equal(t, OneQ32, q(7).Pow(0))
+	assert.Equal(t, MaxQ32, q(2).Pow(q(40)))
+	assert.Equal(t, MaxQ32, Q32(0).Pow(q(-1)))
+	assert.Equal(t, Q32(0), q(-2).Pow(q(0.5)))
+	assert.Equal(t, Q32(0), Q32(0).Pow(q(0.5)))
+	// 指数很大时也只循环 log2(n) 次
+	assert.Equal(t, MaxQ32, q(1.5).Pow(q(2e9)))
+	assert.Equal(t, Q32(0), q(0.5).Pow(q(2e9)))
+
+	for _, c := range [][2]float64{{2, 0.5}, {9, 0.5}, {10, 1.5}, {0.3, 2.7}, {1.1, -3.3}, {1234.5, 0.25}, {2, 30.5}} {
+		got := q(c[0]).Pow(q(c[1])).Float64()
+		want := math.Pow(c[0], c[1])
+		assert.InEpsilon(t, want, got, 1e-7, "%v", c)
+	}
+	assert.Equal(t, MaxQ32, q(2).Pow(q(31.5)))
+	assert.Equal(t, Q32(0), q(2).Pow(q(-40.5)))
+}
@@ -12,6 +12,10 @@ const (
 	KindFloat32
 	KindFloat64
 	KindBool
+	KindString
+	KindFixed // Q32 定点数，见 Q32
+	KindVec2  // 二维向量，见 Vec2
+	KindVec3  // 三维向量，见 Vec3
 )
 
 // Field 主要做数值计算，也可以用来存储 any
@@ -67,6 +71,21 @@ func Bool(v bool) Field {
 	}
 }
 
+func String(v string) Field {
+	return Field{
+		kind: KindString,
+		va:   v,
+	}
+}
+
+// Fixed 存储 Q32 定点数
+func Fixed(v Q32) Field {
+	return Field{
+		kind: KindFixed,
+		vi:   int64(v),
+	}
+}
+
 func TakeAny[T any](f *Field) (v T, ok bool) {
 	if f.kind == KindAny {
 		v, ok = f.va.(T)
@@ -107,6 +126,23 @@ func (f Field) Float64() (float64, bool) {
 		return float64(math.Float32frombits(uint32(f.vi))), true
 	case KindInt32, KindInt64:
 		return float64(f.vi), true
+	case KindFixed:
+		return Q32(f.vi).Float64(), true
+	default:
+		return 0, false
+	}
+}
+
+// Fixed 读取定点数，整数与浮点数按 Q32FromInt/Q32FromFloat64 转换
+func (f Field) Fixed() (Q32, bool) {
+	switch f.kind {
+	case KindFixed:
+		return Q32(f.vi), true
+	case KindInt32, KindInt64:
+		return Q32FromInt(f.vi), true
+	case KindFloat32, KindFloat64:
+		v, _ := f.Float64()
+		return Q32FromFloat64(v), true
 	default:
 		return 0, false
 	}
@@ -120,3 +156,10 @@ func (f Field) Bool() (bool, bool) {
 		return false, false
 	}
 }
+
+func (f Field) Str() (string, bool) {
+	if f.kind == KindString {
+		return f.va.(string), true
+	}
+	return "", false
+}
@@ -0,0 +1,93 @@
+package lib
+
+import "math"
+
+// Vec2 是二维向量
+type Vec2 struct {
+	X, Y float64
+}
+
+// Vec3 是三维向量
+type Vec3 struct {
+	X, Y, Z float64
+}
+
+// Vector2 存储二维向量
+func Vector2(v Vec2) Field {
+	return Field{
+		kind: KindVec2,
+		va:   v,
+	}
+}
+
+// Vector3 存储三维向量
+func Vector3(v Vec3) Field {
+	return Field{
+		kind: KindVec3,
+		va:   v,
+	}
+}
+
+func (f Field) Vec2() (Vec2, bool) {
+	if f.kind == KindVec2 {
+		return f.va.(Vec2), true
+	}
+	return Vec2{}, false
+}
+
+func (f Field) Vec3() (Vec3, bool) {
+	if f.kind == KindVec3 {
+		return f.va.(Vec3), true
+	}
+	return Vec3{}, false
+}
+
+func (a Vec2) Add(b Vec2) Vec2      { return Vec2{a.X + b.X, a.Y + b.Y} }
+func (a Vec2) Sub(b Vec2) Vec2      { return Vec2{a.X - b.X, a.Y - b.Y} }
+func (a Vec2) Scale(s float64) Vec2 { return Vec2{a.X * s, a.Y * s} }
+func (a Vec2) Div(s float64) Vec2   { return Vec2{a.X / s, a.Y / s} }
+func (a Vec2) Dot(b Vec2) float64   { return a.X*b.X + a.Y*b.Y }
+func (a Vec2) Len() float64         { return math.Sqrt(a.Dot(a)) }
+func (a Vec2) Dist(b Vec2) float64  { return a.Sub(b).Len() }
+
+// Normalize 返回同方向的单位向量，零向量返回零向量
+func (a Vec2) Normalize() Vec2 {
+	if l := a.Len(); l != 0 {
+		return a.Scale(1 / l)
+	}
+	return Vec2{}
+}
+
+// Angle 返回两个向量的夹角，单位为度，范围 [0, 180]；任一向量为零向量时返回 0
+func (a Vec2) Angle(b Vec2) float64 {
+	return _angle(a.Dot(b), a.Len()*b.Len())
+}
+
+func (a Vec3) Add(b Vec3) Vec3      { return Vec3{a.X + b.X, a.Y + b.Y, a.Z + b.Z} }
+func (a Vec3) Sub(b Vec3) Vec3      { return Vec3{a.X - b.X, a.Y - b.Y, a.Z - b.Z} }
+func (a Vec3) Scale(s float64) Vec3 { return Vec3{a.X * s, a.Y * s, a.Z * s} }
+func (a Vec3) Div(s float64) Vec3   { return Vec3{a.X / s, a.Y / s, a.Z / s} }
+func (a Vec3) Dot(b Vec3) float64   { return a.X*b.X + a.Y*b.Y + a.Z*b.Z }
+func (a Vec3) Len() float64         { return math.Sqrt(a.Dot(a)) }
+func (a Vec3) Dist(b Vec3) float64  { return a.Sub(b).Len() }
+
+// Normalize 返回同方向的单位向量，零向量返回零向量
+func (a Vec3) Normalize() Vec3 {
+	if l := a.Len(); l != 0 {
+		return a.Scale(1 / l)
+	}
+	return Vec3{}
+}
+
+// Angle 返回两个向量的夹角，单位为度，范围 [0, 180]；任一向量为零向量时返回 0
+func (a Vec3) Angle(b Vec3) float64 {
+	return _angle(a.Dot(b), a.Len()*b.Len())
+}
+
+func _angle(dot, lens float64) float64 {
+	if lens == 0 {
+		return 0
+	}
+	// 舍入误差可能让余弦略微超出 [-1, 1]
+	return math.Acos(max(-1, min(1, dot/lens))) * 180 / math.Pi
+}
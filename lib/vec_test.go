@@ -0,0 +1,37 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVec(t *testing.T) {
+	a, b := Vec2{X: 3, Y: 4}, Vec2{X: 1, Y: 0}
+	assert.Equal(t, Vec2{X: 4, Y: 4}, a.Add(b))
+	assert.Equal(t, Vec2{X: 2, Y: 4}, a.Sub(b))
+	assert.Equal(t, 5.0, a.Len())
+	assert.Equal(t, 3.0, a.Dot(b))
+	assert.InDelta(t, 53.1301, a.Angle(b), 1e-4)
+	assert.Equal(t, 180.0, b.Angle(b.Scale(-2)))
+	assert.Equal(t, 0.0, b.Angle(Vec2{}))
+	assert.Equal(t, Vec2{}, Vec2{}.Normalize())
+
+	c := Vec3{X: 1, Y: 2, Z: 2}
+	assert.Equal(t, 3.0, c.Len())
+	assert.Equal(t, 3.0, c.Dist(Vec3{}))
+	assert.Equal(t, Vec3{X: 0.5, Y: 1, Z: 1}, c.Div(2))
+	assert.InDelta(t, 1.0, c.Normalize().Len(), 1e-12)
+
+	f := Vector2(a)
+	v, ok := f.Vec2()
+	assert.True(t, ok)
+	assert.Equal(t, a, v)
+	_, ok = f.Vec3()
+	assert.False(t, ok)
+	_, ok = f.Float64()
+	assert.False(t, ok)
+	w, ok := Vector3(c).Vec3()
+	assert.True(t, ok)
+	assert.Equal(t, c, w)
+}